@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type AdminConfig struct {
+	Listen string `toml:"listen"` // 管理 API の待ち受けアドレス (e.g. 127.0.0.1:9888)。空の場合は管理 API を提供しない
+}
+
+var adminURL string
+var adminFilterProvider string
+var adminFilterSubject string
+var adminFilterIP string
+
+// adminConfigCheck は管理 API の待ち受けアドレスを検証する
+func adminConfigCheck() error {
+	if serveConfig.Admin.Listen == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(serveConfig.Admin.Listen); err != nil {
+		return fmt.Errorf("admin.listen: %w", err)
+	}
+	if serveConfig.Admin.Listen == fmt.Sprintf(":%d", serveConfig.Port) {
+		return fmt.Errorf("admin.listen must be a different port from server_port")
+	}
+	return nil
+}
+
+// adminTokenLoad は管理 API のトークンを環境変数から読み込む
+func adminTokenLoad() (string, error) {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		return "", fmt.Errorf("ADMIN_TOKEN is not set")
+	}
+	return token, nil
+}
+
+// adminBaseURL は --url、または config の admin.listen から管理 API の URL を求める
+func adminBaseURL() (string, error) {
+	if adminURL != "" {
+		return strings.TrimSuffix(adminURL, "/"), nil
+	}
+	if err := configLoad(); err != nil {
+		return "", err
+	}
+	if serveConfig.Admin.Listen == "" {
+		return "", fmt.Errorf("admin.listen is not set in %s", serveConfigPath)
+	}
+	host, port, err := net.SplitHostPort(serveConfig.Admin.Listen)
+	if err != nil {
+		return "", fmt.Errorf("admin.listen: %w", err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port), nil
+}
+
+// adminRequest は管理 API を呼び、2xx 以外はエラーにする。res が nil でなければ JSON を読み込む
+func adminRequest(method, path string, res any) error {
+	base, err := adminBaseURL()
+	if err != nil {
+		return err
+	}
+	token, err := adminTokenLoad()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, base+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	c := &http.Client{Timeout: 10 * time.Second}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("not found")
+	}
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("admin api returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if res == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// adminCmd represents the admin command
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Manage active sessions through the admin API",
+	Long: `Manage active sessions through the admin API of a running server.
+The API token is read from ADMIN_TOKEN.`,
+}
+
+// adminSessionsCmd represents the admin sessions command
+var adminSessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List active sessions",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		q := url.Values{}
+		if adminFilterProvider != "" {
+			q.Set("provider", adminFilterProvider)
+		}
+		if adminFilterSubject != "" {
+			q.Set("subject", adminFilterSubject)
+		}
+		if adminFilterIP != "" {
+			q.Set("ip", adminFilterIP)
+		}
+		var res struct {
+			Sessions []struct {
+				ID         string    `json:"id"`
+				Provider   string    `json:"provider"`
+				Subject    string    `json:"subject"`
+				Name       string    `json:"name"`
+				IP         string    `json:"ip"`
+				CreatedAt  time.Time `json:"created_at"`
+				LastSeenAt time.Time `json:"last_seen_at"`
+				ExpiresAt  time.Time `json:"expires_at"`
+			} `json:"sessions"`
+		}
+		if err := adminRequest(http.MethodGet, "/sessions?"+q.Encode(), &res); err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tPROVIDER\tSUBJECT\tNAME\tIP\tCREATED\tLAST SEEN\tEXPIRES")
+		for _, s := range res.Sessions {
+			ip := s.IP
+			if ip == "" {
+				ip = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				s.ID, s.Provider, s.Subject, s.Name, ip,
+				formatTime(&s.CreatedAt), formatTime(&s.LastSeenAt), formatTime(&s.ExpiresAt),
+			)
+		}
+		return w.Flush()
+	},
+}
+
+// adminRevokeCmd represents the admin revoke command
+var adminRevokeCmd = &cobra.Command{
+	Use:   "revoke ID",
+	Short: "Revoke a session",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := adminRequest(http.MethodDelete, "/sessions/"+url.PathEscape(args[0]), nil); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "revoked: %s\n", args[0])
+		return nil
+	},
+}
+
+// adminRevokeUserCmd represents the admin revoke-user command
+var adminRevokeUserCmd = &cobra.Command{
+	Use:   "revoke-user PROVIDER SUBJECT",
+	Short: "Revoke all sessions of a user",
+	Long: `Revoke all sessions of a user, e.g. "revoke-user github 50764643".
+SUBJECT is the user ID of the provider (the user name for basic auth).`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var res struct {
+			Revoked int `json:"revoked"`
+		}
+		path := "/users/" + url.PathEscape(args[0]) + "/" + url.PathEscape(args[1]) + "/sessions"
+		if err := adminRequest(http.MethodDelete, path, &res); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "revoked: %d sessions\n", res.Revoked)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(adminCmd)
+	adminCmd.AddCommand(adminSessionsCmd)
+	adminCmd.AddCommand(adminRevokeCmd)
+	adminCmd.AddCommand(adminRevokeUserCmd)
+
+	adminCmd.PersistentFlags().StringVarP(&serveConfigPath, "config", "c", "deployment/default.toml", "config directory")
+	adminCmd.PersistentFlags().StringVar(&adminURL, "url", "", "URL of the admin API (default: http://<admin.listen>)")
+	adminSessionsCmd.Flags().StringVar(&adminFilterProvider, "provider", "", "filter by provider (e.g. github)")
+	adminSessionsCmd.Flags().StringVar(&adminFilterSubject, "subject", "", "filter by subject (user ID of the provider)")
+	adminSessionsCmd.Flags().StringVar(&adminFilterIP, "ip", "", "filter by last seen IP address")
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"azuki774/go-authenticator/internal/apikey"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var apikeyOwner string
+var apikeyScopes []string
+var apikeyExpireDays int
+
+func apiKeyStoreLoad() (*apikey.FileStore, error) {
+	if err := configLoad(); err != nil {
+		return nil, err
+	}
+	if serveConfig.APIKeysFile == "" {
+		return nil, fmt.Errorf("api_keys_file is not set in %s", serveConfigPath)
+	}
+	return apikey.NewFileStore(serveConfig.APIKeysFile), nil
+}
+
+// apikeyCmd represents the apikey command
+var apikeyCmd = &cobra.Command{
+	Use:   "apikey",
+	Short: "Manage API keys for non-browser clients",
+}
+
+// apikeyCreateCmd represents the apikey create command
+var apikeyCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a new API key",
+	Long: `Create a new API key and print it. The key is stored hashed,
+so it cannot be shown again.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if apikeyOwner == "" {
+			return fmt.Errorf("--owner is required")
+		}
+		store, err := apiKeyStoreLoad()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		var expiresAt *time.Time
+		if apikeyExpireDays > 0 {
+			t := now.AddDate(0, 0, apikeyExpireDays)
+			expiresAt = &t
+		}
+		token, key, err := store.Create(apikeyOwner, apikeyScopes, expiresAt, now)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "id: %s\n", key.ID)
+		fmt.Fprintf(cmd.OutOrStdout(), "token: %s\n", token)
+		return nil
+	},
+}
+
+// apikeyListCmd represents the apikey list command
+var apikeyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List API keys",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := apiKeyStoreLoad()
+		if err != nil {
+			return err
+		}
+		keys, err := store.List()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tOWNER\tSCOPES\tCREATED\tEXPIRES\tLAST USED\tREVOKED")
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				k.ID, k.Owner, strings.Join(k.Scopes, ","),
+				formatTime(&k.CreatedAt), formatTime(k.ExpiresAt), formatTime(k.LastUsedAt), formatTime(k.RevokedAt),
+			)
+		}
+		return w.Flush()
+	},
+}
+
+// apikeyRevokeCmd represents the apikey revoke command
+var apikeyRevokeCmd = &cobra.Command{
+	Use:   "revoke ID",
+	Short: "Revoke an API key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := apiKeyStoreLoad()
+		if err != nil {
+			return err
+		}
+		if err := store.Revoke(args[0], time.Now()); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "revoked: %s\n", args[0])
+		return nil
+	},
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func init() {
+	rootCmd.AddCommand(apikeyCmd)
+	apikeyCmd.AddCommand(apikeyCreateCmd)
+	apikeyCmd.AddCommand(apikeyListCmd)
+	apikeyCmd.AddCommand(apikeyRevokeCmd)
+
+	apikeyCmd.PersistentFlags().StringVarP(&serveConfigPath, "config", "c", "deployment/default.toml", "config directory")
+	apikeyCreateCmd.Flags().StringVar(&apikeyOwner, "owner", "", "owner of the key (used as the user name in policy and roles)")
+	apikeyCreateCmd.Flags().StringSliceVar(&apikeyScopes, "scope", nil, "scopes of the key")
+	apikeyCreateCmd.Flags().IntVar(&apikeyExpireDays, "expire-days", 90, "days until the key expires (0: never)")
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the config file",
+}
+
+// configValidateCmd represents the config validate command
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the config file",
+	Long: `Load the config file and report errors, such as syntax errors and
+type errors in policy expressions, without starting the server.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := configLoad(); err != nil {
+			return err
+		}
+		if _, err := policyLoad(); err != nil {
+			return err
+		}
+		if _, _, err := networkLoad(); err != nil {
+			return err
+		}
+		if _, err := tlsLoad(); err != nil {
+			return err
+		}
+		if _, err := oidcLoad(); err != nil {
+			return err
+		}
+		if _, err := registryLoad(); err != nil {
+			return err
+		}
+		if _, err := kubernetesLoad(); err != nil {
+			return err
+		}
+		if _, err := ssoLoad(); err != nil {
+			return err
+		}
+		if _, err := cookieLoad(); err != nil {
+			return err
+		}
+		if _, err := cookieKeysLoad(); err != nil {
+			return err
+		}
+		if err := sessionConfigCheck(); err != nil {
+			return err
+		}
+		if err := adminConfigCheck(); err != nil {
+			return err
+		}
+		if err := auditConfigCheck(); err != nil {
+			return err
+		}
+		if _, err := webhooksLoad(); err != nil {
+			return err
+		}
+		if _, err := lockoutLoad(); err != nil {
+			return err
+		}
+		if err := healthConfigCheck(); err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), "config OK")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configValidateCmd)
+
+	configValidateCmd.Flags().StringVarP(&serveConfigPath, "config", "c", "deployment/default.toml", "config directory")
+}
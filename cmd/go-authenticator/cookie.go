@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"azuki774/go-authenticator/internal/cookie"
+	"azuki774/go-authenticator/internal/keyring"
+	"fmt"
+)
+
+type CookieConfig struct {
+	Name     string `toml:"name"`
+	Prefix   string `toml:"prefix"` // __Host-, __Secure- または空
+	Domain   string `toml:"domain"`
+	Path     string `toml:"path"`
+	Secure   *bool  `toml:"secure"`    // 省略時は true
+	SameSite string `toml:"same_site"` // lax (省略時), strict, none
+	Encrypt  bool   `toml:"encrypt"`   // JWE (dir + A256GCM) で暗号化する
+	// JWE の鍵のファイル (1 行に 1 つ base64 の 32 バイトの鍵)。先頭の鍵で暗号化し、残りは復号にのみ使う
+	EncryptionKeyFile string `toml:"encryption_key_file"`
+}
+
+// cookieLoad は JWT を保存する Cookie の属性を読み込む
+// Secure を付けない Cookie は dev_mode のときのみ許可する
+func cookieLoad() (cookie.Config, error) {
+	conf := serveConfig.Cookie
+	c := cookie.Default()
+	c.Secure = true
+
+	if conf.Name != "" {
+		c.Name = conf.Name
+	}
+	switch conf.Prefix {
+	case "", cookie.PrefixHost, cookie.PrefixSecure:
+		c.Name = conf.Prefix + c.Name
+	default:
+		return cookie.Config{}, fmt.Errorf("cookie.prefix: unknown prefix: %s", conf.Prefix)
+	}
+	c.Domain = conf.Domain
+	if conf.Path != "" {
+		c.Path = conf.Path
+	}
+	if conf.Secure != nil {
+		c.Secure = *conf.Secure
+	}
+	if !c.Secure && !serveConfig.DevMode {
+		return cookie.Config{}, fmt.Errorf("cookie.secure = false is allowed only in dev_mode")
+	}
+	sameSite, err := cookie.ParseSameSite(conf.SameSite)
+	if err != nil {
+		return cookie.Config{}, fmt.Errorf("cookie.same_site: %w", err)
+	}
+	c.SameSite = sameSite
+
+	if err := c.Validate(); err != nil {
+		return cookie.Config{}, fmt.Errorf("cookie: %w", err)
+	}
+	if conf.Prefix == cookie.PrefixHost && len(serveConfig.SSO.CookieDomains) > 0 {
+		return cookie.Config{}, fmt.Errorf("cookie: %s prefix cannot be used with sso.cookie_domains", cookie.PrefixHost)
+	}
+	return c, nil
+}
+
+// cookieKeysLoad は Cookie の暗号化の鍵を読み込む。encryption_key_file が空の場合は nil
+// encrypt = false でも鍵があれば、暗号化された Cookie を受け付ける
+func cookieKeysLoad() (*keyring.AEADKeyring, error) {
+	conf := serveConfig.Cookie
+	if conf.EncryptionKeyFile == "" {
+		if conf.Encrypt {
+			return nil, fmt.Errorf("cookie.encryption_key_file is required for encrypt = true")
+		}
+		return nil, nil
+	}
+	keys, err := keyring.LoadAEADFile(conf.EncryptionKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cookie.encryption_key_file: %w", err)
+	}
+	return keys, nil
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"azuki774/go-authenticator/internal/health"
+	"azuki774/go-authenticator/internal/registry"
+	"azuki774/go-authenticator/internal/server"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/oauth2"
+)
+
+type HealthConfig struct {
+	ProbeProviders bool `toml:"probe_providers"` // /readyz で OAuth2 プロバイダの token endpoint に到達できるか確認する
+	ProbeInterval  int  `toml:"probe_interval"`  // sec, probe が成功した結果を使い回す時間
+	Timeout        int  `toml:"timeout"`         // sec, /readyz のチェックを待つ時間
+}
+
+const defaultProbeInterval = 60 * time.Second
+
+// versionInfo は main から SetVersion で渡される
+var versionInfo server.VersionInfo
+
+var healthcheckURL string
+var healthcheckReady bool
+
+// SetVersion はビルド時に -ldflags で埋め込まれた値を設定する
+func SetVersion(version, revision, build string) {
+	versionInfo = server.VersionInfo{Version: version, Revision: revision, Build: build}
+	rootCmd.Version = version
+}
+
+// healthConfigCheck は /readyz の設定を検証する
+func healthConfigCheck() error {
+	conf := serveConfig.Health
+	if conf.ProbeInterval < 0 || conf.Timeout < 0 {
+		return fmt.Errorf("health: probe_interval and timeout must not be negative")
+	}
+	return nil
+}
+
+// readinessLoad は /readyz のチェックを作る
+// config: 起動時に読み込んだ設定, keys: 証明書の有効期限, <provider>: token endpoint への到達性 (probe_providers のとき)
+func readinessLoad(secret string, registryIssuer *registry.Issuer, providers map[string]*oauth2.Config) (*health.Checker, error) {
+	if err := healthConfigCheck(); err != nil {
+		return nil, err
+	}
+	conf := serveConfig.Health
+	c := &health.Checker{}
+	if conf.Timeout > 0 {
+		c.Timeout = time.Duration(conf.Timeout) * time.Second
+	}
+
+	c.Checks = append(c.Checks, health.Check{Name: "config", Func: func(ctx context.Context) error {
+		if serveConfig.IssuerName == "" {
+			return fmt.Errorf("isser_name is not set")
+		}
+		if secret == "" {
+			return fmt.Errorf("HMAC_SECRET is not set")
+		}
+		return nil
+	}})
+
+	certFile, keyFile := serveConfig.TLS.CertFile, serveConfig.TLS.KeyFile
+	c.Checks = append(c.Checks, health.Check{Name: "keys", Func: func(ctx context.Context) error {
+		if certFile != "" {
+			// 証明書の更新で壊れたファイルに置き換わっていないか、期限切れでないかを確認する
+			pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return fmt.Errorf("tls: %w", err)
+			}
+			cert, err := x509.ParseCertificate(pair.Certificate[0])
+			if err != nil {
+				return fmt.Errorf("tls: %w", err)
+			}
+			if err := health.CertValid(cert); err != nil {
+				return fmt.Errorf("tls: %w", err)
+			}
+		}
+		if registryIssuer != nil {
+			if err := health.CertValid(registryIssuer.CertChain[0]); err != nil {
+				return fmt.Errorf("registry: %w", err)
+			}
+		}
+		return nil
+	}})
+
+	if conf.ProbeProviders {
+		interval := defaultProbeInterval
+		if conf.ProbeInterval > 0 {
+			interval = time.Duration(conf.ProbeInterval) * time.Second
+		}
+		names := make([]string, 0, len(providers))
+		for name := range providers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			probe := health.Probe(http.DefaultClient, providers[name].Endpoint.TokenURL)
+			c.Checks = append(c.Checks, health.Check{Name: name, Func: health.Cached(interval, probe)})
+		}
+	}
+	return c, nil
+}
+
+// healthcheckBaseURL は --url、または config の server_port から URL を求める
+func healthcheckBaseURL() (string, error) {
+	if healthcheckURL != "" {
+		return strings.TrimSuffix(healthcheckURL, "/"), nil
+	}
+	if err := configLoad(); err != nil {
+		return "", err
+	}
+	scheme := "http"
+	if serveConfig.TLS.CertFile != "" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://127.0.0.1:%d", scheme, serveConfig.Port), nil
+}
+
+// healthcheckCmd represents the healthcheck command
+var healthcheckCmd = &cobra.Command{
+	Use:   "healthcheck",
+	Short: "Check that the running server is healthy",
+	Long: `Request /healthz (or /readyz with --ready) of the server running on this host
+and exit with a non-zero status unless it returns 200.
+This is for Docker HEALTHCHECK in an image without curl or wget.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		base, err := healthcheckBaseURL()
+		if err != nil {
+			return err
+		}
+		path := "/healthz"
+		if healthcheckReady {
+			path = "/readyz"
+		}
+
+		c := &http.Client{
+			Timeout: 10 * time.Second,
+			// 127.0.0.1 に接続するので、証明書のホスト名は一致しない
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		}
+		resp, err := c.Get(base + path)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s returned %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), strings.TrimSpace(string(body)))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(healthcheckCmd)
+	healthcheckCmd.Flags().StringVarP(&serveConfigPath, "config", "c", "deployment/default.toml", "config directory")
+	healthcheckCmd.Flags().StringVar(&healthcheckURL, "url", "", "server URL (default: http://127.0.0.1:<server_port> from the config)")
+	healthcheckCmd.Flags().BoolVar(&healthcheckReady, "ready", false, "check /readyz instead of /healthz")
+}
@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"azuki774/go-authenticator/internal/policy"
+	"fmt"
+)
+
+type KubernetesConfig struct {
+	TokenReview bool     `toml:"token_review"` // kube-apiserver の webhook token authenticator (/tokenreview) を有効にする
+	AllowCIDRs  []string `toml:"allow_cidrs"`  // kube-apiserver のアドレス。空の場合はすべて許可
+}
+
+func kubernetesLoad() (policy.CIDRList, error) {
+	allow, err := policy.ParseCIDRs(serveConfig.Kubernetes.AllowCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes.allow_cidrs: %w", err)
+	}
+	return allow, nil
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"azuki774/go-authenticator/internal/lockout"
+	"azuki774/go-authenticator/internal/notify"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+type NotifyConfig struct {
+	QueueSize  int             `toml:"queue_size"`  // 送信待ちのイベントの数。超えた分は捨てる
+	MaxRetries *int            `toml:"max_retries"` // 5xx, 429, 通信エラーのときのリトライ回数
+	Webhooks   []WebhookConfig `toml:"webhooks"`
+}
+
+type WebhookConfig struct {
+	Name        string   `toml:"name"`
+	URL         string   `toml:"url"`
+	Format      string   `toml:"format"`       // slack (省略時), template
+	Template    string   `toml:"template"`     // format = template のときの本文 (text/template)
+	ContentType string   `toml:"content_type"` // 省略時は application/json
+	Secret      string   `toml:"secret"`       // 指定すると X-Authenticator-Signature-256 ヘッダで本文に署名する
+	Events      []string `toml:"events"`       // 通知するイベントの種類。空の場合はすべて
+}
+
+type LockoutConfig struct {
+	MaxFailures int `toml:"max_failures"` // 0 の場合はロックしない
+	Window      int `toml:"window"`       // sec, この間の失敗を数える
+	Duration    int `toml:"duration"`     // sec, ロックする時間
+}
+
+// webhooksLoad は通知先の webhook を読み込む
+func webhooksLoad() ([]notify.Webhook, error) {
+	conf := serveConfig.Notify
+	if conf.QueueSize < 0 {
+		return nil, fmt.Errorf("notify.queue_size must not be negative")
+	}
+	if conf.MaxRetries != nil && *conf.MaxRetries < 0 {
+		return nil, fmt.Errorf("notify.max_retries must not be negative")
+	}
+
+	var webhooks []notify.Webhook
+	for i, c := range conf.Webhooks {
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("notify.webhooks %s: invalid url: %s", name, c.URL)
+		}
+		for _, typ := range c.Events {
+			switch typ {
+			case notify.TypeLoginNewIP, notify.TypeLoginLockout, notify.TypeLoginNotAllowed:
+			default:
+				return nil, fmt.Errorf("notify.webhooks %s: unknown event: %s", name, typ)
+			}
+		}
+		w := notify.Webhook{Name: name, URL: c.URL, Format: c.Format, ContentType: c.ContentType, Secret: c.Secret, Events: c.Events}
+		switch c.Format {
+		case "", notify.FormatSlack:
+			w.Format = notify.FormatSlack
+		case notify.FormatTemplate:
+			if c.Template == "" {
+				return nil, fmt.Errorf("notify.webhooks %s: template is required for format = template", name)
+			}
+			w.Template, err = notify.ParseTemplate(name, c.Template)
+			if err != nil {
+				return nil, fmt.Errorf("notify.webhooks %s: %w", name, err)
+			}
+		default:
+			return nil, fmt.Errorf("notify.webhooks %s: unknown format: %s", name, c.Format)
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, nil
+}
+
+// notifierLoad は webhook を送信する goroutine を起動する。webhook がない場合は nil
+func notifierLoad() (*notify.Notifier, error) {
+	webhooks, err := webhooksLoad()
+	if err != nil || len(webhooks) == 0 {
+		return nil, err
+	}
+	n := notify.NewNotifier(webhooks, serveConfig.Notify.QueueSize)
+	if serveConfig.Notify.MaxRetries != nil {
+		n.MaxRetries = *serveConfig.Notify.MaxRetries
+	}
+	return n, nil
+}
+
+// lockoutLoad は basic auth のロックアウトを読み込む。max_failures が 0 の場合は nil
+func lockoutLoad() (*lockout.Limiter, error) {
+	conf := serveConfig.Lockout
+	if conf.MaxFailures < 0 || conf.Window < 0 || conf.Duration < 0 {
+		return nil, fmt.Errorf("lockout: max_failures, window and duration must not be negative")
+	}
+	if conf.MaxFailures == 0 {
+		return nil, nil
+	}
+	window, duration := lockout.DefaultWindow, lockout.DefaultDuration
+	if conf.Window > 0 {
+		window = time.Duration(conf.Window) * time.Second
+	}
+	if conf.Duration > 0 {
+		duration = time.Duration(conf.Duration) * time.Second
+	}
+	return lockout.New(conf.MaxFailures, window, duration), nil
+}
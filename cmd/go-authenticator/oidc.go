@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"azuki774/go-authenticator/internal/keyring"
+	"azuki774/go-authenticator/internal/oidc"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type OIDCConfig struct {
+	Issuer         string             `toml:"issuer"`           // e.g. https://auth.example.com
+	SigningKeyFile string             `toml:"signing_key_file"` // RSA 秘密鍵 (PEM)。空の場合は起動ごとに生成する
+	LoginURL       string             `toml:"login_url"`        // 未ログインのときに遷移する先
+	TokenLifeTime  int                `toml:"token_lifetime"`   // sec
+	Clients        []OIDCClientConfig `toml:"clients"`
+}
+
+type OIDCClientConfig struct {
+	ClientID     string   `toml:"client_id"`
+	ClientSecret string   `toml:"client_secret"` // bcrypt のハッシュ。空の場合は public client
+	Name         string   `toml:"name"`
+	RedirectURIs []string `toml:"redirect_uris"`
+	GrantTypes   []string `toml:"grant_types"` // 省略時は authorization_code のみ
+	Scopes       []string `toml:"scopes"`      // client_credentials で要求できる scope
+	Audiences    []string `toml:"audiences"`   // client_credentials で要求できる宛先
+}
+
+// config には短い名前 (device_code) と正式な名前のどちらでも書ける
+var oidcGrantTypes = map[string]string{
+	"authorization_code":     oidc.GrantTypeAuthorizationCode,
+	"device_code":            oidc.GrantTypeDeviceCode,
+	oidc.GrantTypeDeviceCode: oidc.GrantTypeDeviceCode,
+	"client_credentials":     oidc.GrantTypeClientCredentials,
+}
+
+// oidcLoad は OpenID Connect Provider の設定を読み込む。クライアントが登録されていなければ nil
+func oidcLoad() (*oidc.Provider, error) {
+	conf := serveConfig.OIDC
+	if len(conf.Clients) == 0 {
+		return nil, nil
+	}
+	u, err := url.Parse(conf.Issuer)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("oidc: issuer must be an absolute URL: %q", conf.Issuer)
+	}
+
+	var clients []oidc.Client
+	seen := make(map[string]bool)
+	for i, c := range conf.Clients {
+		if c.ClientID == "" {
+			return nil, fmt.Errorf("oidc.clients[%d]: client_id is required", i)
+		}
+		if seen[c.ClientID] {
+			return nil, fmt.Errorf("oidc.clients[%d]: duplicated client_id: %s", i, c.ClientID)
+		}
+		seen[c.ClientID] = true
+		grantTypes := []string{oidc.GrantTypeAuthorizationCode}
+		if len(c.GrantTypes) > 0 {
+			grantTypes = nil
+			for _, g := range c.GrantTypes {
+				full, ok := oidcGrantTypes[g]
+				if !ok {
+					return nil, fmt.Errorf("oidc.clients[%d]: unknown grant_type: %s", i, g)
+				}
+				grantTypes = append(grantTypes, full)
+			}
+		}
+		if slices.Contains(grantTypes, oidc.GrantTypeAuthorizationCode) && len(c.RedirectURIs) == 0 {
+			return nil, fmt.Errorf("oidc.clients[%d]: redirect_uris is required", i)
+		}
+		if slices.Contains(grantTypes, oidc.GrantTypeClientCredentials) {
+			if c.ClientSecret == "" {
+				return nil, fmt.Errorf("oidc.clients[%d]: client_secret is required for client_credentials", i)
+			}
+			if len(c.Audiences) == 0 {
+				return nil, fmt.Errorf("oidc.clients[%d]: audiences is required for client_credentials", i)
+			}
+		}
+		clients = append(clients, oidc.Client{
+			ID:           c.ClientID,
+			Name:         c.Name,
+			SecretHash:   c.ClientSecret,
+			RedirectURIs: c.RedirectURIs,
+			GrantTypes:   grantTypes,
+			Scopes:       c.Scopes,
+			Audiences:    c.Audiences,
+		})
+	}
+
+	var keys *keyring.Keyring
+	if conf.SigningKeyFile != "" {
+		keys, err = keyring.LoadFile(conf.SigningKeyFile)
+	} else {
+		zap.L().Warn("oidc signing_key_file is not set, generate a temporary key")
+		keys, err = keyring.Generate()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("oidc: %w", err)
+	}
+
+	p := oidc.NewProvider(conf.Issuer, keys, clients)
+	if conf.TokenLifeTime > 0 {
+		p.TokenLife = time.Duration(conf.TokenLifeTime) * time.Second
+	}
+	return p, nil
+}
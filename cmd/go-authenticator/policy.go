@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/policy"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type PolicyConfig struct {
+	Default string             `toml:"default"` // allow or deny (default: allow)
+	Rules   []PolicyRuleConfig `toml:"rules"`
+}
+
+type PolicyRuleConfig struct {
+	Host      string   `toml:"host"`
+	Path      string   `toml:"path"`
+	Users     []string `toml:"users"`
+	Groups    []string `toml:"groups"`
+	Roles     []string `toml:"roles"`
+	Providers []string `toml:"providers"`
+	Expr      string   `toml:"expr"`     // CEL
+	Audience  string   `toml:"audience"` // client_credentials のトークンに要求する宛先
+
+	AllowCIDRs []string `toml:"allow_cidrs"`
+	DenyCIDRs  []string `toml:"deny_cidrs"`
+}
+
+type NetworkConfig struct {
+	Allow  []string       `toml:"allow"` // 空の場合はすべて許可
+	Deny   []string       `toml:"deny"`
+	Bypass []BypassConfig `toml:"bypass"`
+}
+
+// BypassConfig は CIDRs からのアクセスをログインなしで許可する設定
+// principal は provider = "network", name = Name として扱われる
+type BypassConfig struct {
+	CIDRs  []string `toml:"cidrs"`
+	Name   string   `toml:"name"`
+	Groups []string `toml:"groups"`
+}
+
+type RoleConfig struct {
+	Name        string   `toml:"name"`
+	Users       []string `toml:"users"`        // e.g. basic:user, github:50764643
+	GitHubTeams []string `toml:"github_teams"` // e.g. myorg/infra
+	Groups      []string `toml:"groups"`       // e.g. gitlab:infra/sre, gitea:infra
+}
+
+func rolesLoad() (policy.Roles, error) {
+	var roles policy.Roles
+	for _, r := range serveConfig.Roles {
+		roles = append(roles, policy.RoleMapping{
+			Role:        r.Name,
+			Users:       r.Users,
+			GitHubTeams: r.GitHubTeams,
+			Groups:      r.Groups,
+		})
+	}
+	if err := roles.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid roles: %w", err)
+	}
+	return roles, nil
+}
+
+func policyLoad() (*policy.Policy, error) {
+	p := &policy.Policy{Default: serveConfig.Policy.Default}
+	if p.Default == "" {
+		p.Default = policy.ActionAllow
+	}
+	for i, r := range serveConfig.Policy.Rules {
+		rule := policy.Rule{
+			Host:      r.Host,
+			Path:      r.Path,
+			Users:     r.Users,
+			Groups:    r.Groups,
+			Roles:     r.Roles,
+			Providers: r.Providers,
+			Audience:  r.Audience,
+		}
+		var err error
+		if rule.AllowCIDRs, err = policy.ParseCIDRs(r.AllowCIDRs); err != nil {
+			return nil, fmt.Errorf("invalid allow_cidrs in policy rule #%d: %w", i, err)
+		}
+		if rule.DenyCIDRs, err = policy.ParseCIDRs(r.DenyCIDRs); err != nil {
+			return nil, fmt.Errorf("invalid deny_cidrs in policy rule #%d: %w", i, err)
+		}
+		if r.Expr != "" {
+			expr, err := policy.CompileExpr(r.Expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid expr in policy rule #%d: %w", i, err)
+			}
+			rule.Expr = expr
+		}
+		p.Rules = append(p.Rules, rule)
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func networkLoad() (trustedProxies policy.CIDRList, network *policy.NetworkPolicy, err error) {
+	trustedProxies, err = policy.ParseCIDRs(serveConfig.TrustedProxies)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid trusted_proxies: %w", err)
+	}
+
+	network = &policy.NetworkPolicy{}
+	if network.Allow, err = policy.ParseCIDRs(serveConfig.Network.Allow); err != nil {
+		return nil, nil, fmt.Errorf("invalid network.allow: %w", err)
+	}
+	if network.Deny, err = policy.ParseCIDRs(serveConfig.Network.Deny); err != nil {
+		return nil, nil, fmt.Errorf("invalid network.deny: %w", err)
+	}
+
+	roles, err := rolesLoad()
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, b := range serveConfig.Network.Bypass {
+		cidrs, err := policy.ParseCIDRs(b.CIDRs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid cidrs in network.bypass #%d: %w", i, err)
+		}
+		if b.Name == "" {
+			return nil, nil, fmt.Errorf("name is required in network.bypass #%d", i)
+		}
+		principal := model.Principal{Provider: "network", Subject: b.Name, Name: b.Name, Groups: b.Groups}
+		principal.Roles = roles.Resolve(principal)
+		network.Bypass = append(network.Bypass, policy.Bypass{CIDRs: cidrs, Principal: principal})
+	}
+	return trustedProxies, network, nil
+}
+
+var policyTestPrincipal model.Principal
+var policyTestSourceIP string
+
+// policyCmd represents the policy command
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Inspect access policies",
+}
+
+// policyTestCmd represents the policy test command
+var policyTestCmd = &cobra.Command{
+	Use:   "test URL",
+	Short: "Check whether a user can reach the URL",
+	Long: `Evaluate the access policy in the config file for the given user and URL.
+For example:
+
+  go-authenticator policy test -c config.toml --provider github --user octocat https://grafana.example.com/admin/`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := configLoad(); err != nil {
+			return err
+		}
+		p, err := policyLoad()
+		if err != nil {
+			return err
+		}
+
+		u, err := url.Parse(args[0])
+		if err != nil {
+			return err
+		}
+		path := u.Path
+		if path == "" {
+			path = "/"
+		}
+
+		principal := policyTestPrincipal
+		principal.Subject = principal.Name
+		roles, err := rolesLoad()
+		if err != nil {
+			return err
+		}
+		principal.Roles = roles.Resolve(principal)
+		if len(principal.Roles) > 0 {
+			fmt.Fprintf(cmd.OutOrStdout(), "roles: %s\n", strings.Join(principal.Roles, ","))
+		}
+		decision := p.Evaluate(policy.Request{
+			Principal: principal,
+			Host:      u.Host,
+			Path:      path,
+			Headers:   http.Header{},
+			SourceIP:  policyTestSourceIP,
+		})
+		fmt.Fprintln(cmd.OutOrStdout(), decision.String())
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(policyCmd)
+	policyCmd.AddCommand(policyTestCmd)
+
+	policyTestCmd.Flags().StringVarP(&serveConfigPath, "config", "c", "deployment/default.toml", "config directory")
+	policyTestCmd.Flags().StringVar(&policyTestPrincipal.Provider, "provider", "", "provider of the user (basic, github, google, gitlab, gitea)")
+	policyTestCmd.Flags().StringVar(&policyTestPrincipal.Name, "user", "", "username or ID of the user")
+	policyTestCmd.Flags().StringVar(&policyTestPrincipal.Email, "email", "", "email of the user")
+	policyTestCmd.Flags().StringSliceVar(&policyTestPrincipal.Groups, "group", nil, "groups of the user")
+	policyTestCmd.Flags().StringVar(&policyTestSourceIP, "source-ip", "", "source IP address of the request")
+	policyTestCmd.Flags().StringSliceVar(&policyTestPrincipal.Audience, "audience", nil, "audience of the token (client_credentials)")
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"azuki774/go-authenticator/internal/keyring"
+	"azuki774/go-authenticator/internal/registry"
+	"fmt"
+	"time"
+)
+
+type RegistryConfig struct {
+	Service       string              `toml:"service"`   // registry の auth.token.service (e.g. registry.example.com)
+	Issuer        string              `toml:"issuer"`    // registry の auth.token.issuer
+	CertFile      string              `toml:"cert_file"` // 署名鍵の証明書 (中間証明書を続けて書く)。registry の rootcertbundle で検証される
+	KeyFile       string              `toml:"key_file"`  // RSA 秘密鍵 (PEM)
+	TokenLifeTime int                 `toml:"token_lifetime"`
+	ACL           []RegistryACLConfig `toml:"acl"`
+}
+
+type RegistryACLConfig struct {
+	Users        []string `toml:"users"` // e.g. basic:user, apikey:ci
+	Roles        []string `toml:"roles"`
+	Repositories []string `toml:"repositories"` // e.g. myteam/app, myteam/*, *
+	Actions      []string `toml:"actions"`      // pull, push, delete, *
+}
+
+var registryActions = map[string]bool{"pull": true, "push": true, "delete": true, "*": true}
+
+// registryLoad は Docker registry の token endpoint の設定を読み込む。service が空の場合は nil
+func registryLoad() (*registry.Issuer, error) {
+	conf := serveConfig.Registry
+	if conf.Service == "" {
+		return nil, nil
+	}
+	if conf.Issuer == "" || conf.CertFile == "" || conf.KeyFile == "" {
+		return nil, fmt.Errorf("registry: issuer, cert_file and key_file are required")
+	}
+
+	var rules []registry.Rule
+	for i, c := range conf.ACL {
+		if len(c.Repositories) == 0 || len(c.Actions) == 0 {
+			return nil, fmt.Errorf("registry.acl[%d]: repositories and actions are required", i)
+		}
+		for _, a := range c.Actions {
+			if !registryActions[a] {
+				return nil, fmt.Errorf("registry.acl[%d]: unknown action: %s", i, a)
+			}
+		}
+		rules = append(rules, registry.Rule{
+			Users:        c.Users,
+			Roles:        c.Roles,
+			Repositories: c.Repositories,
+			Actions:      c.Actions,
+		})
+	}
+
+	keys, err := keyring.LoadFile(conf.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("registry: %w", err)
+	}
+	chain, err := registry.LoadCertChain(conf.CertFile)
+	if err != nil {
+		return nil, fmt.Errorf("registry: %w", err)
+	}
+	issuer, err := registry.NewIssuer(conf.Service, conf.Issuer, keys.Signing().Private, chain, rules)
+	if err != nil {
+		return nil, err
+	}
+	if conf.TokenLifeTime > 0 {
+		issuer.TokenLife = time.Duration(conf.TokenLifeTime) * time.Second
+	}
+	return issuer, nil
+}
@@ -1,16 +1,23 @@
 package cmd
 
 import (
+	"azuki774/go-authenticator/internal/apikey"
 	"azuki774/go-authenticator/internal/authenticator"
 	"azuki774/go-authenticator/internal/client"
+	"azuki774/go-authenticator/internal/notify"
+	"azuki774/go-authenticator/internal/revocation"
 	"azuki774/go-authenticator/internal/server"
+	"azuki774/go-authenticator/internal/session"
+	"azuki774/go-authenticator/internal/tokenreview"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
+	"golang.org/x/oauth2"
 )
 
 type ServeConfig struct {
@@ -20,11 +27,61 @@ type ServeConfig struct {
 	BasicAuthList     []string `toml:"basicauth"`
 	TokenLifeTime     int      `toml:"token_lifetime"`
 	GitHubAllowIDList []int    `toml:"github_allow_id"`
+	GitHubBaseURL     string   `toml:"github_base_url"` // GitHub Enterprise Server の場合は https://ghe.example.com
+	GitHubAPIURL      string   `toml:"github_api_url"`  // GitHub Enterprise Server の場合は https://ghe.example.com/api/v3
+	GitHubTimeout     int      `toml:"github_timeout"`  // sec
+	GitHubMaxRetries  *int     `toml:"github_max_retries"`
+	GitHubCacheTTL    *int     `toml:"github_cache_ttl"` // sec, 0 でキャッシュしない
+	TrustedProxies    []string `toml:"trusted_proxies"`  // X-Forwarded-For を信用するプロキシの CIDR
+	APIKeysFile       string   `toml:"api_keys_file"`    // API キーの保存先。空の場合は API キーを使わない
+	DevMode           bool     `toml:"dev_mode"`         // 開発用。Secure を付けない Cookie を許可する
+
+	Google GoogleConfig `toml:"google"`
+	GitLab ForgeConfig  `toml:"gitlab"`
+	Gitea  ForgeConfig  `toml:"gitea"`
+
+	Policy  PolicyConfig  `toml:"policy"`
+	Roles   []RoleConfig  `toml:"roles"`
+	Network NetworkConfig `toml:"network"`
+
+	TLS  TLSConfig  `toml:"tls"`
+	MTLS MTLSConfig `toml:"mtls"`
+
+	OIDC     OIDCConfig     `toml:"oidc"`
+	Registry RegistryConfig `toml:"registry"`
+
+	Kubernetes KubernetesConfig `toml:"kubernetes"`
+
+	SSO     SSOConfig     `toml:"sso"`
+	Cookie  CookieConfig  `toml:"cookie"`
+	Session SessionConfig `toml:"session"`
+	Admin   AdminConfig   `toml:"admin"`
+	Audit   AuditConfig   `toml:"audit"`
+	Notify  NotifyConfig  `toml:"notify"`
+	Lockout LockoutConfig `toml:"lockout"`
+	Health  HealthConfig  `toml:"health"`
+}
+
+type GoogleConfig struct {
+	RedirectURL string   `toml:"redirect_url"`
+	AllowDomain []string `toml:"allow_domain"` // Google Workspace のドメイン (hd claim)
+	AllowEmail  []string `toml:"allow_email"`
+}
+
+// ForgeConfig は GitLab, Gitea/Forgejo 共通の設定
+type ForgeConfig struct {
+	BaseURL       string   `toml:"base_url"`
+	RedirectURL   string   `toml:"redirect_url"`
+	AllowID       []int    `toml:"allow_id"`
+	AllowUsername []string `toml:"allow_username"`
+	AllowGroup    []string `toml:"allow_group"` // GitLab: グループの full path, Gitea: 組織名
 }
 
 var serveConfig ServeConfig
 var basicAuthMap map[string]string
 var allowGitHubList map[int]bool
+var allowGoogleDomain map[string]bool
+var allowGoogleEmail map[string]bool
 var serveConfigPath string
 
 func configLoad() (err error) {
@@ -51,6 +108,35 @@ func allowGitHubListload() {
 	}
 }
 
+func allowGoogleListload() {
+	allowGoogleDomain = make(map[string]bool)
+	for _, v := range serveConfig.Google.AllowDomain {
+		allowGoogleDomain[strings.ToLower(v)] = true
+	}
+	allowGoogleEmail = make(map[string]bool)
+	for _, v := range serveConfig.Google.AllowEmail {
+		allowGoogleEmail[strings.ToLower(v)] = true
+	}
+}
+
+func allowListLoad(conf ForgeConfig) authenticator.AllowList {
+	l := authenticator.AllowList{
+		IDs:       make(map[int]bool),
+		Usernames: make(map[string]bool),
+		Groups:    make(map[string]bool),
+	}
+	for _, v := range conf.AllowID {
+		l.IDs[v] = true
+	}
+	for _, v := range conf.AllowUsername {
+		l.Usernames[v] = true
+	}
+	for _, v := range conf.AllowGroup {
+		l.Groups[v] = true
+	}
+	return l
+}
+
 // serveCmd represents the serve command
 var serveCmd = &cobra.Command{
 	Use:   "serve",
@@ -75,6 +161,32 @@ to quickly create a Cobra application.`,
 			zap.Ints("github allow list", serveConfig.GitHubAllowIDList),
 		)
 
+		auditLogger, err := auditLoad()
+		if err != nil {
+			zap.L().Error("audit config error", zap.Error(err))
+			return err
+		}
+		if auditLogger != nil {
+			defer auditLogger.Close()
+			auditLogger.Log(configLoadEvent())
+			zap.L().Info("audit log enabled", zap.String("sink", serveConfig.Audit.Sink))
+		}
+
+		notifier, err := notifierLoad()
+		if err != nil {
+			zap.L().Error("notify config error", zap.Error(err))
+			return err
+		}
+		if notifier != nil {
+			defer notifier.Close()
+			zap.L().Info("webhook notification enabled", zap.Int("webhooks", len(notifier.Webhooks)))
+		}
+		loginLockout, err := lockoutLoad()
+		if err != nil {
+			zap.L().Error("lockout config error", zap.Error(err))
+			return err
+		}
+
 		// get secret
 		secret := os.Getenv("HMAC_SECRET")
 		if secret == "" {
@@ -88,8 +200,123 @@ to quickly create a Cobra application.`,
 		allowGitHubListload()
 		zap.L().Info("allow github list loaded")
 
+		allowGoogleListload()
+		zap.L().Info("allow google list loaded")
+
+		accessPolicy, err := policyLoad()
+		if err != nil {
+			zap.L().Error("policy error", zap.Error(err))
+			return err
+		}
+		zap.L().Info("policy loaded", zap.String("default", accessPolicy.Default), zap.Int("rules", len(accessPolicy.Rules)))
+
+		roles, err := rolesLoad()
+		if err != nil {
+			zap.L().Error("roles config error", zap.Error(err))
+			return err
+		}
+		zap.L().Info("roles loaded", zap.Int("roles", len(roles)))
+
+		trustedProxies, network, err := networkLoad()
+		if err != nil {
+			zap.L().Error("network config error", zap.Error(err))
+			return err
+		}
+		zap.L().Info("network loaded", zap.Strings("trusted_proxies", serveConfig.TrustedProxies), zap.Int("bypass", len(network.Bypass)))
+
+		clientCAs, err := tlsLoad()
+		if err != nil {
+			zap.L().Error("tls config error", zap.Error(err))
+			return err
+		}
+		zap.L().Info("tls loaded", zap.Bool("tls", serveConfig.TLS.CertFile != ""), zap.Bool("client_ca", clientCAs != nil), zap.String("client_cert_header", serveConfig.MTLS.Header))
+
+		oidcProvider, err := oidcLoad()
+		if err != nil {
+			zap.L().Error("oidc config error", zap.Error(err))
+			return err
+		}
+
+		registryIssuer, err := registryLoad()
+		if err != nil {
+			zap.L().Error("registry config error", zap.Error(err))
+			return err
+		}
+
+		tokenReviewAllow, err := kubernetesLoad()
+		if err != nil {
+			zap.L().Error("kubernetes config error", zap.Error(err))
+			return err
+		}
+
+		sessionCookie, err := cookieLoad()
+		if err != nil {
+			zap.L().Error("cookie config error", zap.Error(err))
+			return err
+		}
+		cookieKeys, err := cookieKeysLoad()
+		if err != nil {
+			zap.L().Error("cookie config error", zap.Error(err))
+			return err
+		}
+		if serveConfig.DevMode {
+			zap.L().Warn("dev_mode is enabled, do not use in production", zap.Bool("cookie_secure", sessionCookie.Secure))
+		}
+
+		ssoHandoff, err := ssoLoad()
+		if err != nil {
+			zap.L().Error("sso config error", zap.Error(err))
+			return err
+		}
+
+		sessions, err := sessionLoad()
+		if err != nil {
+			zap.L().Error("session config error", zap.Error(err))
+			return err
+		}
+
 		// set github client
-		ghClient := client.NewClientGitHub()
+		ghClient := client.NewClientGitHub(serveConfig.GitHubBaseURL, serveConfig.GitHubAPIURL)
+		if serveConfig.GitHubTimeout > 0 {
+			ghClient.HTTPClient.Timeout = time.Duration(serveConfig.GitHubTimeout) * time.Second
+		}
+		if serveConfig.GitHubMaxRetries != nil {
+			ghClient.MaxRetries = *serveConfig.GitHubMaxRetries
+		}
+		if serveConfig.GitHubCacheTTL != nil {
+			ghClient.SetCacheTTL(time.Duration(*serveConfig.GitHubCacheTTL) * time.Second)
+		}
+		if roles.NeedGitHubTeams() || accessPolicy.NeedGroups("github") {
+			// チームの取得には read:org が必要
+			ghClient.AuthConf.Scopes = append(ghClient.AuthConf.Scopes, "read:org")
+		}
+		zap.L().Info("github endpoint", zap.String("auth_url", ghClient.AuthConf.Endpoint.AuthURL), zap.String("api_url", ghClient.APIURL))
+
+		// set google client (GOOGLE_CLIENT_ID が設定されているときのみ有効)
+		oauthConfigs := make(map[string]*oauth2.Config)
+		var googleClient authenticator.ClientGoogle
+		if os.Getenv("GOOGLE_CLIENT_ID") != "" {
+			c := client.NewClientGoogle(serveConfig.Google.RedirectURL)
+			googleClient = c
+			oauthConfigs["google"] = c.AuthConf
+			zap.L().Info("google login enabled")
+		}
+
+		// set gitlab, gitea client (各 CLIENT_ID が設定されているときのみ有効)
+		var gitlabClient authenticator.ClientGitLab
+		if os.Getenv("GITLAB_CLIENT_ID") != "" {
+			c := client.NewClientGitLab(serveConfig.GitLab.BaseURL, serveConfig.GitLab.RedirectURL)
+			gitlabClient = c
+			oauthConfigs["gitlab"] = c.AuthConf
+			zap.L().Info("gitlab login enabled", zap.String("base_url", c.BaseURL))
+		}
+		var giteaClient authenticator.ClientGitea
+		if os.Getenv("GITEA_CLIENT_ID") != "" {
+			c := client.NewClientGitea(serveConfig.Gitea.BaseURL, serveConfig.Gitea.RedirectURL)
+			giteaClient = c
+			oauthConfigs["gitea"] = c.AuthConf
+			zap.L().Info("gitea login enabled", zap.String("base_url", c.BaseURL))
+		}
 
 		// set authenticator
 		authenticator := authenticator.Authenticator{
@@ -99,14 +326,140 @@ to quickly create a Cobra application.`,
 
 			AllowGitHubList: allowGitHubList,
 			ClientGitHub:    ghClient,
+
+			AllowGoogleDomain: allowGoogleDomain,
+			AllowGoogleEmail:  allowGoogleEmail,
+			ClientGoogle:      googleClient,
+
+			AllowGitLab:  allowListLoad(serveConfig.GitLab),
+			ClientGitLab: gitlabClient,
+			AllowGitea:   allowListLoad(serveConfig.Gitea),
+			ClientGitea:  giteaClient,
+
+			Roles:  roles,
+			Policy: accessPolicy,
+
+			AllowClientCert: certAllowListLoad(),
+
+			Revocations: revocation.NewMemoryList(),
+
+			Cookie:        sessionCookie,
+			EncryptCookie: serveConfig.Cookie.Encrypt,
+			CookieKeys:    cookieKeys,
+		}
+		if serveConfig.APIKeysFile != "" {
+			authenticator.APIKeys = apikey.NewFileStore(serveConfig.APIKeysFile)
+			zap.L().Info("api key enabled", zap.String("api_keys_file", serveConfig.APIKeysFile))
+		}
+		cookieLife := serveConfig.TokenLifeTime
+		if sessions != nil {
+			authenticator.Sessions = sessions
+			// セッションの期限はサーバ側で管理するので、Cookie は絶対タイムアウトまで保つ
+			cookieLife = int(sessions.AbsoluteTimeout.Seconds())
+			zap.L().Info("server-side session enabled", zap.String("store", serveConfig.Session.Store), zap.Duration("idle_timeout", sessions.IdleTimeout), zap.Duration("absolute_timeout", sessions.AbsoluteTimeout))
+		}
+
+		var adminToken string
+		if err := adminConfigCheck(); err != nil {
+			zap.L().Error("admin config error", zap.Error(err))
+			return err
+		}
+		if serveConfig.Admin.Listen != "" {
+			adminToken, err = adminTokenLoad()
+			if err != nil {
+				zap.L().Error("admin config error", zap.Error(err))
+				return err
+			}
+			if sessions == nil {
+				// サーバ側のセッションを使わない場合は、発行した JWT を jti で記録して一覧・失効できるようにする
+				authenticator.Tokens = session.NewTracker(session.NewMemoryStore())
+			}
 		}
 
 		server := server.Server{
 			Port:          serveConfig.Port,
 			Authenticator: &authenticator,
-			CookieLife:    serveConfig.TokenLifeTime,
+			CookieLife:    cookieLife,
+			Cookie:        sessionCookie,
 			BasePath:      "/",
+			OAuthConfigs:  oauthConfigs,
+
+			GitHubAuthorizeURL: ghClient.AuthConf.Endpoint.AuthURL,
+			GitHubScope:        strings.Join(ghClient.AuthConf.Scopes, " "),
+			Policy:             accessPolicy,
+			TrustedProxies:     trustedProxies,
+			Network:            network,
+
+			TLSCertFile:      serveConfig.TLS.CertFile,
+			TLSKeyFile:       serveConfig.TLS.KeyFile,
+			ClientCAs:        clientCAs,
+			ClientCertHeader: serveConfig.MTLS.Header,
+		}
+		if oidcProvider != nil {
+			oidcProvider.JWTIssuer = &authenticator
+			server.OIDC = oidcProvider
+			server.OIDCLoginURL = serveConfig.OIDC.LoginURL
+			if server.OIDCLoginURL == "" {
+				server.OIDCLoginURL = "/login_page"
+			}
+			zap.L().Info("oidc provider enabled", zap.String("issuer", oidcProvider.Issuer), zap.Int("clients", len(oidcProvider.Clients)))
+		}
+
+		if registryIssuer != nil {
+			server.Registry = registryIssuer
+			zap.L().Info("registry token endpoint enabled", zap.String("service", registryIssuer.Service), zap.Int("acl", len(registryIssuer.Rules)))
+		}
+
+		if serveConfig.Kubernetes.TokenReview {
+			server.TokenReviewer = &tokenreview.Reviewer{Verifier: &authenticator}
+			server.TokenReviewAllow = tokenReviewAllow
+			zap.L().Info("kubernetes TokenReview webhook enabled", zap.Strings("allow_cidrs", serveConfig.Kubernetes.AllowCIDRs))
+		}
+
+		if ssoHandoff != nil {
+			server.SSO = ssoHandoff
+			server.SSOURL = strings.TrimSuffix(serveConfig.SSO.URL, "/")
+			server.SSOLoginURL = serveConfig.SSO.LoginURL
+			if server.SSOLoginURL == "" {
+				server.SSOLoginURL = "/login_page"
+			}
+			zap.L().Info("cross-domain sso enabled", zap.Strings("cookie_domains", ssoHandoff.Domains), zap.String("url", server.SSOURL))
+		}
+
+		if serveConfig.Admin.Listen != "" {
+			server.Admin = &authenticator
+			server.AdminAddr = serveConfig.Admin.Listen
+			server.AdminToken = adminToken
+			zap.L().Info("admin api enabled", zap.String("listen", serveConfig.Admin.Listen))
+		}
+
+		if auditLogger != nil {
+			server.Audit = auditLogger
+		}
+
+		if notifier != nil {
+			authenticator.Notifier = notifier
+			server.Notifier = notifier
+			server.KnownIPs = notify.NewKnownIPs()
+		}
+		if loginLockout != nil {
+			server.Lockout = loginLockout
+			zap.L().Info("basic auth lockout enabled", zap.Int("max_failures", loginLockout.MaxFailures), zap.Duration("window", loginLockout.Window), zap.Duration("duration", loginLockout.Duration))
+		}
+
+		// /readyz で到達性を確認する OAuth2 プロバイダ
+		providers := map[string]*oauth2.Config{"github": ghClient.AuthConf}
+		for name, c := range oauthConfigs {
+			providers[name] = c
+		}
+		readiness, err := readinessLoad(secret, registryIssuer, providers)
+		if err != nil {
+			zap.L().Error("health config error", zap.Error(err))
+			return err
 		}
+		server.Readiness = readiness
+		server.Version = versionInfo
+		zap.L().Info("readiness checks loaded", zap.Int("checks", len(readiness.Checks)), zap.String("version", versionInfo.Version), zap.String("revision", versionInfo.Revision))
 
 		if err := server.Serve(); err != nil {
 			return err
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"azuki774/go-authenticator/internal/session"
+	"fmt"
+	"os"
+	"time"
+)
+
+type SessionConfig struct {
+	Store           string `toml:"store"`          // memory, bolt, redis。空の場合はセッションを使わず Cookie に JWT を入れる
+	BoltPath        string `toml:"bolt_path"`      // store = bolt のときのファイル
+	RedisAddr       string `toml:"redis_addr"`     // store = redis のときの host:port
+	RedisPassword   string `toml:"redis_password"` // REDIS_PASSWORD が設定されていればそちらを使う
+	RedisDB         int    `toml:"redis_db"`
+	IdleTimeout     int    `toml:"idle_timeout"`     // sec
+	AbsoluteTimeout int    `toml:"absolute_timeout"` // sec
+}
+
+// sessionConfigCheck はセッションの設定を検証する。ファイルや Redis には接続しない
+func sessionConfigCheck() error {
+	conf := serveConfig.Session
+	switch conf.Store {
+	case "", "memory":
+	case "bolt":
+		if conf.BoltPath == "" {
+			return fmt.Errorf("session: bolt_path is required for store = bolt")
+		}
+	case "redis":
+		if conf.RedisAddr == "" {
+			return fmt.Errorf("session: redis_addr is required for store = redis")
+		}
+	default:
+		return fmt.Errorf("session.store: unknown store: %s", conf.Store)
+	}
+	if conf.IdleTimeout < 0 || conf.AbsoluteTimeout < 0 {
+		return fmt.Errorf("session: timeouts must not be negative")
+	}
+	if conf.IdleTimeout > 0 && conf.AbsoluteTimeout > 0 && conf.IdleTimeout > conf.AbsoluteTimeout {
+		return fmt.Errorf("session: idle_timeout must not exceed absolute_timeout")
+	}
+	return nil
+}
+
+// sessionLoad はサーバ側のセッションの設定を読み込む。store が空の場合は nil
+func sessionLoad() (*session.Manager, error) {
+	if err := sessionConfigCheck(); err != nil {
+		return nil, err
+	}
+	conf := serveConfig.Session
+
+	var store session.Store
+	switch conf.Store {
+	case "":
+		return nil, nil
+	case "memory":
+		store = session.NewMemoryStore()
+	case "bolt":
+		s, err := session.NewBoltStore(conf.BoltPath)
+		if err != nil {
+			return nil, fmt.Errorf("session: %w", err)
+		}
+		store = s
+	case "redis":
+		password := conf.RedisPassword
+		if env := os.Getenv("REDIS_PASSWORD"); env != "" {
+			password = env
+		}
+		store = session.NewRedisStore(conf.RedisAddr, password, conf.RedisDB)
+	}
+
+	m := session.NewManager(store)
+	if conf.IdleTimeout > 0 {
+		m.IdleTimeout = time.Duration(conf.IdleTimeout) * time.Second
+	}
+	if conf.AbsoluteTimeout > 0 {
+		m.AbsoluteTimeout = time.Duration(conf.AbsoluteTimeout) * time.Second
+	}
+	return m, nil
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"azuki774/go-authenticator/internal/sso"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type SSOConfig struct {
+	CookieDomains []string `toml:"cookie_domains"` // e.g. example.com, example.org。空の場合は Cookie に Domain を付けない
+	URL           string   `toml:"url"`            // ログイン画面のあるこのサーバの URL (e.g. https://auth.example.com)
+	LoginURL      string   `toml:"login_url"`      // 未ログインのときに遷移する先
+}
+
+// ssoLoad はドメインをまたいだ SSO の設定を読み込む。cookie_domains が空の場合は nil
+func ssoLoad() (*sso.Handoff, error) {
+	conf := serveConfig.SSO
+	if len(conf.CookieDomains) == 0 {
+		return nil, nil
+	}
+	u, err := url.Parse(conf.URL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("sso: url must be an absolute URL: %q", conf.URL)
+	}
+	for i, d := range conf.CookieDomains {
+		if d == "" || strings.ContainsAny(d, "/:* ") {
+			return nil, fmt.Errorf("sso.cookie_domains[%d]: invalid domain: %q", i, d)
+		}
+	}
+	h := sso.NewHandoff(conf.CookieDomains)
+	if _, ok := h.Domain(u.Host); !ok {
+		return nil, fmt.Errorf("sso: url %q is not in the cookie_domains", conf.URL)
+	}
+	return h, nil
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"azuki774/go-authenticator/internal/authenticator"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+type TLSConfig struct {
+	CertFile     string `toml:"cert_file"`
+	KeyFile      string `toml:"key_file"`
+	ClientCAFile string `toml:"client_ca_file"` // クライアント証明書を検証する CA (PEM)
+}
+
+type MTLSConfig struct {
+	Header   string   `toml:"header"` // nginx で TLS を終端する場合のクライアント証明書のヘッダ (e.g. X-SSL-Client-Cert)
+	AllowCN  []string `toml:"allow_cn"`
+	AllowSAN []string `toml:"allow_san"`
+	AllowOU  []string `toml:"allow_ou"`
+}
+
+// tlsLoad は TLS の設定を検証し、クライアント証明書の CA を読み込む
+func tlsLoad() (clientCAs *x509.CertPool, err error) {
+	conf := serveConfig.TLS
+	if (conf.CertFile == "") != (conf.KeyFile == "") {
+		return nil, fmt.Errorf("tls: both cert_file and key_file must be set")
+	}
+
+	if conf.ClientCAFile == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(conf.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls: client_ca_file: %w", err)
+	}
+	clientCAs = x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("tls: client_ca_file: no certificate found in %s", conf.ClientCAFile)
+	}
+	return clientCAs, nil
+}
+
+func certAllowListLoad() authenticator.CertAllowList {
+	l := authenticator.CertAllowList{
+		CNs:  make(map[string]bool),
+		SANs: make(map[string]bool),
+		OUs:  make(map[string]bool),
+	}
+	for _, v := range serveConfig.MTLS.AllowCN {
+		l.CNs[v] = true
+	}
+	for _, v := range serveConfig.MTLS.AllowSAN {
+		l.SANs[v] = true
+	}
+	for _, v := range serveConfig.MTLS.AllowOU {
+		l.OUs[v] = true
+	}
+	return l
+}
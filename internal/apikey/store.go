@@ -0,0 +1,265 @@
+package apikey
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenPrefix は API キーの先頭につく文字列。JWT と区別するために使う
+const TokenPrefix = "gak_"
+
+// last_used_at をファイルに書き込む間隔。リクエストごとに書き込まないようにする
+const touchInterval = time.Minute
+
+var ErrNotFound = errors.New("api key not found")
+
+// FileStore は API キーを JSON ファイルに保存する
+// CLI からの追加・失効を反映するため、ファイルが更新されていれば読み直す
+type FileStore struct {
+	Path string
+
+	mu      sync.Mutex
+	keys    map[string]*model.APIKey
+	modTime time.Time
+	touched map[string]time.Time // 最後に last_used_at を書き込んだ時刻
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path, touched: make(map[string]time.Time)}
+}
+
+// IsToken は token が API キーの形式かどうかを返す
+func IsToken(token string) bool {
+	return strings.HasPrefix(token, TokenPrefix)
+}
+
+// Create は新しい API キーを作成して保存する。token はこのときしか得られない
+func (s *FileStore) Create(owner string, scopes []string, expiresAt *time.Time, now time.Time) (token string, key model.APIKey, err error) {
+	id, err := randomHex(6)
+	if err != nil {
+		return "", model.APIKey{}, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", model.APIKey{}, err
+	}
+
+	key = model.APIKey{
+		ID:        id,
+		Owner:     owner,
+		Scopes:    scopes,
+		Hash:      hashSecret(secret),
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+	err = s.update(func(keys map[string]*model.APIKey) error {
+		keys[id] = &key
+		return nil
+	})
+	if err != nil {
+		return "", model.APIKey{}, err
+	}
+	return TokenPrefix + id + "_" + secret, key, nil
+}
+
+// Revoke は API キーを失効させる。失効したキーも一覧に残す
+func (s *FileStore) Revoke(id string, now time.Time) error {
+	return s.update(func(keys map[string]*model.APIKey) error {
+		key, ok := keys[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if key.RevokedAt == nil {
+			key.RevokedAt = &now
+		}
+		return nil
+	})
+}
+
+// List は作成日時順に API キーを返す
+func (s *FileStore) List() ([]model.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	var ret []model.APIKey
+	for _, k := range s.keys {
+		ret = append(ret, *k)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].CreatedAt.Before(ret[j].CreatedAt)
+	})
+	return ret, nil
+}
+
+// Lookup は token に対応する API キーを返す。失効・期限切れの確認は呼び出し側で行う
+func (s *FileStore) Lookup(token string) (key model.APIKey, ok bool, err error) {
+	id, secret, ok := parseToken(token)
+	if !ok {
+		return model.APIKey{}, false, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return model.APIKey{}, false, err
+	}
+
+	k, found := s.keys[id]
+	if !found {
+		return model.APIKey{}, false, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hashSecret(secret))) != 1 {
+		return model.APIKey{}, false, nil
+	}
+	return *k, true, nil
+}
+
+// Touch は last_used_at を更新する。ファイルへの書き込みは touchInterval ごと
+func (s *FileStore) Touch(id string, now time.Time) error {
+	s.mu.Lock()
+	last, ok := s.touched[id]
+	s.mu.Unlock()
+	if ok && now.Sub(last) < touchInterval {
+		return nil
+	}
+
+	err := s.update(func(keys map[string]*model.APIKey) error {
+		key, ok := keys[id]
+		if !ok {
+			return ErrNotFound
+		}
+		key.LastUsedAt = &now
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.touched[id] = now
+	s.mu.Unlock()
+	return nil
+}
+
+// update は最新のファイルを読み直してから fn で変更し、書き戻す
+func (s *FileStore) update(fn func(keys map[string]*model.APIKey) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return err
+	}
+	if err := fn(s.keys); err != nil {
+		return err
+	}
+	return s.write()
+}
+
+// reload はファイルが更新されていれば読み直す。ファイルがなければ空として扱う
+func (s *FileStore) reload() error {
+	st, err := os.Stat(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.keys = make(map[string]*model.APIKey)
+		s.modTime = time.Time{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if s.keys != nil && st.ModTime().Equal(s.modTime) {
+		return nil
+	}
+
+	b, err := os.ReadFile(s.Path)
+	if err != nil {
+		return err
+	}
+	var list []*model.APIKey
+	if err := json.Unmarshal(b, &list); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", s.Path, err)
+	}
+	s.keys = make(map[string]*model.APIKey)
+	for _, k := range list {
+		s.keys[k.ID] = k
+	}
+	s.modTime = st.ModTime()
+	return nil
+}
+
+// write は一時ファイルに書いてから rename する
+func (s *FileStore) write() error {
+	var list []*model.APIKey
+	for _, k := range s.keys {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), ".apikeys-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.Path); err != nil {
+		return err
+	}
+
+	st, err := os.Stat(s.Path)
+	if err != nil {
+		return err
+	}
+	s.modTime = st.ModTime()
+	return nil
+}
+
+// parseToken は gak_<id>_<secret> を分解する
+func parseToken(token string) (id, secret string, ok bool) {
+	if !IsToken(token) {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(strings.TrimPrefix(token, TokenPrefix), "_")
+	if !ok || id == "" || secret == "" {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+// secret は十分なエントロピーがあるので、bcrypt ではなく sha256 で保存する
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,76 @@
+package apikey
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apikeys.json")
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expires := now.Add(24 * time.Hour)
+
+	s := NewFileStore(path)
+	token, key, err := s.Create("ci", []string{"deploy"}, &expires, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsToken(token) {
+		t.Fatalf("Create() token = %v, want prefix %v", token, TokenPrefix)
+	}
+	if key.Hash == "" || key.Hash == token {
+		t.Fatalf("Create() key.Hash = %v, want hashed token", key.Hash)
+	}
+
+	// 別のプロセス (CLI とサーバ) から読んでも見える
+	server := NewFileStore(path)
+	got, ok, err := server.Lookup(token)
+	if err != nil || !ok {
+		t.Fatalf("Lookup() ok = %v, err = %v", ok, err)
+	}
+	if got.ID != key.ID || got.Owner != "ci" || !got.Active(now) {
+		t.Errorf("Lookup() = %+v", got)
+	}
+	if got.Active(expires) {
+		t.Errorf("Active() after expiry = true")
+	}
+
+	// secret が違うもの・形式が違うもの
+	for _, invalid := range []string{token + "x", TokenPrefix + key.ID, "gak_unknown_secret", "eyJhbGciOi"} {
+		if _, ok, err := server.Lookup(invalid); ok || err != nil {
+			t.Errorf("Lookup(%v) ok = %v, err = %v", invalid, ok, err)
+		}
+	}
+
+	// last_used_at は touchInterval ごとに書き込まれる
+	if err := server.Touch(key.ID, now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Touch(key.ID, now.Add(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewFileStore(path).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].LastUsedAt == nil || !keys[0].LastUsedAt.Equal(now.Add(time.Second)) {
+		t.Errorf("List() after Touch = %+v", keys)
+	}
+
+	// CLI で失効させるとサーバでも使えなくなる
+	if err := s.Revoke(key.ID, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err = server.Lookup(token)
+	if err != nil || !ok {
+		t.Fatalf("Lookup() after Revoke ok = %v, err = %v", ok, err)
+	}
+	if got.Active(now.Add(time.Hour)) {
+		t.Errorf("Active() after Revoke = true")
+	}
+
+	if err := s.Revoke("unknown", now); err != ErrNotFound {
+		t.Errorf("Revoke(unknown) err = %v, want %v", err, ErrNotFound)
+	}
+}
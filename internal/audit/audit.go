@@ -0,0 +1,141 @@
+package audit
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Version は Event の JSON の形式。フィールドの意味を変える場合に上げる
+// 2: hash を鍵なしの sha256 から HMAC-SHA256 に変更
+const Version = 2
+
+// イベントの種類
+const (
+	TypeLoginSuccess   = "login.success"
+	TypeLoginFailure   = "login.failure"
+	TypeLoginLockout   = "login.lockout"
+	TypeAccessDenied   = "access.denied"
+	TypeLogout         = "logout"
+	TypeTokenIssued    = "token.issued"
+	TypeTokenRevoked   = "token.revoked"
+	TypeSessionRevoked = "session.revoked"
+	TypeConfigLoad     = "config.load"
+)
+
+// Event は監査ログの 1 行。Seq, Time, PrevHash, Hash は Logger が設定する
+type Event struct {
+	Version       int               `json:"v"`
+	Seq           uint64            `json:"seq"`
+	Time          time.Time         `json:"time"`
+	Type          string            `json:"type"`
+	Provider      string            `json:"provider,omitempty"`
+	Subject       string            `json:"subject,omitempty"`
+	Name          string            `json:"name,omitempty"`
+	SourceIP      string            `json:"source_ip,omitempty"`
+	AuthRequestID string            `json:"authRequestId,omitempty"`
+	Reason        string            `json:"reason,omitempty"` // 拒否・失敗の理由
+	Detail        map[string]string `json:"detail,omitempty"` // client_id, host, path など種類ごとの情報
+	PrevHash      string            `json:"prev_hash"`
+	Hash          string            `json:"hash,omitempty"`
+}
+
+// hashField は行の末尾に付ける hash。hash はそれより前のバイト列 (末尾の } を補ったもの) の HMAC-SHA256
+// 鍵を知らなければ、行を書き換えて chain を計算し直すことはできない
+const hashField = `,"hash":"`
+
+var ErrChainBroken = errors.New("audit log hash chain is broken")
+
+// Sink は監査ログの書き込み先。line は改行を含まない 1 行の JSON
+type Sink interface {
+	Write(line []byte) error
+	Close() error
+}
+
+// Logger は Event に直前の行の hash を含めて書き込み、改ざん (行の変更・削除・挿入) を検出できるようにする
+type Logger struct {
+	sink Sink
+	key  []byte
+
+	mu   sync.Mutex
+	seq  uint64
+	prev string
+}
+
+// NewLogger は last (ファイルの最後の行など、続きから書く場合) の次から hash chain を続ける
+func NewLogger(sink Sink, key []byte, last *Event) *Logger {
+	l := &Logger{sink: sink, key: key}
+	if last != nil {
+		l.seq = last.Seq
+		l.prev = last.Hash
+	}
+	return l
+}
+
+// Log はイベントを書き込む。失敗しても認証の処理は止めない
+func (l *Logger) Log(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.Version = Version
+	e.Seq = l.seq + 1
+	e.Time = util.NowFunc().UTC()
+	e.PrevHash = l.prev
+	e.Hash = ""
+	line, hash, err := seal(e, l.key)
+	if err != nil {
+		zap.L().Error("failed to encode audit event", zap.String("type", e.Type), zap.Error(err))
+		return
+	}
+	if err := l.sink.Write(line); err != nil {
+		zap.L().Error("failed to write audit event", zap.String("type", e.Type), zap.Error(err))
+		return
+	}
+	l.seq = e.Seq
+	l.prev = hash
+}
+
+func (l *Logger) Close() error {
+	return l.sink.Close()
+}
+
+// seal は hash を付けた行を返す
+func seal(e Event, key []byte) (line []byte, hash string, err error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, "", err
+	}
+	hash = mac(b, key)
+	line = append(b[:len(b)-1], hashField+hash+`"}`...)
+	return line, hash, nil
+}
+
+func mac(b []byte, key []byte) string {
+	m := hmac.New(sha256.New, key)
+	m.Write(b)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// Parse は 1 行を読み、hash がその行の内容と一致することを確認する
+func Parse(line []byte, key []byte) (Event, error) {
+	var e Event
+	if err := json.Unmarshal(line, &e); err != nil {
+		return Event{}, err
+	}
+	i := bytes.LastIndex(line, []byte(hashField))
+	if i < 0 || e.Hash == "" {
+		return Event{}, ErrChainBroken
+	}
+	if !hmac.Equal([]byte(mac(append(line[:i:i], '}'), key)), []byte(e.Hash)) {
+		return Event{}, ErrChainBroken
+	}
+	return e, nil
+}
@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("audit-key")
+
+func writeEvents(t *testing.T, n int) []string {
+	t.Helper()
+	util.NowFunc = func() time.Time { return time.Unix(1721142000, 0) }
+	defer func() { util.NowFunc = time.Now }()
+
+	var buf bytes.Buffer
+	l := NewLogger(NewWriterSink(&buf), testKey, nil)
+	for i := 0; i < n; i++ {
+		l.Log(Event{Type: TypeLoginSuccess, Provider: "github", Subject: "100000", Name: "octocat", SourceIP: "192.0.2.1", AuthRequestID: "abc"})
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func TestLogger_Log(t *testing.T) {
+	lines := writeEvents(t, 1)
+	want := `{"v":2,"seq":1,"time":"2024-07-16T15:00:00Z","type":"login.success","provider":"github","subject":"100000","name":"octocat","source_ip":"192.0.2.1","authRequestId":"abc","prev_hash":"","hash":"`
+	if !strings.HasPrefix(lines[0], want) {
+		t.Errorf("Logger.Log() = %s, want prefix %s", lines[0], want)
+	}
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(lines []string) []string
+		anchor  bool // 元の 1 行目を起点として渡す
+		wantN   int
+		wantErr bool
+	}{
+		{name: "ok", modify: func(lines []string) []string { return lines }, wantN: 3},
+		{
+			name: "modified",
+			modify: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], "octocat", "hubot", 1)
+				return lines
+			},
+			wantErr: true,
+		},
+		{name: "deleted", modify: func(lines []string) []string { return append(lines[:1], lines[2:]...) }, wantErr: true},
+		{name: "reordered", modify: func(lines []string) []string { lines[1], lines[2] = lines[2], lines[1]; return lines }, wantErr: true},
+		// 先頭の行が消えている場合は、起点を渡さなければ検出する
+		{name: "head truncated", modify: func(lines []string) []string { return lines[1:] }, wantErr: true},
+		// ローテーションで古いファイルを削除した場合は、以前の検証で得た起点から残りの行の chain を検証する
+		{name: "head truncated with anchor", modify: func(lines []string) []string { return lines[1:] }, anchor: true, wantN: 2},
+		{name: "anchor not matched", modify: func(lines []string) []string { return lines }, anchor: true, wantErr: true},
+		{
+			name: "hash recomputed without chain",
+			modify: func(lines []string) []string {
+				e, _ := Parse([]byte(lines[1]), testKey)
+				e.Name, e.Hash = "hubot", ""
+				line, _, _ := seal(e, testKey)
+				lines[1] = string(line)
+				return lines
+			},
+			wantErr: true,
+		},
+		{
+			name: "chain recomputed without the key",
+			modify: func(lines []string) []string {
+				prev := ""
+				for i := range lines {
+					e, _ := Parse([]byte(lines[i]), testKey)
+					e.Name, e.PrevHash, e.Hash = "hubot", prev, ""
+					line, hash, _ := seal(e, []byte("guessed-key"))
+					lines[i], prev = string(line), hash
+				}
+				return lines
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := writeEvents(t, 3)
+			v := Verifier{Key: testKey}
+			if tt.anchor {
+				first, _ := Parse([]byte(lines[0]), testKey)
+				v.Last = &first
+			}
+			lines = tt.modify(lines)
+			n, err := v.Verify(strings.NewReader(strings.Join(lines, "\n")))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verifier.Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrChainBroken) {
+					t.Errorf("Verifier.Verify() error = %v, want %v", err, ErrChainBroken)
+				}
+				return
+			}
+			if n != tt.wantN {
+				t.Errorf("Verifier.Verify() = %d, want %d", n, tt.wantN)
+			}
+		})
+	}
+}
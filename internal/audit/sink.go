@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	DefaultMaxSize    = 100 << 20 // 100 MB
+	DefaultMaxBackups = 10
+)
+
+// WriterSink は標準出力などに 1 行ずつ書き込む
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(append(line, '\n'))
+	return err
+}
+
+func (s *WriterSink) Close() error { return nil }
+
+// FileSink はファイルに追記し、MaxSize を超えたら <path>.1, <path>.2, ... にローテーションする
+// hash chain はローテーションしたファイルをまたいで続く
+type FileSink struct {
+	Path       string
+	MaxSize    int64
+	MaxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{Path: path, MaxSize: maxSize, MaxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LastEvent は現在のファイル (空の場合はローテーションした直前のファイル) の最後の行を返す。NewLogger に渡して chain を続ける
+func (s *FileSink) LastEvent(key []byte) (*Event, error) {
+	for _, path := range []string{s.Path, s.backupPath(1)} {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		e, err := LastEvent(f, key)
+		f.Close()
+		if err != nil || e != nil {
+			return e, err
+		}
+	}
+	return nil, nil
+}
+
+func (s *FileSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.MaxSize > 0 && s.size > 0 && s.size+int64(len(line))+1 > s.MaxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.f.Write(append(line, '\n'))
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f = f
+	s.size = info.Size()
+	return nil
+}
+
+// rotate は <path>.N を <path>.N+1 にずらし、MaxBackups を超えたものを削除する
+func (s *FileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	maxBackups := s.MaxBackups
+	if maxBackups <= 0 {
+		maxBackups = DefaultMaxBackups
+	}
+	os.Remove(s.backupPath(maxBackups))
+	for i := maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(s.backupPath(i), s.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(s.Path, s.backupPath(1)); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *FileSink) backupPath(i int) string {
+	return fmt.Sprintf("%s.%d", s.Path, i)
+}
@@ -0,0 +1,70 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSink_rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileSink(path, 1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLogger(sink, testKey, nil)
+	for i := 0; i < 10; i++ {
+		l.Log(Event{Type: TypeLoginFailure, Provider: "basic", Subject: "user", Reason: "invalid credentials"})
+	}
+	l.Close()
+
+	// 再起動しても chain を続ける
+	sink, err = NewFileSink(path, 1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err := sink.LastEvent(testKey)
+	if err != nil || last == nil || last.Seq != 10 {
+		t.Fatalf("FileSink.LastEvent() = %v, %v, want seq 10", last, err)
+	}
+	l = NewLogger(sink, testKey, last)
+	for i := 0; i < 2; i++ {
+		l.Log(Event{Type: TypeLogout, Provider: "basic", Subject: "user"})
+	}
+	l.Close()
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists, want at most 2 backups", path)
+	}
+	// 古い順に検証すると、ファイルをまたいで chain がつながっている
+	// 先頭のファイルは削除されているので、残っている最古の行の直前を起点にする (本来は以前の検証で得た値を使う)
+	b, err := os.ReadFile(path + ".2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := Parse(bytes.SplitN(b, []byte("\n"), 2)[0], testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := Verifier{Key: testKey, Last: &Event{Seq: first.Seq - 1, Hash: first.PrevHash}}
+	total := 0
+	for _, p := range []string{path + ".2", path + ".1", path} {
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := v.Verify(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("Verifier.Verify(%s) error = %v", p, err)
+		}
+		if info, _ := os.Stat(p); info.Size() > 1024 {
+			t.Errorf("%s size = %d, want <= 1024", p, info.Size())
+		}
+		total += n
+	}
+	if v.Last.Seq != 12 || total >= 12 {
+		t.Errorf("last seq = %d, lines = %d, want seq 12 and the oldest lines rotated out", v.Last.Seq, total)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"log/syslog"
+)
+
+// SyslogSink は syslog (LOG_AUTH) に送る。network, addr が空の場合はローカルの syslog
+type SyslogSink struct {
+	w *syslog.Writer
+}
+
+func NewSyslogSink(network, addr, tag string) (*SyslogSink, error) {
+	w, err := syslog.Dial(network, addr, syslog.LOG_AUTH|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{w: w}, nil
+}
+
+func (s *SyslogSink) Write(line []byte) error {
+	return s.w.Info(string(line))
+}
+
+func (s *SyslogSink) Close() error {
+	return s.w.Close()
+}
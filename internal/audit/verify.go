@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Verifier は複数のファイルにまたがる hash chain を古い順に検証する
+type Verifier struct {
+	Key []byte
+	// 最後に検証した行。ローテーションで古いファイルが消えている場合は、以前の検証で得た seq と hash を起点 (anchor) として入れておく
+	Last *Event
+}
+
+// Verify は r の各行の hash と、直前の行とのつながりを検証して行数を返す
+// Last が nil の場合は、最初の行が chain の先頭 (seq 1, prev_hash が空) であることを要求する
+func (v *Verifier) Verify(r io.Reader) (int, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	n := 0
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		n++
+		e, err := Parse(line, v.Key)
+		if err != nil {
+			return n, fmt.Errorf("line %d: %w", n, err)
+		}
+		prev := Event{} // chain の先頭は seq 0, hash "" の次
+		if v.Last != nil {
+			prev = *v.Last
+		}
+		if e.PrevHash != prev.Hash || e.Seq != prev.Seq+1 {
+			return n, fmt.Errorf("line %d (seq %d): %w", n, e.Seq, ErrChainBroken)
+		}
+		v.Last = &e
+	}
+	return n, sc.Err()
+}
+
+// LastEvent は r の最後の行を返す。空の場合は nil
+func LastEvent(r io.Reader, key []byte) (*Event, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	var last []byte
+	for sc.Scan() {
+		if line := bytes.TrimSpace(sc.Bytes()); len(line) > 0 {
+			last = append(last[:0], line...)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if last == nil {
+		return nil, nil
+	}
+	e, err := Parse(last, key)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
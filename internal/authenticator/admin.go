@@ -0,0 +1,108 @@
+package authenticator
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/session"
+	"azuki774/go-authenticator/internal/util"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+var ErrSessionTrackingDisabled = errors.New("neither server-side sessions nor token tracking is enabled")
+
+// TokenTracker は Cookie に入れて発行した JWT を jti で記録する
+type TokenTracker interface {
+	Track(jti string, principal model.Principal, exp time.Time) error
+	Seen(jti string, ip string) error
+	Get(jti string) (s session.Session, ok bool, err error)
+	Delete(jti string) error
+	List() ([]session.Session, error)
+}
+
+// trackToken は発行した JWT を記録する。失敗してもログインは止めない
+func (a *Authenticator) trackToken(jti string, life int, principal model.Principal) {
+	principal.Roles = a.Roles.Resolve(principal)
+	exp := util.NowFunc().Add(time.Duration(life) * time.Second)
+	if err := a.Tokens.Track(jti, principal, exp); err != nil {
+		zap.L().Warn("failed to track token", zap.String("jti", jti), zap.Error(err))
+	}
+}
+
+// tokenSeen は記録した JWT の最終アクセス時刻と送信元を更新する
+func (a *Authenticator) tokenSeen(r *http.Request, claims jwt.MapClaims) {
+	jti, ok := claims["jti"].(string)
+	if !ok || a.Tokens == nil {
+		return
+	}
+	ip, _ := util.ClientIP(r.Context())
+	if err := a.Tokens.Seen(jti, ip); err != nil {
+		zap.L().Warn("failed to update tracked token", zap.String("jti", jti), zap.Error(err))
+	}
+}
+
+// ListSessions はログイン中のセッション (サーバ側のセッション、または記録した JWT) を返す
+func (a *Authenticator) ListSessions() ([]session.Session, error) {
+	switch {
+	case a.Sessions != nil:
+		return a.Sessions.List()
+	case a.Tokens != nil:
+		return a.Tokens.List()
+	}
+	return nil, ErrSessionTrackingDisabled
+}
+
+// RevokeSession は ID のセッションを削除する。JWT の場合は jti を失効リストに入れる
+func (a *Authenticator) RevokeSession(id string) (found bool, err error) {
+	switch {
+	case a.Sessions != nil:
+		return a.Sessions.Revoke(id)
+	case a.Tokens != nil:
+		s, ok, err := a.Tokens.Get(id)
+		if err != nil || !ok {
+			return false, err
+		}
+		return true, a.revokeTrackedToken(s)
+	}
+	return false, ErrSessionTrackingDisabled
+}
+
+// RevokeUserSessions はユーザのセッションをすべて削除し、削除した数を返す
+func (a *Authenticator) RevokeUserSessions(provider, subject string) (int, error) {
+	switch {
+	case a.Sessions != nil:
+		return a.Sessions.RevokeUser(provider, subject)
+	case a.Tokens != nil:
+		sessions, err := a.Tokens.List()
+		if err != nil {
+			return 0, err
+		}
+		n := 0
+		for _, s := range sessions {
+			if s.Principal.Provider != provider || s.Principal.Subject != subject {
+				continue
+			}
+			if err := a.revokeTrackedToken(s); err != nil {
+				return n, err
+			}
+			n++
+		}
+		zap.L().Info("user tokens revoked", zap.String("provider", provider), zap.String("subject", subject), zap.Int("tokens", n))
+		return n, nil
+	}
+	return 0, ErrSessionTrackingDisabled
+}
+
+func (a *Authenticator) revokeTrackedToken(s session.Session) error {
+	if a.Revocations == nil {
+		return ErrRevocationNotSupported
+	}
+	if err := a.Revocations.Revoke(jtiRevocationID(s.ID), s.ExpiresAt); err != nil {
+		return err
+	}
+	zap.L().Info("token revoked by jti", zap.String("jti", s.ID), zap.String("provider", s.Principal.Provider), zap.String("sub", s.Principal.Subject))
+	return a.Tokens.Delete(s.ID)
+}
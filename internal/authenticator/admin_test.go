@@ -0,0 +1,135 @@
+package authenticator
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/session"
+	"azuki774/go-authenticator/internal/util"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAuthenticator_RevokeSession_trackedToken(t *testing.T) {
+	octocat := model.Principal{Provider: "github", Subject: "100000", Name: "octocat"}
+	user := model.Principal{Provider: "basic", Subject: "user", Name: "user"}
+	tests := []struct {
+		name        string
+		revoke      func(a *Authenticator, ids map[string]string) (int, error)
+		wantRevoked []string // 失効して Cookie が使えなくなる token
+	}{
+		{
+			name: "single session",
+			revoke: func(a *Authenticator, ids map[string]string) (int, error) {
+				found, err := a.RevokeSession(ids["octocat1"])
+				if found {
+					return 1, err
+				}
+				return 0, err
+			},
+			wantRevoked: []string{"octocat1"},
+		},
+		{
+			name: "unknown session",
+			revoke: func(a *Authenticator, ids map[string]string) (int, error) {
+				found, err := a.RevokeSession("unknown")
+				if found {
+					return 1, err
+				}
+				return 0, err
+			},
+		},
+		{
+			name: "all sessions of user",
+			revoke: func(a *Authenticator, ids map[string]string) (int, error) {
+				return a.RevokeUserSessions("github", "100000")
+			},
+			wantRevoked: []string{"octocat1", "octocat2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authenticator{
+				Issuer:      "testprogram",
+				HmacSecret:  "super_sugoi_secret",
+				Revocations: &mockRevocationList{revoked: make(map[string]time.Time)},
+				Tokens:      session.NewTracker(session.NewMemoryStore()),
+			}
+			tokens := make(map[string]string)
+			for name, p := range map[string]model.Principal{"octocat1": octocat, "octocat2": octocat, "user": user} {
+				// jwt の有効期限は NowFunc ではなく現在時刻で検証されるので、十分長くする
+				cookies, err := a.GenerateCookie(1<<30, p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tokens[name] = cookies[0].Value
+			}
+
+			sessions, err := a.ListSessions()
+			if err != nil || len(sessions) != 3 {
+				t.Fatalf("ListSessions() = %v, %v, want 3 sessions", sessions, err)
+			}
+			ids := make(map[string]string)
+			for name, token := range tokens {
+				claims, _, _ := a.parseJWT(token)
+				ids[name] = claims["jti"].(string)
+			}
+
+			n, err := tt.revoke(a, ids)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(tt.wantRevoked) {
+				t.Errorf("revoked = %d, want %d", n, len(tt.wantRevoked))
+			}
+			if sessions, _ := a.ListSessions(); len(sessions) != 3-n {
+				t.Errorf("ListSessions() after revoke = %d sessions, want %d", len(sessions), 3-n)
+			}
+
+			for name, token := range tokens {
+				revoked := false
+				for _, v := range tt.wantRevoked {
+					revoked = revoked || v == name
+				}
+				r := &http.Request{Header: http.Header{"Cookie": {fmt.Sprintf("%s=%s", CookieJWTName, token)}}}
+				if _, ok, err := a.CheckCookieJWT(r); ok == revoked || err != nil {
+					t.Errorf("CheckCookieJWT(%s) = %v, %v, want %v", name, ok, err, !revoked)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthenticator_CheckCookieJWT_trackedToken(t *testing.T) {
+	now := time.Unix(1721142000, 0)
+	util.NowFunc = func() time.Time { return now }
+	defer func() { util.NowFunc = time.Now }()
+
+	a := &Authenticator{Issuer: "testprogram", HmacSecret: "super_sugoi_secret", Tokens: session.NewTracker(session.NewMemoryStore())}
+	cookies, err := a.GenerateCookie(1<<30, model.Principal{Provider: "basic", Subject: "user", Name: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(5 * time.Minute)
+	r := &http.Request{Header: http.Header{"Cookie": {fmt.Sprintf("%s=%s", CookieJWTName, cookies[0].Value)}}}
+	r = r.WithContext(util.WithClientIP(r.Context(), "192.0.2.1"))
+	if _, ok, err := a.CheckCookieJWT(r); !ok || err != nil {
+		t.Fatalf("CheckCookieJWT() = %v, %v", ok, err)
+	}
+
+	sessions, err := a.ListSessions()
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("ListSessions() = %v, %v", sessions, err)
+	}
+	if s := sessions[0]; s.IP != "192.0.2.1" || !s.LastSeenAt.Equal(now) || s.Principal.Name != "user" {
+		t.Errorf("ListSessions() = %+v", s)
+	}
+}
+
+func TestAuthenticator_ListSessions_disabled(t *testing.T) {
+	a := &Authenticator{Issuer: "testprogram", HmacSecret: "super_sugoi_secret"}
+	if _, err := a.ListSessions(); err != ErrSessionTrackingDisabled {
+		t.Errorf("ListSessions() error = %v, want %v", err, ErrSessionTrackingDisabled)
+	}
+}
@@ -0,0 +1,25 @@
+package authenticator
+
+// AllowList はユーザ ID・ユーザ名・グループ (組織) のいずれかに一致したユーザを許可する
+type AllowList struct {
+	IDs       map[int]bool
+	Usernames map[string]bool
+	Groups    map[string]bool
+}
+
+func (l AllowList) Allowed(id int, username string, groups []string) bool {
+	if l.IDs[id] || l.Usernames[username] {
+		return true
+	}
+	for _, g := range groups {
+		if l.Groups[g] {
+			return true
+		}
+	}
+	return false
+}
+
+// NeedGroups はグループによる許可ルールがあるかどうか (グループ取得の API を呼ぶ必要があるか) を返す
+func (l AllowList) NeedGroups() bool {
+	return len(l.Groups) > 0
+}
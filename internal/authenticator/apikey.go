@@ -0,0 +1,110 @@
+package authenticator
+
+import (
+	"azuki774/go-authenticator/internal/apikey"
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/util"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// APIKeyStore はハッシュ化して保存された API キーを扱う
+type APIKeyStore interface {
+	// Lookup は token に対応する API キーを返す。存在しないかハッシュが一致しない場合は ok = false
+	Lookup(token string) (key model.APIKey, ok bool, err error)
+	// Touch は API キーの最終利用時刻を更新する
+	Touch(id string, now time.Time) error
+}
+
+// bearerToken は Authorization: Bearer <token> の token を返す
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// CheckBearerToken は Authorization: Bearer の JWT または API キーを検証する
+func (a *Authenticator) CheckBearerToken(r *http.Request) (principal model.Principal, ok bool, err error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return model.Principal{}, false, nil
+	}
+
+	if apikey.IsToken(token) {
+		return a.checkAPIKey(token)
+	}
+
+	principal, ok, err = a.verifyJWT(token)
+	if err != nil {
+		// Cookie と違いクライアントが直接指定するので、壊れたトークンは認証失敗として扱う
+		zap.L().Warn("invalid bearer token", zap.String("jwt", maskedJwt(token)), zap.Error(err))
+		return model.Principal{}, false, nil
+	}
+	return principal, ok, nil
+}
+
+// CheckBasicCredentials は Authorization: Basic の password に basic auth のパスワードか API キーを受け付ける
+// docker login のように Basic 認証しか使えないクライアント向け
+func (a *Authenticator) CheckBasicCredentials(r *http.Request) (principal model.Principal, ok bool, err error) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return model.Principal{}, false, nil
+	}
+
+	if apikey.IsToken(pass) {
+		// ユーザ名は任意 (API キーの所有者になる)
+		return a.checkAPIKey(pass)
+	}
+
+	if !a.CheckBasicAuth(r) {
+		return model.Principal{}, false, nil
+	}
+	principal = model.Principal{Provider: "basic", Subject: user, Name: user}
+	principal.Roles = a.Roles.Resolve(principal)
+	return principal, true, nil
+}
+
+func (a *Authenticator) checkAPIKey(token string) (principal model.Principal, ok bool, err error) {
+	if a.APIKeys == nil {
+		zap.L().Warn("api key is not enabled")
+		return model.Principal{}, false, nil
+	}
+
+	key, ok, err := a.APIKeys.Lookup(token)
+	if err != nil {
+		zap.L().Error("failed to lookup api key", zap.Error(err))
+		return model.Principal{}, false, err
+	}
+	if !ok {
+		zap.L().Warn("api key not found")
+		return model.Principal{}, false, nil
+	}
+
+	now := util.NowFunc()
+	if !key.Active(now) {
+		zap.L().Warn("api key is revoked or expired", zap.String("id", key.ID), zap.String("owner", key.Owner))
+		return model.Principal{}, false, nil
+	}
+	if err := a.APIKeys.Touch(key.ID, now); err != nil {
+		// 最終利用時刻の更新に失敗しても認証は通す
+		zap.L().Warn("failed to update last used time of api key", zap.String("id", key.ID), zap.Error(err))
+	}
+
+	principal = model.Principal{
+		Provider: "apikey",
+		Subject:  key.Owner,
+		Name:     key.Owner,
+		Scopes:   key.Scopes,
+	}
+	// Cookie と違い claim に埋め込めないので、ロールはここで割り当てる
+	principal.Roles = a.Roles.Resolve(principal)
+
+	zap.L().Info("check api key ok", zap.String("id", key.ID), zap.String("owner", key.Owner))
+	return principal, true, nil
+}
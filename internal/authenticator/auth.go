@@ -6,6 +6,10 @@ import (
 	"net/http"
 	"strings"
 
+	"azuki774/go-authenticator/internal/cookie"
+	"azuki774/go-authenticator/internal/keyring"
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/policy"
 	"azuki774/go-authenticator/internal/util"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -13,7 +17,11 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-const CookieJWTName = "jwt"
+// CookieJWTName は Cookie の設定がない場合の名前
+const CookieJWTName = cookie.DefaultName
+
+// newJTI は発行する JWT の jti。テストで固定する
+var newJTI = util.PublishID
 
 type Authenticator struct {
 	BasicAuthMap map[string]string
@@ -22,6 +30,33 @@ type Authenticator struct {
 
 	AllowGitHubList map[int]bool
 	ClientGitHub    ClientGitHub
+
+	AllowGoogleDomain map[string]bool // hd claim で許可するドメイン
+	AllowGoogleEmail  map[string]bool
+	ClientGoogle      ClientGoogle
+
+	AllowGitLab  AllowList
+	ClientGitLab ClientGitLab
+	AllowGitea   AllowList
+	ClientGitea  ClientGitea
+
+	Roles  policy.Roles   // JWT に埋め込むロールの割り当て
+	Policy *policy.Policy // /auth_jwt_request の認可ルール。グループを参照するルールがあればログイン時にグループを取得する
+
+	AllowClientCert CertAllowList
+
+	APIKeys APIKeyStore // nil の場合は API キーを使わない
+
+	Revocations RevocationList // nil の場合はトークンを失効させられない
+
+	Sessions SessionManager // nil でない場合は Cookie に JWT の代わりにサーバ側のセッションの token を入れる
+	Tokens   TokenTracker   // nil でない場合は Cookie に入れる JWT に jti を付けて記録する (Sessions を使わない場合の管理 API 用)
+
+	Notifier Notifier // nil の場合は許可リストにないユーザのログインを通知しない
+
+	Cookie        cookie.Config        // JWT を保存する Cookie の属性。Name が空の場合は cookie.Default()
+	EncryptCookie bool                 // Cookie の JWT を CookieKeys で JWE に暗号化する。false でも暗号化された Cookie は受け付ける
+	CookieKeys    *keyring.AEADKeyring // JWE の鍵。nil の場合は暗号化された Cookie を受け付けない
 }
 
 func (a *Authenticator) CheckBasicAuth(r *http.Request) bool {
@@ -45,68 +80,207 @@ func (a *Authenticator) CheckBasicAuth(r *http.Request) bool {
 	return true
 }
 
-func (a *Authenticator) CheckCookieJWT(r *http.Request) (ok bool, err error) {
-	tokenCookie, err := r.Cookie(CookieJWTName)
-	if err != nil {
-		// unknown error: http: named cookie not present
-		// token の key がない場合もここに落ちるので、この場合は ok = false とする
-		return false, nil
+func (a *Authenticator) CheckCookieJWT(r *http.Request) (principal model.Principal, ok bool, err error) {
+	tokenString, ok := a.cookieConfig().Value(r)
+	if !ok {
+		// token の key がない場合は ok = false とする
+		return model.Principal{}, false, nil
+	}
+	if a.Sessions != nil {
+		return a.checkSession(r, tokenString)
 	}
 
-	tokenString := tokenCookie.Value
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Don't forget to validate the alg is what you expect:
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			zap.L().Error("unexpected signing method")
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	claims, ok, err := a.verifyJWTClaims(tokenString)
+	if !ok || err != nil {
+		return model.Principal{}, ok, err
+	}
+	a.tokenSeen(r, claims)
+	return principalFromClaims(claims), true, nil
+}
+
+func (a *Authenticator) cookieConfig() cookie.Config {
+	if a.Cookie.Name == "" {
+		return cookie.Default()
+	}
+	return a.Cookie
+}
+
+// VerifyToken は Cookie 以外で渡された JWT (kube-apiserver の TokenReview など) を CheckCookieJWT と同じく検証する
+func (a *Authenticator) VerifyToken(tokenString string) (principal model.Principal, ok bool, err error) {
+	return a.verifyJWT(tokenString)
+}
+
+// verifyJWT は GenerateCookie で発行した JWT を検証し、ユーザの情報を取り出す
+func (a *Authenticator) verifyJWT(tokenString string) (principal model.Principal, ok bool, err error) {
+	claims, ok, err := a.verifyJWTClaims(tokenString)
+	if !ok || err != nil {
+		return model.Principal{}, ok, err
+	}
+	return principalFromClaims(claims), true, nil
+}
+
+// verifyJWTClaims は parseJWT に加えて失効していないことを確認する
+func (a *Authenticator) verifyJWTClaims(tokenString string) (claims jwt.MapClaims, ok bool, err error) {
+	claims, ok, err = a.parseJWT(tokenString)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	if revoked, err := a.revoked(tokenString, claims); err != nil || revoked {
+		return nil, false, err
+	}
+
+	zap.L().Info("check JWT ok")
+	return claims, true, nil
+}
+
+// parseJWT は署名・有効期限・issuer を検証して claim を返す。JWE で暗号化されている場合は復号してから検証する
+func (a *Authenticator) parseJWT(tokenString string) (claims jwt.MapClaims, ok bool, err error) {
+	if isJWE(tokenString) {
+		tokenString, err = a.decryptJWE(tokenString)
+		if err != nil {
+			return nil, false, err
 		}
+	}
 
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// hmacSampleSecret is a []byte containing your secret, e.g. []byte("my_secret_key")
 		return []byte(a.HmacSecret), nil
-	})
+	},
+		jwt.WithValidMethods([]string{"HS256"}),
+		// 署名の末尾の使われないビットを変えた別の文字列を受け付けない (失効リストを回避できてしまう)
+		jwt.WithStrictDecoding(),
+	)
 	if err != nil {
 		// token expired も含む
 		if errors.Is(err, jwt.ErrTokenExpired) {
 			zap.L().Warn("token expired", zap.String("jwt", maskedJwt(tokenString)))
-			return false, nil
+			return nil, false, nil
 		}
-		return false, err
+		return nil, false, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		if claims["iss"] != a.Issuer {
-			zap.L().Warn("issuer mismatched", zap.String("jwt", maskedJwt(tokenString)))
-			return false, nil
+	claims, ok = token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, false, err
+	}
+	if claims["iss"] != a.Issuer {
+		zap.L().Warn("issuer mismatched", zap.String("jwt", maskedJwt(tokenString)))
+		return nil, false, nil
+	}
+
+	return claims, true, nil
+}
+
+func (a *Authenticator) GenerateCookie(life int, principal model.Principal) ([]*http.Cookie, error) {
+	if a.Sessions != nil {
+		return a.generateSessionCookie(life, principal)
+	}
+
+	jti := newJTI()
+	tokenString, err := a.generateToken(life, principal, jti)
+	if err != nil {
+		return nil, err
+	}
+	if a.Tokens != nil {
+		a.trackToken(jti, life, principal)
+	}
+	if a.EncryptCookie {
+		// claim (メールアドレス, グループなど) を Cookie から読めないようにする
+		tokenString, err = a.encryptJWE(tokenString)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		return false, err
 	}
+	// life 秒後まで Cookie を保つ。4 KB を超える場合は分割される
+	cookies := a.cookieConfig().Cookies(tokenString, life)
 
-	zap.L().Info("check JWT ok")
-	return true, nil
+	zap.L().Info("generate JWT cookie", zap.Int("chunks", len(cookies)))
+	return cookies, nil
+}
+
+// GenerateToken は life 秒有効な JWT を発行する。Cookie 以外 (Authorization: Bearer) で使う場合もこれを使う
+func (a *Authenticator) GenerateToken(life int, principal model.Principal) (string, error) {
+	return a.generateToken(life, principal, newJTI())
 }
 
-func (a *Authenticator) GenerateCookie(life int) (*http.Cookie, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"exp": util.NowFunc().Unix() + int64(life),
+// generateToken は jti を claim に入れる。失効は jti で行う
+func (a *Authenticator) generateToken(life int, principal model.Principal, jti string) (string, error) {
+	now := util.NowFunc().Unix()
+	claims := jwt.MapClaims{
+		"exp": now + int64(life),
+		"iat": now, // ログインした時刻 (OIDC の auth_time に使う)
 		"iss": a.Issuer,
-	})
+	}
+	if jti != "" {
+		claims["jti"] = jti
+	}
+	// 認証したユーザの情報がわかっている場合は claim に入れる
+	if principal.Subject != "" {
+		claims["sub"] = principal.Subject
+		claims["provider"] = principal.Provider
+	}
+	if principal.Name != "" {
+		claims["name"] = principal.Name
+	}
+	if principal.Email != "" {
+		claims["email"] = principal.Email
+	}
+	if len(principal.Groups) > 0 {
+		claims["groups"] = principal.Groups
+	}
+	if roles := a.Roles.Resolve(principal); len(roles) > 0 {
+		claims["roles"] = roles
+	}
+	if len(principal.Scopes) > 0 {
+		claims["scope"] = strings.Join(principal.Scopes, " ")
+	}
+	if len(principal.Audience) > 0 {
+		claims["aud"] = principal.Audience
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	// Sign and get the complete encoded token as a string using the secret
 	tokenString, err := token.SignedString([]byte(a.HmacSecret))
 	if err != nil {
 		zap.L().Error("failed to generate JWT access token", zap.Error(err))
-		return nil, fmt.Errorf("failed to generate JWT access token: %w", err)
+		return "", fmt.Errorf("failed to generate JWT access token: %w", err)
+	}
+	return tokenString, nil
+}
+
+// principalFromClaims は GenerateCookie で埋め込んだ claim からユーザの情報を取り出す
+func principalFromClaims(claims jwt.MapClaims) model.Principal {
+	var principal model.Principal
+	principal.Subject, _ = claims["sub"].(string)
+	principal.Provider, _ = claims["provider"].(string)
+	principal.Name, _ = claims["name"].(string)
+	principal.Email, _ = claims["email"].(string)
+	principal.Groups = stringsFromClaim(claims["groups"])
+	principal.Roles = stringsFromClaim(claims["roles"])
+	if scope, ok := claims["scope"].(string); ok {
+		principal.Scopes = strings.Fields(scope)
 	}
-	cookie := &http.Cookie{
-		Name:     CookieJWTName,
-		Value:    tokenString,
-		Path:     "/",
-		HttpOnly: true,
-		MaxAge:   int(life), // life 秒後まで Cookie を保つ
+	if aud, err := claims.GetAudience(); err == nil && len(aud) > 0 {
+		principal.Audience = aud
 	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		principal.AuthTime = iat.Time
+	}
+	return principal
+}
 
-	zap.L().Info("generate JWT cookie")
-	return cookie, nil
+func stringsFromClaim(v interface{}) []string {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	var ret []string
+	for _, e := range list {
+		if s, ok := e.(string); ok {
+			ret = append(ret, s)
+		}
+	}
+	return ret
 }
 
 func maskedJwt(tokenString string) string {
@@ -0,0 +1,74 @@
+package authenticator
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"crypto/x509"
+
+	"go.uber.org/zap"
+)
+
+// CertAllowList はクライアント証明書の CN・SAN・OU のいずれかに一致した証明書を許可する
+type CertAllowList struct {
+	CNs  map[string]bool
+	SANs map[string]bool // DNS 名, メールアドレス, URI
+	OUs  map[string]bool
+}
+
+func (l CertAllowList) allowed(cert *x509.Certificate) bool {
+	if l.CNs[cert.Subject.CommonName] {
+		return true
+	}
+	for _, san := range certSANs(cert) {
+		if l.SANs[san] {
+			return true
+		}
+	}
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if l.OUs[ou] {
+			return true
+		}
+	}
+	return false
+}
+
+// HandlingClientCert は検証済みのクライアント証明書から、JWT を発行してよいかを判断する
+// 証明書チェーンの検証は TLS の終端 (このサーバか nginx) で済んでいること
+func (a *Authenticator) HandlingClientCert(cert *x509.Certificate) (principal model.Principal, ok bool) {
+	if !a.AllowClientCert.allowed(cert) {
+		zap.L().Warn("this certificate is not allowed from config",
+			zap.String("subject", cert.Subject.String()),
+			zap.Strings("san", certSANs(cert)),
+		)
+		return model.Principal{}, false
+	}
+
+	principal = model.Principal{
+		Provider: "mtls",
+		Subject:  cert.Subject.CommonName,
+		Name:     cert.Subject.CommonName,
+		Groups:   cert.Subject.OrganizationalUnit,
+	}
+	if principal.Subject == "" {
+		// CN がない場合は最初の SAN を使う
+		if sans := certSANs(cert); len(sans) > 0 {
+			principal.Subject = sans[0]
+			principal.Name = sans[0]
+		}
+	}
+	if len(cert.EmailAddresses) > 0 {
+		principal.Email = cert.EmailAddresses[0]
+	}
+
+	zap.L().Info("this certificate is authorized", zap.String("subject", cert.Subject.String()))
+	return principal, true
+}
+
+func certSANs(cert *x509.Certificate) []string {
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
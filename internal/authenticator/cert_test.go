@@ -0,0 +1,81 @@
+package authenticator
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestAuthenticator_HandlingClientCert(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.com/ci")
+	allow := CertAllowList{
+		CNs:  map[string]bool{"deploy-bot": true},
+		SANs: map[string]bool{"spiffe://example.com/ci": true, "backup.example.com": true},
+		OUs:  map[string]bool{"infra": true},
+	}
+	tests := []struct {
+		name          string
+		cert          *x509.Certificate
+		wantPrincipal model.Principal
+		wantOk        bool
+	}{
+		{
+			name: "allowed by CN",
+			cert: &x509.Certificate{
+				Subject:        pkix.Name{CommonName: "deploy-bot"},
+				EmailAddresses: []string{"bot@example.com"},
+			},
+			wantPrincipal: model.Principal{Provider: "mtls", Subject: "deploy-bot", Name: "deploy-bot", Email: "bot@example.com"},
+			wantOk:        true,
+		},
+		{
+			name: "allowed by URI SAN without CN",
+			cert: &x509.Certificate{
+				URIs: []*url.URL{spiffe},
+			},
+			wantPrincipal: model.Principal{Provider: "mtls", Subject: "spiffe://example.com/ci", Name: "spiffe://example.com/ci"},
+			wantOk:        true,
+		},
+		{
+			name: "allowed by DNS SAN",
+			cert: &x509.Certificate{
+				Subject:  pkix.Name{CommonName: "backup"},
+				DNSNames: []string{"backup.example.com"},
+			},
+			wantPrincipal: model.Principal{Provider: "mtls", Subject: "backup", Name: "backup"},
+			wantOk:        true,
+		},
+		{
+			name: "allowed by OU",
+			cert: &x509.Certificate{
+				Subject: pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"infra", "dev"}},
+			},
+			wantPrincipal: model.Principal{Provider: "mtls", Subject: "alice", Name: "alice", Groups: []string{"infra", "dev"}},
+			wantOk:        true,
+		},
+		{
+			name: "not allowed",
+			cert: &x509.Certificate{
+				Subject:  pkix.Name{CommonName: "mallory", OrganizationalUnit: []string{"dev"}},
+				DNSNames: []string{"mallory.example.com"},
+			},
+			wantPrincipal: model.Principal{},
+			wantOk:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authenticator{AllowClientCert: allow}
+			gotPrincipal, gotOk := a.HandlingClientCert(tt.cert)
+			if !reflect.DeepEqual(gotPrincipal, tt.wantPrincipal) {
+				t.Errorf("Authenticator.HandlingClientCert() gotPrincipal = %v, want %v", gotPrincipal, tt.wantPrincipal)
+			}
+			if gotOk != tt.wantOk {
+				t.Errorf("Authenticator.HandlingClientCert() gotOk = %v, want %v", gotOk, tt.wantOk)
+			}
+		})
+	}
+}
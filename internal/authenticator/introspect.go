@@ -0,0 +1,129 @@
+package authenticator
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+var ErrRevocationNotSupported = errors.New("token revocation is not enabled")
+
+// RevocationList は失効させたトークンを有効期限まで保持する
+type RevocationList interface {
+	Revoke(id string, exp time.Time) error
+	Revoked(id string) (bool, error)
+}
+
+// IntrospectToken は CheckCookieJWT と同じ検証をして、RFC 7662 の形式でトークンの情報を返す
+// 無効なトークンの場合は active = false のみを返す
+func (a *Authenticator) IntrospectToken(tokenString string) (map[string]any, error) {
+	claims, ok, err := a.parseJWT(tokenString)
+	if err != nil {
+		// 署名の不一致など。クライアントには理由を返さない
+		zap.L().Warn("introspect invalid token", zap.String("jwt", maskedJwt(tokenString)), zap.Error(err))
+		return map[string]any{"active": false}, nil
+	}
+	if !ok {
+		return map[string]any{"active": false}, nil
+	}
+	revoked, err := a.revoked(tokenString, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return map[string]any{"active": false}, nil
+	}
+
+	res := map[string]any{"active": true, "token_type": "Bearer"}
+	for k, v := range claims {
+		res[k] = v
+	}
+	if name, ok := claims["name"]; ok {
+		res["username"] = name
+	}
+	// client_credentials で発行したトークン
+	if claims["provider"] == "client" {
+		res["client_id"] = claims["sub"]
+	}
+	return res, nil
+}
+
+// RevokeToken はトークンを失効させる。無効なトークンの場合は何もしない (RFC 7009 2.2)
+func (a *Authenticator) RevokeToken(tokenString string) error {
+	if a.Revocations == nil {
+		return ErrRevocationNotSupported
+	}
+
+	claims, ok, err := a.parseJWT(tokenString)
+	if err != nil || !ok {
+		zap.L().Info("revoke invalid token, ignored", zap.String("jwt", maskedJwt(tokenString)))
+		return nil
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		// 有効期限のないトークンは発行していない
+		return nil
+	}
+
+	// jti のない古いトークンは署名で失効させる
+	id := tokenID(tokenString)
+	jti, hasJTI := claims["jti"].(string)
+	if hasJTI {
+		id = jtiRevocationID(jti)
+	}
+	if err := a.Revocations.Revoke(id, exp.Time); err != nil {
+		return err
+	}
+	if hasJTI && a.Tokens != nil {
+		if err := a.Tokens.Delete(jti); err != nil {
+			zap.L().Warn("failed to delete tracked token", zap.String("jti", jti), zap.Error(err))
+		}
+	}
+	zap.L().Info("token revoked", zap.Any("sub", claims["sub"]), zap.Any("provider", claims["provider"]))
+	return nil
+}
+
+// revoked は RevokeToken で失効させたトークン、または管理 API で jti を失効させたトークンかどうかを返す
+func (a *Authenticator) revoked(tokenString string, claims jwt.MapClaims) (bool, error) {
+	if a.Revocations == nil {
+		return false, nil
+	}
+	revoked, err := a.Revocations.Revoked(tokenID(tokenString))
+	if err != nil {
+		return false, err
+	}
+	if jti, ok := claims["jti"].(string); ok && !revoked {
+		revoked, err = a.Revocations.Revoked(jtiRevocationID(jti))
+		if err != nil {
+			return false, err
+		}
+	}
+	if revoked {
+		zap.L().Warn("token revoked", zap.String("jwt", maskedJwt(tokenString)))
+	}
+	return revoked, nil
+}
+
+// tokenID は jti のないトークンの失効リストのキー。デコードした署名のハッシュにする
+// 文字列のハッシュにすると、同じ署名にデコードされる別の文字列で失効リストを回避できてしまう
+func tokenID(tokenString string) string {
+	b := []byte(tokenString)
+	if i := strings.LastIndex(tokenString, "."); i >= 0 {
+		if sig, err := base64.RawURLEncoding.DecodeString(tokenString[i+1:]); err == nil {
+			b = sig
+		}
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// jtiRevocationID は jti で失効させる場合の失効リストのキー。tokenID と衝突しないように prefix を付ける
+func jtiRevocationID(jti string) string {
+	return "jti:" + jti
+}
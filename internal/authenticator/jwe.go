@@ -0,0 +1,96 @@
+package authenticator
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidJWE = errors.New("invalid JWE")
+
+// jweHeader は Cookie を暗号化するときの JWE の header。鍵は CookieKeys のものを kid で指すので、鍵の受け渡しはしない (alg = dir)
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+	Cty string `json:"cty,omitempty"`
+	Kid string `json:"kid"`
+}
+
+// encryptJWE は JWS を CookieKeys の現在の鍵で JWE (RFC 7516, compact serialization) に暗号化する
+func (a *Authenticator) encryptJWE(jws string) (string, error) {
+	if a.CookieKeys == nil {
+		return "", errors.New("cookie encryption key is not set")
+	}
+	key := a.CookieKeys.Current()
+	gcm := key.AEAD
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(jweHeader{Alg: "dir", Enc: "A256GCM", Cty: "JWT", Kid: key.ID})
+	if err != nil {
+		return "", err
+	}
+	header := base64.RawURLEncoding.EncodeToString(b)
+	sealed := gcm.Seal(nil, iv, []byte(jws), []byte(header))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return strings.Join([]string{
+		header,
+		"", // dir なので encrypted key は空
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// decryptJWE は encryptJWE で暗号化したトークンを復号して JWS を返す
+func (a *Authenticator) decryptJWE(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 || parts[1] != "" {
+		return "", ErrInvalidJWE
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidJWE
+	}
+	var header jweHeader
+	if err := json.Unmarshal(b, &header); err != nil || header.Alg != "dir" || header.Enc != "A256GCM" {
+		return "", ErrInvalidJWE
+	}
+	if a.CookieKeys == nil {
+		return "", ErrInvalidJWE
+	}
+	// ローテーション中の古い鍵で暗号化された Cookie も受け付ける
+	key, ok := a.CookieKeys.Lookup(header.Kid)
+	if !ok {
+		return "", ErrInvalidJWE
+	}
+
+	var decoded [3][]byte
+	for i, p := range parts[2:] {
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(p); err != nil {
+			return "", ErrInvalidJWE
+		}
+	}
+	iv, ciphertext, tag := decoded[0], decoded[1], decoded[2]
+
+	gcm := key.AEAD
+	if len(iv) != gcm.NonceSize() || len(tag) != gcm.Overhead() {
+		return "", ErrInvalidJWE
+	}
+	plain, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		// 改ざん
+		return "", ErrInvalidJWE
+	}
+	return string(plain), nil
+}
+
+// isJWE は compact serialization の JWE (5 つの部分からなる) かどうかを返す。JWS は 3 つ
+func isJWE(token string) bool {
+	return strings.Count(token, ".") == 4
+}
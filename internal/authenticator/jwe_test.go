@@ -0,0 +1,131 @@
+package authenticator
+
+import (
+	"azuki774/go-authenticator/internal/keyring"
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/util"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCookieKeys は鍵 (バイト列を fill で埋めたもの) を並べた keyring を返す。先頭の鍵で暗号化する
+func testCookieKeys(t *testing.T, fills ...byte) *keyring.AEADKeyring {
+	t.Helper()
+	var keys [][]byte
+	for _, f := range fills {
+		keys = append(keys, bytes.Repeat([]byte{f}, keyring.AEADKeySize))
+	}
+	k, err := keyring.NewAEAD(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestAuthenticator_encryptJWE(t *testing.T) {
+	a := &Authenticator{CookieKeys: testCookieKeys(t, 1)}
+	jws := "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.eyJleHAiOjk5OTk5OTk5OTksImlzcyI6InRlc3Rwcm9ncmFtIn0.sig"
+
+	jwe, err := a.encryptJWE(jws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(jwe, ".")
+	if len(parts) != 5 || parts[1] != "" {
+		t.Fatalf("encryptJWE() = %v, want 5 parts with empty encrypted key", jwe)
+	}
+	wantHeader := fmt.Sprintf(`{"alg":"dir","enc":"A256GCM","cty":"JWT","kid":"%s"}`, a.CookieKeys.Current().ID)
+	if header, _ := base64.RawURLEncoding.DecodeString(parts[0]); string(header) != wantHeader {
+		t.Errorf("header = %s, want %s", header, wantHeader)
+	}
+	if strings.Contains(jwe, "eyJleHAi") {
+		t.Errorf("claims are not encrypted: %v", jwe)
+	}
+	withHeader := func(header string) string {
+		return strings.Join([]string{base64.RawURLEncoding.EncodeToString([]byte(header)), "", parts[2], parts[3], parts[4]}, ".")
+	}
+
+	tests := []struct {
+		name    string
+		keys    *keyring.AEADKeyring
+		token   string
+		want    string
+		wantErr error
+	}{
+		{name: "ok", keys: testCookieKeys(t, 1), token: jwe, want: jws},
+		// ローテーション中は、古い鍵で暗号化された Cookie も kid で鍵を選んで復号する
+		{name: "rotated", keys: testCookieKeys(t, 2, 1), token: jwe, want: jws},
+		{name: "unknown kid", keys: testCookieKeys(t, 2), token: jwe, wantErr: ErrInvalidJWE},
+		{name: "no keys", token: jwe, wantErr: ErrInvalidJWE},
+		{name: "tampered ciphertext", keys: testCookieKeys(t, 1), token: strings.Join([]string{parts[0], "", parts[2], "AAAA" + parts[3][4:], parts[4]}, "."), wantErr: ErrInvalidJWE},
+		{name: "tampered header", keys: testCookieKeys(t, 1), token: withHeader(fmt.Sprintf(`{"alg":"dir","enc":"A256GCM","kid":"%s"}`, a.CookieKeys.Current().ID)), wantErr: ErrInvalidJWE},
+		{name: "unsupported enc", keys: testCookieKeys(t, 1), token: withHeader(fmt.Sprintf(`{"alg":"dir","enc":"A128CBC-HS256","kid":"%s"}`, a.CookieKeys.Current().ID)), wantErr: ErrInvalidJWE},
+		{name: "encrypted key", keys: testCookieKeys(t, 1), token: strings.Join([]string{parts[0], "AAAA", parts[2], parts[3], parts[4]}, "."), wantErr: ErrInvalidJWE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authenticator{CookieKeys: tt.keys}
+			got, err := a.decryptJWE(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("decryptJWE() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("decryptJWE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticator_GenerateCookie_encrypted(t *testing.T) {
+	const testBaseTime = 1721142000
+	util.NowFunc = func() time.Time { return time.Unix(testBaseTime, 0) }
+	principal := model.Principal{Provider: "github", Subject: "100000", Name: "octocat", Email: "octocat@example.com", Groups: []string{"infra"}}
+
+	a := &Authenticator{Issuer: "testprogram", HmacSecret: "super_sugoi_secret", EncryptCookie: true, CookieKeys: testCookieKeys(t, 1)}
+	// jwt の有効期限は NowFunc ではなく現在時刻で検証されるので、十分長くする
+	cookies, err := a.GenerateCookie(1<<30, principal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cookies) != 1 || !isJWE(cookies[0].Value) {
+		t.Fatalf("GenerateCookie() = %v, want a JWE cookie", cookies)
+	}
+
+	// ログインした時刻は iat から取り出す
+	wantPrincipal := principal
+	wantPrincipal.AuthTime = time.Unix(testBaseTime, 0)
+
+	// 暗号化を無効にしても、暗号化された Cookie は受け付ける
+	for _, encrypt := range []bool{true, false} {
+		t.Run(fmt.Sprintf("EncryptCookie=%v", encrypt), func(t *testing.T) {
+			a := &Authenticator{Issuer: "testprogram", HmacSecret: "super_sugoi_secret", EncryptCookie: encrypt, CookieKeys: testCookieKeys(t, 1)}
+			r := &http.Request{Header: http.Header{"Cookie": {fmt.Sprintf("%s=%s", CookieJWTName, cookies[0].Value)}}}
+			got, ok, err := a.CheckCookieJWT(r)
+			if err != nil || !ok {
+				t.Fatalf("CheckCookieJWT() = %v, %v", ok, err)
+			}
+			if !reflect.DeepEqual(got, wantPrincipal) {
+				t.Errorf("CheckCookieJWT() = %v, want %v", got, wantPrincipal)
+			}
+		})
+	}
+
+	// 平文の JWS も引き続き受け付ける
+	t.Run("plain JWS", func(t *testing.T) {
+		jws, err := a.GenerateToken(1<<30, principal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &http.Request{Header: http.Header{"Cookie": {fmt.Sprintf("%s=%s", CookieJWTName, jws)}}}
+		if _, ok, err := a.CheckCookieJWT(r); err != nil || !ok {
+			t.Errorf("CheckCookieJWT() = %v, %v", ok, err)
+		}
+	})
+}
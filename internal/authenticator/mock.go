@@ -2,7 +2,9 @@ package authenticator
 
 import (
 	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/notify"
 	"context"
+	"time"
 )
 
 type mockClientGitHub struct {
@@ -30,5 +32,124 @@ func (m *mockClientGitHub) GetUser(ctx context.Context, accessCode string) (user
 	if m.err != nil {
 		return model.GitHubUser{}, m.err
 	}
-	return model.GitHubUser{ID: 100000}, nil
+	return model.GitHubUser{ID: 100000, Login: "octocat"}, nil
+}
+
+func (m *mockClientGitHub) GetTeams(ctx context.Context, accessToken string, userID int) (teams []string, err error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return []string{"myorg/infra"}, nil
+}
+
+type mockClientGoogle struct {
+	user model.GoogleUser
+	err  error
+}
+
+func (m *mockClientGoogle) GetUser(ctx context.Context, code, nonce string) (user model.GoogleUser, err error) {
+	if m.err != nil {
+		return model.GoogleUser{}, m.err
+	}
+	return m.user, nil
+}
+
+type mockClientGitLab struct {
+	user   model.GitLabUser
+	groups []string
+	err    error
+}
+
+func (m *mockClientGitLab) GetAccessToken(ctx context.Context, code string) (res model.TokenResponse, err error) {
+	if m.err != nil {
+		return model.TokenResponse{}, m.err
+	}
+	return model.TokenResponse{AccessToken: "access_token_abcdefghijklmnopqrstuvwxyz", TokenType: "Bearer"}, nil
+}
+
+func (m *mockClientGitLab) GetUser(ctx context.Context, accessToken string) (user model.GitLabUser, err error) {
+	if m.err != nil {
+		return model.GitLabUser{}, m.err
+	}
+	return m.user, nil
+}
+
+func (m *mockClientGitLab) GetGroups(ctx context.Context, accessToken string) (groups []string, err error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.groups, nil
+}
+
+type mockClientGitea struct {
+	user   model.GiteaUser
+	groups []string
+	err    error
+}
+
+func (m *mockClientGitea) GetAccessToken(ctx context.Context, code string) (res model.TokenResponse, err error) {
+	if m.err != nil {
+		return model.TokenResponse{}, m.err
+	}
+	return model.TokenResponse{AccessToken: "access_token_abcdefghijklmnopqrstuvwxyz", TokenType: "bearer"}, nil
+}
+
+func (m *mockClientGitea) GetUser(ctx context.Context, accessToken string) (user model.GiteaUser, err error) {
+	if m.err != nil {
+		return model.GiteaUser{}, m.err
+	}
+	return m.user, nil
+}
+
+func (m *mockClientGitea) GetGroups(ctx context.Context, accessToken string) (groups []string, err error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.groups, nil
+}
+
+type mockAPIKeyStore struct {
+	keys map[string]model.APIKey // key: token
+	err  error
+}
+
+func (m *mockAPIKeyStore) Lookup(token string) (key model.APIKey, ok bool, err error) {
+	if m.err != nil {
+		return model.APIKey{}, false, m.err
+	}
+	key, ok = m.keys[token]
+	return key, ok, nil
+}
+
+func (m *mockAPIKeyStore) Touch(id string, now time.Time) error {
+	return nil
+}
+
+type mockNotifier struct {
+	events []notify.Event
+}
+
+func (m *mockNotifier) Notify(e notify.Event) {
+	m.events = append(m.events, e)
+}
+
+type mockRevocationList struct {
+	revoked map[string]time.Time
+	err     error
+}
+
+func (m *mockRevocationList) Revoke(id string, exp time.Time) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.revoked[id] = exp
+	return nil
+}
+
+func (m *mockRevocationList) Revoked(id string) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	_, ok := m.revoked[id]
+	return ok, nil
 }
@@ -1,8 +1,14 @@
 package authenticator
 
 import (
+	"azuki774/go-authenticator/internal/client"
 	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/notify"
+	"azuki774/go-authenticator/internal/util"
 	"context"
+	"errors"
+	"strconv"
+	"strings"
 
 	"go.uber.org/zap"
 )
@@ -10,33 +16,201 @@ import (
 type ClientGitHub interface {
 	GetAccessToken(ctx context.Context, code string) (res model.TokenResponse, err error)
 	GetUser(ctx context.Context, accessToken string) (user model.GitHubUser, err error)
+	GetTeams(ctx context.Context, accessToken string, userID int) (teams []string, err error)
 }
 
-func (a *Authenticator) HandlingGitHubOAuth(ctx context.Context, code string) (bool, error) {
+func (a *Authenticator) HandlingGitHubOAuth(ctx context.Context, code string) (principal model.Principal, ok bool, err error) {
 	// query parameter と client_id, client_secret からaccess_tokenを取得
 	accessInfo, err := a.ClientGitHub.GetAccessToken(ctx, code)
 	if err != nil {
+		// code が不正・期限切れの場合はサーバエラーではなく認証失敗とする
+		var oauthErr *client.OAuthError
+		if errors.As(err, &oauthErr) {
+			zap.L().Warn("code is rejected by github", zap.String("error", oauthErr.Code))
+			return model.Principal{}, false, nil
+		}
 		zap.L().Error("failed to fetch access_token", zap.Error(err))
-		return false, err
+		return model.Principal{}, false, err
 	}
 
 	accessToken := accessInfo.AccessToken
-	zap.L().Error("fetch access_token from code", zap.Error(err))
+	zap.L().Debug("fetch access_token from code")
 
 	// access_tokenからユーザーを取得
 	user, err := a.ClientGitHub.GetUser(ctx, accessToken)
 	if err != nil {
 		zap.L().Error("failed to get userid", zap.Error(err))
-		return false, err
+		return model.Principal{}, false, err
 	}
 	id := user.ID // user API のレスポンスから ID を抽出
 
 	// 登録済ユーザか判断
 	if !a.AllowGitHubList[id] {
 		zap.L().Error("this user is not allowed from config", zap.Int("id", id))
-		return false, nil
+		a.notify(ctx, notify.Event{
+			Type:     notify.TypeLoginNotAllowed,
+			Provider: "github",
+			Subject:  strconv.Itoa(id),
+			Name:     user.Login,
+			Message:  "GitHub user not in github_allow_id tried to log in",
+		})
+		return model.Principal{}, false, nil
+	}
+
+	// チームでロールを割り当てる、または認可ルールでチームを参照する設定があるときだけ所属チームを取得する
+	var teams []string
+	if a.Roles.NeedGitHubTeams() || a.Policy.NeedGroups("github") {
+		teams, err = a.ClientGitHub.GetTeams(ctx, accessToken, id)
+		if err != nil {
+			zap.L().Error("failed to get github teams", zap.Error(err))
+			return model.Principal{}, false, err
+		}
 	}
 
 	zap.L().Info("this user is authorized", zap.Int("id", id))
-	return true, nil
+	principal = model.Principal{
+		Provider: "github",
+		Subject:  strconv.Itoa(id),
+		Name:     user.Login,
+		Groups:   teams,
+	}
+	return principal, true, nil
+}
+
+// Notifier はセキュリティに関わるイベントを webhook で通知する。待たずに返る
+type Notifier interface {
+	Notify(e notify.Event)
+}
+
+// notify は ctx の送信元 IP アドレスを付けて通知する
+func (a *Authenticator) notify(ctx context.Context, e notify.Event) {
+	if a.Notifier == nil {
+		return
+	}
+	e.SourceIP, _ = util.ClientIP(ctx)
+	a.Notifier.Notify(e)
+}
+
+type ClientGoogle interface {
+	// code を引き換えて得た ID Token を検証し、その claim を返す。nonce は認可リクエストで送ったもの
+	GetUser(ctx context.Context, code, nonce string) (user model.GoogleUser, err error)
+}
+
+func (a *Authenticator) HandlingGoogleOAuth(ctx context.Context, code, nonce string) (principal model.Principal, ok bool, err error) {
+	user, err := a.ClientGoogle.GetUser(ctx, code, nonce)
+	if err != nil {
+		zap.L().Error("failed to get google user", zap.Error(err))
+		return model.Principal{}, false, err
+	}
+
+	email := strings.ToLower(user.Email)
+	if !user.EmailVerified {
+		zap.L().Warn("this email is not verified", zap.String("email", email))
+		return model.Principal{}, false, nil
+	}
+
+	// hd claim (Google Workspace のドメイン) か、メールアドレスで許可されているか判断
+	if !a.AllowGoogleDomain[strings.ToLower(user.HostedDomain)] && !a.AllowGoogleEmail[email] {
+		zap.L().Warn("this user is not allowed from config", zap.String("email", email), zap.String("hd", user.HostedDomain))
+		return model.Principal{}, false, nil
+	}
+
+	zap.L().Info("this user is authorized", zap.String("email", email))
+	principal = model.Principal{
+		Provider: "google",
+		Subject:  user.Sub,
+		Name:     user.Name,
+		Email:    email,
+	}
+	return principal, true, nil
+}
+
+type ClientGitLab interface {
+	GetAccessToken(ctx context.Context, code string) (res model.TokenResponse, err error)
+	GetUser(ctx context.Context, accessToken string) (user model.GitLabUser, err error)
+	GetGroups(ctx context.Context, accessToken string) (groups []string, err error)
+}
+
+type ClientGitea interface {
+	GetAccessToken(ctx context.Context, code string) (res model.TokenResponse, err error)
+	GetUser(ctx context.Context, accessToken string) (user model.GiteaUser, err error)
+	GetGroups(ctx context.Context, accessToken string) (groups []string, err error)
+}
+
+func (a *Authenticator) HandlingGitLabOAuth(ctx context.Context, code string) (principal model.Principal, ok bool, err error) {
+	accessInfo, err := a.ClientGitLab.GetAccessToken(ctx, code)
+	if err != nil {
+		zap.L().Error("failed to fetch access_token", zap.Error(err))
+		return model.Principal{}, false, err
+	}
+
+	user, err := a.ClientGitLab.GetUser(ctx, accessInfo.AccessToken)
+	if err != nil {
+		zap.L().Error("failed to get gitlab user", zap.Error(err))
+		return model.Principal{}, false, err
+	}
+
+	// グループで許可する、ロールを付与する、または認可ルールで参照する設定があるときだけ所属グループを取得する
+	var groups []string
+	if a.AllowGitLab.NeedGroups() || a.Roles.NeedGroups("gitlab") || a.Policy.NeedGroups("gitlab") {
+		groups, err = a.ClientGitLab.GetGroups(ctx, accessInfo.AccessToken)
+		if err != nil {
+			zap.L().Error("failed to get gitlab groups", zap.Error(err))
+			return model.Principal{}, false, err
+		}
+	}
+
+	if !a.AllowGitLab.Allowed(user.ID, user.Username, groups) {
+		zap.L().Warn("this user is not allowed from config", zap.Int("id", user.ID), zap.String("username", user.Username))
+		return model.Principal{}, false, nil
+	}
+
+	zap.L().Info("this user is authorized", zap.Int("id", user.ID), zap.String("username", user.Username))
+	principal = model.Principal{
+		Provider: "gitlab",
+		Subject:  strconv.Itoa(user.ID),
+		Name:     user.Username,
+		Email:    user.Email,
+		Groups:   groups,
+	}
+	return principal, true, nil
+}
+
+func (a *Authenticator) HandlingGiteaOAuth(ctx context.Context, code string) (principal model.Principal, ok bool, err error) {
+	accessInfo, err := a.ClientGitea.GetAccessToken(ctx, code)
+	if err != nil {
+		zap.L().Error("failed to fetch access_token", zap.Error(err))
+		return model.Principal{}, false, err
+	}
+
+	user, err := a.ClientGitea.GetUser(ctx, accessInfo.AccessToken)
+	if err != nil {
+		zap.L().Error("failed to get gitea user", zap.Error(err))
+		return model.Principal{}, false, err
+	}
+
+	// 組織で許可する、ロールを付与する、または認可ルールで参照する設定があるときだけ所属組織を取得する
+	var orgs []string
+	if a.AllowGitea.NeedGroups() || a.Roles.NeedGroups("gitea") || a.Policy.NeedGroups("gitea") {
+		orgs, err = a.ClientGitea.GetGroups(ctx, accessInfo.AccessToken)
+		if err != nil {
+			zap.L().Error("failed to get gitea organizations", zap.Error(err))
+			return model.Principal{}, false, err
+		}
+	}
+
+	if !a.AllowGitea.Allowed(user.ID, user.Login, orgs) {
+		zap.L().Warn("this user is not allowed from config", zap.Int("id", user.ID), zap.String("username", user.Login))
+		return model.Principal{}, false, nil
+	}
+
+	zap.L().Info("this user is authorized", zap.Int("id", user.ID), zap.String("username", user.Login))
+	principal = model.Principal{
+		Provider: "gitea",
+		Subject:  strconv.Itoa(user.ID),
+		Name:     user.Login,
+		Email:    user.Email,
+		Groups:   orgs,
+	}
+	return principal, true, nil
 }
@@ -1,8 +1,14 @@
 package authenticator
 
 import (
+	"azuki774/go-authenticator/internal/client"
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/notify"
+	"azuki774/go-authenticator/internal/policy"
+	"azuki774/go-authenticator/internal/util"
 	"context"
 	"errors"
+	"reflect"
 	"testing"
 )
 
@@ -13,17 +19,21 @@ func TestAuthenticator_HandlingGitHubOAuth(t *testing.T) {
 		HmacSecret      string
 		AllowGitHubList map[int]bool
 		ClientGitHub    ClientGitHub
+		Roles           policy.Roles
+		Policy          *policy.Policy
 	}
 	type args struct {
 		ctx  context.Context
 		code string
 	}
 	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		want    bool
-		wantErr bool
+		name          string
+		fields        fields
+		args          args
+		wantPrincipal model.Principal
+		want          bool
+		wantErr       bool
+		wantNotified  []notify.Event
 	}{
 		{
 			name: "ok",
@@ -35,8 +45,39 @@ func TestAuthenticator_HandlingGitHubOAuth(t *testing.T) {
 				ctx:  context.Background(),
 				code: "0123456789abcdef",
 			},
-			want:    true,
-			wantErr: false,
+			wantPrincipal: model.Principal{Provider: "github", Subject: "100000", Name: "octocat"},
+			want:          true,
+			wantErr:       false,
+		},
+		{
+			name: "ok with teams",
+			fields: fields{
+				AllowGitHubList: map[int]bool{100000: true},
+				ClientGitHub:    &mockClientGitHub{},
+				Roles:           policy.Roles{{Role: "admin", GitHubTeams: []string{"myorg/infra"}}},
+			},
+			args: args{
+				ctx:  context.Background(),
+				code: "0123456789abcdef",
+			},
+			wantPrincipal: model.Principal{Provider: "github", Subject: "100000", Name: "octocat", Groups: []string{"myorg/infra"}},
+			want:          true,
+			wantErr:       false,
+		},
+		{
+			name: "ok with teams for policy",
+			fields: fields{
+				AllowGitHubList: map[int]bool{100000: true},
+				ClientGitHub:    &mockClientGitHub{},
+				Policy:          &policy.Policy{Rules: []policy.Rule{{Groups: []string{"github:myorg/infra"}}}},
+			},
+			args: args{
+				ctx:  context.Background(),
+				code: "0123456789abcdef",
+			},
+			wantPrincipal: model.Principal{Provider: "github", Subject: "100000", Name: "octocat", Groups: []string{"myorg/infra"}},
+			want:          true,
+			wantErr:       false,
 		},
 		{
 			name: "unknown user",
@@ -44,6 +85,22 @@ func TestAuthenticator_HandlingGitHubOAuth(t *testing.T) {
 				AllowGitHubList: map[int]bool{100001: true},
 				ClientGitHub:    &mockClientGitHub{},
 			},
+			args: args{
+				ctx:  util.WithClientIP(context.Background(), "192.0.2.1"),
+				code: "0123456789abcdef",
+			},
+			want:    false,
+			wantErr: false,
+			wantNotified: []notify.Event{
+				{Type: notify.TypeLoginNotAllowed, Provider: "github", Subject: "100000", Name: "octocat", SourceIP: "192.0.2.1", Message: "GitHub user not in github_allow_id tried to log in"},
+			},
+		},
+		{
+			name: "bad verification code",
+			fields: fields{
+				AllowGitHubList: map[int]bool{100000: true},
+				ClientGitHub:    &mockClientGitHub{err: &client.OAuthError{Code: "bad_verification_code"}},
+			},
 			args: args{
 				ctx:  context.Background(),
 				code: "0123456789abcdef",
@@ -73,8 +130,11 @@ func TestAuthenticator_HandlingGitHubOAuth(t *testing.T) {
 				HmacSecret:      tt.fields.HmacSecret,
 				AllowGitHubList: tt.fields.AllowGitHubList,
 				ClientGitHub:    tt.fields.ClientGitHub,
+				Roles:           tt.fields.Roles,
+				Policy:          tt.fields.Policy,
+				Notifier:        &mockNotifier{},
 			}
-			got, err := a.HandlingGitHubOAuth(tt.args.ctx, tt.args.code)
+			gotPrincipal, got, err := a.HandlingGitHubOAuth(tt.args.ctx, tt.args.code)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Authenticator.HandlingGitHubOAuth() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -82,6 +142,295 @@ func TestAuthenticator_HandlingGitHubOAuth(t *testing.T) {
 			if got != tt.want {
 				t.Errorf("Authenticator.HandlingGitHubOAuth() = %v, want %v", got, tt.want)
 			}
+			if !reflect.DeepEqual(gotPrincipal, tt.wantPrincipal) {
+				t.Errorf("Authenticator.HandlingGitHubOAuth() principal = %v, want %v", gotPrincipal, tt.wantPrincipal)
+			}
+			if got := a.Notifier.(*mockNotifier).events; !reflect.DeepEqual(got, tt.wantNotified) {
+				t.Errorf("Authenticator.HandlingGitHubOAuth() notified = %v, want %v", got, tt.wantNotified)
+			}
+		})
+	}
+}
+
+func TestAuthenticator_HandlingGoogleOAuth(t *testing.T) {
+	type fields struct {
+		AllowGoogleDomain map[string]bool
+		AllowGoogleEmail  map[string]bool
+		ClientGoogle      ClientGoogle
+	}
+	type args struct {
+		ctx  context.Context
+		code string
+	}
+	tests := []struct {
+		name          string
+		fields        fields
+		args          args
+		wantPrincipal model.Principal
+		want          bool
+		wantErr       bool
+	}{
+		{
+			name: "ok (hosted domain)",
+			fields: fields{
+				AllowGoogleDomain: map[string]bool{"example.com": true},
+				ClientGoogle: &mockClientGoogle{user: model.GoogleUser{
+					Sub: "1234567890", Email: "Alice@example.com", EmailVerified: true, HostedDomain: "example.com", Name: "Alice",
+				}},
+			},
+			args: args{ctx: context.Background(), code: "0123456789abcdef"},
+			wantPrincipal: model.Principal{
+				Provider: "google", Subject: "1234567890", Name: "Alice", Email: "alice@example.com",
+			},
+			want:    true,
+			wantErr: false,
+		},
+		{
+			name: "ok (email)",
+			fields: fields{
+				AllowGoogleDomain: map[string]bool{"example.com": true},
+				AllowGoogleEmail:  map[string]bool{"bob@gmail.com": true},
+				ClientGoogle: &mockClientGoogle{user: model.GoogleUser{
+					Sub: "2345678901", Email: "bob@gmail.com", EmailVerified: true, Name: "Bob",
+				}},
+			},
+			args: args{ctx: context.Background(), code: "0123456789abcdef"},
+			wantPrincipal: model.Principal{
+				Provider: "google", Subject: "2345678901", Name: "Bob", Email: "bob@gmail.com",
+			},
+			want:    true,
+			wantErr: false,
+		},
+		{
+			name: "email not verified",
+			fields: fields{
+				AllowGoogleDomain: map[string]bool{"example.com": true},
+				ClientGoogle: &mockClientGoogle{user: model.GoogleUser{
+					Sub: "1234567890", Email: "alice@example.com", EmailVerified: false, HostedDomain: "example.com",
+				}},
+			},
+			args:    args{ctx: context.Background(), code: "0123456789abcdef"},
+			want:    false,
+			wantErr: false,
+		},
+		{
+			name: "email domain without hd claim",
+			fields: fields{
+				AllowGoogleDomain: map[string]bool{"example.com": true},
+				ClientGoogle: &mockClientGoogle{user: model.GoogleUser{
+					Sub: "1234567890", Email: "alice@example.com", EmailVerified: true,
+				}},
+			},
+			args:    args{ctx: context.Background(), code: "0123456789abcdef"},
+			want:    false,
+			wantErr: false,
+		},
+		{
+			name: "google error",
+			fields: fields{
+				AllowGoogleDomain: map[string]bool{"example.com": true},
+				ClientGoogle:      &mockClientGoogle{err: errors.New("something error")},
+			},
+			args:    args{ctx: context.Background(), code: "0123456789abcdef"},
+			want:    false,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authenticator{
+				AllowGoogleDomain: tt.fields.AllowGoogleDomain,
+				AllowGoogleEmail:  tt.fields.AllowGoogleEmail,
+				ClientGoogle:      tt.fields.ClientGoogle,
+			}
+			gotPrincipal, got, err := a.HandlingGoogleOAuth(tt.args.ctx, tt.args.code, "nonce")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Authenticator.HandlingGoogleOAuth() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Authenticator.HandlingGoogleOAuth() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(gotPrincipal, tt.wantPrincipal) {
+				t.Errorf("Authenticator.HandlingGoogleOAuth() principal = %v, want %v", gotPrincipal, tt.wantPrincipal)
+			}
+		})
+	}
+}
+
+func TestAuthenticator_HandlingGitLabOAuth(t *testing.T) {
+	gitlabUser := model.GitLabUser{ID: 200000, Username: "alice", Email: "alice@example.com"}
+	tests := []struct {
+		name          string
+		allow         AllowList
+		roles         policy.Roles
+		policy        *policy.Policy
+		client        ClientGitLab
+		wantPrincipal model.Principal
+		want          bool
+		wantErr       bool
+	}{
+		{
+			name:          "ok (id)",
+			allow:         AllowList{IDs: map[int]bool{200000: true}},
+			client:        &mockClientGitLab{user: gitlabUser},
+			wantPrincipal: model.Principal{Provider: "gitlab", Subject: "200000", Name: "alice", Email: "alice@example.com"},
+			want:          true,
+			wantErr:       false,
+		},
+		{
+			name:          "ok (username)",
+			allow:         AllowList{Usernames: map[string]bool{"alice": true}},
+			client:        &mockClientGitLab{user: gitlabUser},
+			wantPrincipal: model.Principal{Provider: "gitlab", Subject: "200000", Name: "alice", Email: "alice@example.com"},
+			want:          true,
+			wantErr:       false,
+		},
+		{
+			name:          "ok (group)",
+			allow:         AllowList{Groups: map[string]bool{"infra/sre": true}},
+			client:        &mockClientGitLab{user: gitlabUser, groups: []string{"dev", "infra/sre"}},
+			wantPrincipal: model.Principal{Provider: "gitlab", Subject: "200000", Name: "alice", Email: "alice@example.com", Groups: []string{"dev", "infra/sre"}},
+			want:          true,
+			wantErr:       false,
+		},
+		{
+			name:          "groups for roles",
+			allow:         AllowList{IDs: map[int]bool{200000: true}},
+			roles:         policy.Roles{{Role: "sre", Groups: []string{"gitlab:infra/sre"}}},
+			client:        &mockClientGitLab{user: gitlabUser, groups: []string{"dev", "infra/sre"}},
+			wantPrincipal: model.Principal{Provider: "gitlab", Subject: "200000", Name: "alice", Email: "alice@example.com", Groups: []string{"dev", "infra/sre"}},
+			want:          true,
+			wantErr:       false,
+		},
+		{
+			name:          "groups for policy",
+			allow:         AllowList{IDs: map[int]bool{200000: true}},
+			policy:        &policy.Policy{Rules: []policy.Rule{{Groups: []string{"gitlab:infra/sre"}}}},
+			client:        &mockClientGitLab{user: gitlabUser, groups: []string{"dev", "infra/sre"}},
+			wantPrincipal: model.Principal{Provider: "gitlab", Subject: "200000", Name: "alice", Email: "alice@example.com", Groups: []string{"dev", "infra/sre"}},
+			want:          true,
+			wantErr:       false,
+		},
+		{
+			name:          "groups for another provider's roles",
+			allow:         AllowList{IDs: map[int]bool{200000: true}},
+			roles:         policy.Roles{{Role: "sre", Groups: []string{"gitea:infra"}}},
+			client:        &mockClientGitLab{user: gitlabUser, groups: []string{"dev", "infra/sre"}},
+			wantPrincipal: model.Principal{Provider: "gitlab", Subject: "200000", Name: "alice", Email: "alice@example.com"},
+			want:          true,
+			wantErr:       false,
+		},
+		{
+			name:    "unknown user",
+			allow:   AllowList{IDs: map[int]bool{200001: true}, Groups: map[string]bool{"infra/sre": true}},
+			client:  &mockClientGitLab{user: gitlabUser, groups: []string{"dev"}},
+			want:    false,
+			wantErr: false,
+		},
+		{
+			name:    "gitlab error",
+			allow:   AllowList{IDs: map[int]bool{200000: true}},
+			client:  &mockClientGitLab{err: errors.New("something error")},
+			want:    false,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authenticator{
+				AllowGitLab:  tt.allow,
+				Roles:        tt.roles,
+				Policy:       tt.policy,
+				ClientGitLab: tt.client,
+			}
+			gotPrincipal, got, err := a.HandlingGitLabOAuth(context.Background(), "0123456789abcdef")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Authenticator.HandlingGitLabOAuth() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Authenticator.HandlingGitLabOAuth() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(gotPrincipal, tt.wantPrincipal) {
+				t.Errorf("Authenticator.HandlingGitLabOAuth() principal = %v, want %v", gotPrincipal, tt.wantPrincipal)
+			}
+		})
+	}
+}
+
+func TestAuthenticator_HandlingGiteaOAuth(t *testing.T) {
+	giteaUser := model.GiteaUser{ID: 300000, Login: "bob", Email: "bob@example.com"}
+	tests := []struct {
+		name          string
+		allow         AllowList
+		roles         policy.Roles
+		policy        *policy.Policy
+		client        ClientGitea
+		wantPrincipal model.Principal
+		want          bool
+		wantErr       bool
+	}{
+		{
+			name:          "ok (organization)",
+			allow:         AllowList{Groups: map[string]bool{"infra": true}},
+			client:        &mockClientGitea{user: giteaUser, groups: []string{"infra"}},
+			wantPrincipal: model.Principal{Provider: "gitea", Subject: "300000", Name: "bob", Email: "bob@example.com", Groups: []string{"infra"}},
+			want:          true,
+			wantErr:       false,
+		},
+		{
+			name:          "organizations for roles",
+			allow:         AllowList{Usernames: map[string]bool{"bob": true}},
+			roles:         policy.Roles{{Role: "infra", Groups: []string{"gitea:infra"}}},
+			client:        &mockClientGitea{user: giteaUser, groups: []string{"infra"}},
+			wantPrincipal: model.Principal{Provider: "gitea", Subject: "300000", Name: "bob", Email: "bob@example.com", Groups: []string{"infra"}},
+			want:          true,
+			wantErr:       false,
+		},
+		{
+			name:          "organizations for policy",
+			allow:         AllowList{Usernames: map[string]bool{"bob": true}},
+			policy:        &policy.Policy{Rules: []policy.Rule{{Groups: []string{"gitea:infra"}}}},
+			client:        &mockClientGitea{user: giteaUser, groups: []string{"infra"}},
+			wantPrincipal: model.Principal{Provider: "gitea", Subject: "300000", Name: "bob", Email: "bob@example.com", Groups: []string{"infra"}},
+			want:          true,
+			wantErr:       false,
+		},
+		{
+			name:    "unknown user",
+			allow:   AllowList{Usernames: map[string]bool{"alice": true}},
+			client:  &mockClientGitea{user: giteaUser},
+			want:    false,
+			wantErr: false,
+		},
+		{
+			name:    "gitea error",
+			allow:   AllowList{Usernames: map[string]bool{"bob": true}},
+			client:  &mockClientGitea{err: errors.New("something error")},
+			want:    false,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authenticator{
+				AllowGitea:  tt.allow,
+				Roles:       tt.roles,
+				Policy:      tt.policy,
+				ClientGitea: tt.client,
+			}
+			gotPrincipal, got, err := a.HandlingGiteaOAuth(context.Background(), "0123456789abcdef")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Authenticator.HandlingGiteaOAuth() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Authenticator.HandlingGiteaOAuth() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(gotPrincipal, tt.wantPrincipal) {
+				t.Errorf("Authenticator.HandlingGiteaOAuth() principal = %v, want %v", gotPrincipal, tt.wantPrincipal)
+			}
 		})
 	}
 }
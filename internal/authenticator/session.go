@@ -0,0 +1,66 @@
+package authenticator
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/session"
+	"azuki774/go-authenticator/internal/util"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// SessionManager はサーバ側のセッションを管理する。Cookie には JWT の代わりにセッションの token を入れる
+type SessionManager interface {
+	Create(principal model.Principal) (token string, err error)
+	Lookup(token string, ip string) (s session.Session, ok bool, err error)
+	Delete(token string) error
+	List() ([]session.Session, error)
+	Revoke(id string) (found bool, err error)
+	RevokeUser(provider, subject string) (int, error)
+}
+
+// generateSessionCookie はセッションを作成し、その token を入れた Cookie を返す
+func (a *Authenticator) generateSessionCookie(life int, principal model.Principal) ([]*http.Cookie, error) {
+	// JWT の roles claim と同じく、ログインした時点のロールを保存する
+	principal.Roles = a.Roles.Resolve(principal)
+	token, err := a.Sessions.Create(principal)
+	if err != nil {
+		zap.L().Error("failed to create session", zap.Error(err))
+		return nil, err
+	}
+	return a.cookieConfig().Cookies(token, life), nil
+}
+
+// checkSession は Cookie の token でセッションを検索する
+func (a *Authenticator) checkSession(r *http.Request, token string) (principal model.Principal, ok bool, err error) {
+	if strings.Contains(token, ".") {
+		// セッションを使う前に発行した JWT の Cookie
+		zap.L().Info("JWT cookie is not accepted in session mode")
+		return model.Principal{}, false, nil
+	}
+	ip, _ := util.ClientIP(r.Context())
+	s, ok, err := a.Sessions.Lookup(token, ip)
+	if err != nil || !ok {
+		return model.Principal{}, false, err
+	}
+	zap.L().Info("check session ok")
+	principal = s.Principal
+	principal.AuthTime = s.CreatedAt
+	return principal, true, nil
+}
+
+// Logout は Cookie のセッションを削除する。JWT の Cookie の場合は、失効リストがあればそのトークンを失効させる
+func (a *Authenticator) Logout(r *http.Request) error {
+	token, ok := a.cookieConfig().Value(r)
+	if !ok {
+		return nil
+	}
+	if a.Sessions != nil {
+		return a.Sessions.Delete(token)
+	}
+	if a.Revocations != nil {
+		return a.RevokeToken(token)
+	}
+	return nil
+}
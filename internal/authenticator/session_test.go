@@ -0,0 +1,85 @@
+package authenticator
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/policy"
+	"azuki774/go-authenticator/internal/session"
+	"azuki774/go-authenticator/internal/util"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAuthenticator_GenerateCookie_session(t *testing.T) {
+	const testBaseTime = 1721142000
+	util.NowFunc = func() time.Time { return time.Unix(testBaseTime, 0) }
+	defer func() { util.NowFunc = time.Now }()
+	principal := model.Principal{Provider: "github", Subject: "100000", Name: "octocat", Groups: []string{"infra"}}
+	sessions := session.NewManager(session.NewMemoryStore())
+	a := &Authenticator{
+		Issuer:     "testprogram",
+		HmacSecret: "super_sugoi_secret",
+		Roles:      policy.Roles{{Role: "admin", Users: []string{"github:100000"}}},
+		Sessions:   sessions,
+	}
+
+	cookies, err := a.GenerateCookie(3600, principal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cookies) != 1 || cookies[0].MaxAge != 3600 {
+		t.Fatalf("GenerateCookie() = %v, want a session cookie", cookies)
+	}
+	token := cookies[0].Value
+
+	jwt, err := a.GenerateToken(1<<30, principal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantPrincipal := principal
+	wantPrincipal.Roles = []string{"admin"}
+	wantPrincipal.AuthTime = time.Unix(testBaseTime, 0) // セッションの作成時刻
+	tests := []struct {
+		name          string
+		cookie        string
+		wantPrincipal model.Principal
+		wantOK        bool
+	}{
+		{name: "session", cookie: token, wantPrincipal: wantPrincipal, wantOK: true},
+		{name: "unknown session", cookie: "unknown", wantOK: false},
+		// セッションを使う場合は、有効な JWT でも Cookie としては受け付けない
+		{name: "JWT", cookie: jwt, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{Header: http.Header{"Cookie": {fmt.Sprintf("%s=%s", CookieJWTName, tt.cookie)}}}
+			r = r.WithContext(util.WithClientIP(r.Context(), "192.0.2.1"))
+			got, ok, err := a.CheckCookieJWT(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("CheckCookieJWT() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !reflect.DeepEqual(got, tt.wantPrincipal) {
+				t.Errorf("CheckCookieJWT() = %v, want %v", got, tt.wantPrincipal)
+			}
+		})
+	}
+
+	if s, ok, _ := sessions.Lookup(token, ""); !ok || s.IP != "192.0.2.1" {
+		t.Errorf("session IP = %v, want 192.0.2.1", s.IP)
+	}
+
+	// ログアウトするとセッションは使えなくなる
+	r := &http.Request{Header: http.Header{"Cookie": {fmt.Sprintf("%s=%s", CookieJWTName, token)}}}
+	if err := a.Logout(r); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := a.CheckCookieJWT(r); ok || err != nil {
+		t.Errorf("CheckCookieJWT() after Logout = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// GitHub API のキャッシュのヒット率。/debug/vars で参照できる
+var (
+	githubCacheStats   = expvar.NewMap("github_cache")
+	githubCacheHitRate = expvar.NewFloat("github_cache_hit_rate")
+)
+
+// responseCacheMaxEntries を超えたら古いエントリから捨てる
+const responseCacheMaxEntries = 1000
+
+// responseCache は API のレスポンスを TTL 付きで保持する
+// TTL が切れたエントリも ETag があれば条件付きリクエスト (If-None-Match) の再検証に使う
+type responseCache struct {
+	ttl        time.Duration
+	maxEntries int
+	mu         sync.Mutex
+	entries    map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{ttl: ttl, maxEntries: responseCacheMaxEntries, entries: make(map[string]cacheEntry)}
+}
+
+// get は key のエントリと、それが TTL 内かどうかを返す
+func (c *responseCache) get(key string) (entry cacheEntry, fresh bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok = c.entries[key]
+	if !ok {
+		return cacheEntry{}, false, false
+	}
+	return entry, util.NowFunc().Before(entry.expires), true
+}
+
+func (c *responseCache) set(key string, body []byte, etag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		c.evict()
+	}
+	c.entries[key] = cacheEntry{body: body, etag: etag, expires: util.NowFunc().Add(c.ttl)}
+}
+
+// 期限を延長する (304 Not Modified のとき)
+func (c *responseCache) refresh(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.expires = util.NowFunc().Add(c.ttl)
+		c.entries[key] = e
+	}
+}
+
+// evict は TTL 切れのエントリを捨てる。それでも空きがなければ一番期限の近いエントリを捨てる
+// c.mu を取得した状態で呼ぶ
+func (c *responseCache) evict() {
+	now := util.NowFunc()
+	var oldestKey string
+	var oldest time.Time
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+			continue
+		}
+		if oldestKey == "" || e.expires.Before(oldest) {
+			oldestKey, oldest = k, e.expires
+		}
+	}
+	if len(c.entries) >= c.maxEntries {
+		delete(c.entries, oldestKey)
+	}
+}
+
+func recordCacheStat(name string) {
+	githubCacheStats.Add(name, 1)
+
+	var hit, total int64
+	githubCacheStats.Do(func(kv expvar.KeyValue) {
+		v := kv.Value.(*expvar.Int).Value()
+		total += v
+		if kv.Key == "hit" || kv.Key == "revalidated" {
+			hit += v
+		}
+	})
+	if total > 0 {
+		githubCacheHitRate.Set(float64(hit) / float64(total))
+	}
+}
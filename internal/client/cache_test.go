@@ -0,0 +1,204 @@
+package client
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newETagGitHub は ETag による条件付きリクエストに対応した user / teams API を返すテスト用サーバ
+func newETagGitHub(t *testing.T, calls *int, notModified *int) *httptest.Server {
+	t.Helper()
+	const etag = `W/"0123456789abcdef"`
+	mux := http.NewServeMux()
+	handle := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			*calls++
+			if r.Header.Get("If-None-Match") == etag {
+				*notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			w.Write([]byte(body))
+		}
+	}
+	mux.HandleFunc("/user", handle(`{"login":"octocat","id":100000}`))
+	mux.HandleFunc("/user/teams", handle(`[{"id":1,"slug":"infra","organization":{"login":"myorg"}},{"id":2,"slug":"dev","organization":{"login":"myorg"}}]`))
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestClientGitHub_cache(t *testing.T) {
+	now := time.Unix(1721142000, 0)
+	util.NowFunc = func() time.Time { return now }
+	defer func() { util.NowFunc = time.Now }()
+
+	var calls, notModified int
+	s := newETagGitHub(t, &calls, &notModified)
+	c := NewClientGitHub(s.URL, s.URL)
+	c.HTTPClient = s.Client()
+	c.SetCacheTTL(time.Minute)
+	ctx := context.Background()
+
+	// 1回目は API を呼ぶ
+	teams, err := c.GetTeams(ctx, "gho_stub", 100000)
+	if err != nil {
+		t.Fatalf("ClientGitHub.GetTeams() error = %v", err)
+	}
+	if !reflect.DeepEqual(teams, []string{"myorg/infra", "myorg/dev"}) {
+		t.Errorf("ClientGitHub.GetTeams() = %v", teams)
+	}
+
+	// TTL 内はキャッシュから返す
+	if _, err := c.GetTeams(ctx, "gho_another", 100000); err != nil {
+		t.Fatalf("ClientGitHub.GetTeams() error = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %v, want 1", calls)
+	}
+
+	// TTL が切れたら If-None-Match で再検証する
+	now = now.Add(2 * time.Minute)
+	teams, err = c.GetTeams(ctx, "gho_stub", 100000)
+	if err != nil {
+		t.Fatalf("ClientGitHub.GetTeams() error = %v", err)
+	}
+	if calls != 2 || notModified != 1 {
+		t.Errorf("calls = %v, notModified = %v, want 2, 1", calls, notModified)
+	}
+	if !reflect.DeepEqual(teams, []string{"myorg/infra", "myorg/dev"}) {
+		t.Errorf("ClientGitHub.GetTeams() = %v", teams)
+	}
+
+	// 別のユーザはキャッシュされていない
+	if _, err := c.GetTeams(ctx, "gho_stub", 100001); err != nil {
+		t.Fatalf("ClientGitHub.GetTeams() error = %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %v, want 3", calls)
+	}
+}
+
+func TestClientGitHub_GetUser_notCached(t *testing.T) {
+	var calls, notModified int
+	s := newETagGitHub(t, &calls, &notModified)
+	c := NewClientGitHub(s.URL, s.URL)
+	c.HTTPClient = s.Client()
+	c.SetCacheTTL(time.Minute)
+
+	// 別のユーザの access_token でも同じ結果を返さないよう、/user は毎回 API を呼ぶ
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetUser(context.Background(), "gho_stub"); err != nil {
+			t.Fatalf("ClientGitHub.GetUser() error = %v", err)
+		}
+	}
+	if calls != 2 || notModified != 0 {
+		t.Errorf("calls = %v, notModified = %v, want 2, 0", calls, notModified)
+	}
+	if len(c.cache.entries) != 0 {
+		t.Errorf("cache entries = %v, want 0", len(c.cache.entries))
+	}
+}
+
+func Test_responseCache_evict(t *testing.T) {
+	now := time.Unix(1721142000, 0)
+	util.NowFunc = func() time.Time { return now }
+	defer func() { util.NowFunc = time.Now }()
+
+	c := newResponseCache(time.Minute)
+	c.maxEntries = 2
+
+	c.set("a", []byte("a"), "")
+	now = now.Add(10 * time.Second)
+	c.set("b", []byte("b"), "")
+	now = now.Add(10 * time.Second)
+
+	// 上限に達したら一番期限の近い a を捨てる
+	c.set("c", []byte("c"), "")
+	if _, _, ok := c.get("a"); ok {
+		t.Errorf("a is not evicted")
+	}
+	if len(c.entries) != 2 {
+		t.Errorf("entries = %v, want 2", len(c.entries))
+	}
+
+	// TTL 切れのエントリはまとめて捨てる
+	now = now.Add(2 * time.Minute)
+	c.set("d", []byte("d"), "")
+	if len(c.entries) != 1 {
+		t.Errorf("entries = %v, want 1", len(c.entries))
+	}
+	if _, _, ok := c.get("d"); !ok {
+		t.Errorf("d is not cached")
+	}
+}
+
+func TestClientGitHub_cacheDisabled(t *testing.T) {
+	var calls, notModified int
+	s := newETagGitHub(t, &calls, &notModified)
+	c := NewClientGitHub(s.URL, s.URL)
+	c.HTTPClient = s.Client()
+	c.SetCacheTTL(0)
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetTeams(context.Background(), "gho_stub", 100000); err != nil {
+			t.Fatalf("ClientGitHub.GetTeams() error = %v", err)
+		}
+	}
+	if calls != 2 || notModified != 0 {
+		t.Errorf("calls = %v, notModified = %v, want 2, 0", calls, notModified)
+	}
+}
+
+func TestClientGitHub_rateLimit(t *testing.T) {
+	now := time.Unix(1721142000, 0)
+	util.NowFunc = func() time.Time { return now }
+	defer func() { util.NowFunc = time.Now }()
+
+	var calls int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(10*time.Minute).Unix(), 10))
+		w.Write([]byte(`{"login":"octocat","id":100000}`))
+	}))
+	defer s.Close()
+	c := NewClientGitHub(s.URL, s.URL)
+	c.HTTPClient = s.Client()
+	c.SetCacheTTL(0)
+
+	// 残り 0 になったレスポンス自体は成功する
+	if _, err := c.GetUser(context.Background(), "gho_stub"); err != nil {
+		t.Fatalf("ClientGitHub.GetUser() error = %v", err)
+	}
+
+	// reset までは API を呼ばずにエラーを返す
+	_, err := c.GetUser(context.Background(), "gho_stub")
+	var rateLimitErr *RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		t.Fatalf("ClientGitHub.GetUser() error = %v, want RateLimitError", err)
+	}
+	if !rateLimitErr.Until.Equal(now.Add(10 * time.Minute)) {
+		t.Errorf("RateLimitError.Until = %v", rateLimitErr.Until)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %v, want 1", calls)
+	}
+
+	// reset 後は再び API を呼ぶ
+	now = now.Add(11 * time.Minute)
+	if _, err := c.GetUser(context.Background(), "gho_stub"); err != nil {
+		t.Fatalf("ClientGitHub.GetUser() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %v, want 2", calls)
+	}
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// OAuthError は token endpoint が返した OAuth2 のエラーレスポンス
+// GitHub は status 200 で {"error":"bad_verification_code"} のように返すことがある
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	URI         string `json:"error_uri"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("oauth error: %s (%s)", e.Code, e.Description)
+	}
+	return fmt.Sprintf("oauth error: %s", e.Code)
+}
+
+// StatusError は API が 2xx 以外のステータスを返したときのエラー
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status from %s: %d", e.URL, e.StatusCode)
+}
+
+// RateLimitError は API の rate limit に達していて、Until まではリクエストを送らないときのエラー
+type RateLimitError struct {
+	Until time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("github api rate limit exceeded, retry after %s", e.Until.Format(time.RFC3339))
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	giteaOrgsPerPage = 50  // Gitea の既定の MAX_RESPONSE_ITEMS
+	giteaOrgsMaxPage = 100 // 応答がおかしい場合に無限に取得し続けないための上限
+)
+
+// ClientGitea は Gitea / Forgejo 用のクライアント
+type ClientGitea struct {
+	AuthConf   *oauth2.Config
+	BaseURL    string // e.g. https://gitea.example.com
+	HTTPClient *http.Client
+}
+
+func NewClientGitea(baseURL string, redirectURL string) *ClientGitea {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	conf := &oauth2.Config{
+		ClientID:     os.Getenv("GITEA_CLIENT_ID"),
+		ClientSecret: os.Getenv("GITEA_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"read:user", "read:organization"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   baseURL + "/login/oauth/authorize",
+			TokenURL:  baseURL + "/login/oauth/access_token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+
+	return &ClientGitea{
+		AuthConf:   conf,
+		BaseURL:    baseURL,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *ClientGitea) GetAccessToken(ctx context.Context, code string) (res model.TokenResponse, err error) {
+	return exchangeCode(ctx, c.AuthConf, c.HTTPClient, code)
+}
+
+func (c *ClientGitea) GetUser(ctx context.Context, accessToken string) (user model.GiteaUser, err error) {
+	if err := getJSON(ctx, c.HTTPClient, c.BaseURL+"/api/v1/user", accessToken, &user); err != nil {
+		return model.GiteaUser{}, err
+	}
+	return user, nil
+}
+
+// GetGroups は所属している組織名を返す
+// サーバ側の MAX_RESPONSE_ITEMS で 1 ページの件数が limit より少なくなることがあるので、空のページが返るまで取得する
+func (c *ClientGitea) GetGroups(ctx context.Context, accessToken string) (groups []string, err error) {
+	for page := 1; page <= giteaOrgsMaxPage; page++ {
+		var orgs []model.GiteaOrganization
+		url := fmt.Sprintf("%s/api/v1/user/orgs?limit=%d&page=%d", c.BaseURL, giteaOrgsPerPage, page)
+		if err := getJSON(ctx, c.HTTPClient, url, accessToken, &orgs); err != nil {
+			return nil, err
+		}
+		if len(orgs) == 0 {
+			return groups, nil
+		}
+		for _, o := range orgs {
+			groups = append(groups, o.Name)
+		}
+	}
+	return nil, fmt.Errorf("gitea: too many organizations (more than %d pages)", giteaOrgsMaxPage)
+}
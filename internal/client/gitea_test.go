@@ -0,0 +1,69 @@
+package client
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func newFakeGitea(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("code") != "valid_code" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"gitea-stub","token_type":"bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/api/v1/user", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":300000,"login":"bob","full_name":"Bob","email":"bob@example.com","active":true}`))
+	})
+	mux.HandleFunc("/api/v1/user/orgs", func(w http.ResponseWriter, r *http.Request) {
+		// MAX_RESPONSE_ITEMS = 2 のサーバとして、limit より少ない件数でページを分ける
+		orgs := []model.GiteaOrganization{{ID: 1, Name: "infra", FullName: "Infrastructure"}, {ID: 2, Name: "dev"}, {ID: 3, Name: "ops"}}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		start := min((page-1)*2, len(orgs))
+		end := min(start+2, len(orgs))
+		json.NewEncoder(w).Encode(orgs[start:end])
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestClientGitea(t *testing.T) {
+	s := newFakeGitea(t)
+	c := NewClientGitea(s.URL, "https://auth.example.com/callback/gitea")
+	c.HTTPClient = s.Client()
+	ctx := context.Background()
+
+	token, err := c.GetAccessToken(ctx, "valid_code")
+	if err != nil {
+		t.Fatalf("ClientGitea.GetAccessToken() error = %v", err)
+	}
+
+	user, err := c.GetUser(ctx, token.AccessToken)
+	if err != nil {
+		t.Fatalf("ClientGitea.GetUser() error = %v", err)
+	}
+	wantUser := model.GiteaUser{ID: 300000, Login: "bob", FullName: "Bob", Email: "bob@example.com", Active: true}
+	if !reflect.DeepEqual(user, wantUser) {
+		t.Errorf("ClientGitea.GetUser() = %v, want %v", user, wantUser)
+	}
+
+	orgs, err := c.GetGroups(ctx, token.AccessToken)
+	if err != nil {
+		t.Fatalf("ClientGitea.GetGroups() error = %v", err)
+	}
+	if !reflect.DeepEqual(orgs, []string{"infra", "dev", "ops"}) {
+		t.Errorf("ClientGitea.GetGroups() = %v", orgs)
+	}
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const gitlabDefaultBaseURL = "https://gitlab.com"
+
+type ClientGitLab struct {
+	AuthConf   *oauth2.Config
+	BaseURL    string // e.g. https://gitlab.example.com
+	HTTPClient *http.Client
+}
+
+func NewClientGitLab(baseURL string, redirectURL string) *ClientGitLab {
+	if baseURL == "" {
+		baseURL = gitlabDefaultBaseURL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	conf := &oauth2.Config{
+		ClientID:     os.Getenv("GITLAB_CLIENT_ID"),
+		ClientSecret: os.Getenv("GITLAB_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		// read_user: /api/v4/user, openid: userinfo の groups claim
+		Scopes: []string{"read_user", "openid"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   baseURL + "/oauth/authorize",
+			TokenURL:  baseURL + "/oauth/token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+
+	return &ClientGitLab{
+		AuthConf:   conf,
+		BaseURL:    baseURL,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *ClientGitLab) GetAccessToken(ctx context.Context, code string) (res model.TokenResponse, err error) {
+	return exchangeCode(ctx, c.AuthConf, c.HTTPClient, code)
+}
+
+func (c *ClientGitLab) GetUser(ctx context.Context, accessToken string) (user model.GitLabUser, err error) {
+	if err := getJSON(ctx, c.HTTPClient, c.BaseURL+"/api/v4/user", accessToken, &user); err != nil {
+		return model.GitLabUser{}, err
+	}
+	return user, nil
+}
+
+// GetGroups は所属しているグループの full path を返す
+func (c *ClientGitLab) GetGroups(ctx context.Context, accessToken string) (groups []string, err error) {
+	var userInfo model.GitLabUserInfo
+	if err := getJSON(ctx, c.HTTPClient, c.BaseURL+"/oauth/userinfo", accessToken, &userInfo); err != nil {
+		return nil, err
+	}
+	return userInfo.Groups, nil
+}
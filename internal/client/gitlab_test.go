@@ -0,0 +1,81 @@
+package client
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func newFakeGitLab(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("code") != "valid_code" || r.FormValue("grant_type") != "authorization_code" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"glpat-stub","token_type":"Bearer","expires_in":7200}`))
+	})
+	mux.HandleFunc("/api/v4/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer glpat-stub" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id":200000,"username":"alice","name":"Alice","email":"alice@example.com"}`))
+	})
+	mux.HandleFunc("/oauth/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer glpat-stub" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"sub":"200000","nickname":"alice","groups":["dev","infra/sre"]}`))
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestClientGitLab(t *testing.T) {
+	s := newFakeGitLab(t)
+	c := NewClientGitLab(s.URL+"/", "https://auth.example.com/callback/gitlab")
+	c.HTTPClient = s.Client()
+	ctx := context.Background()
+
+	if _, err := c.GetAccessToken(ctx, "invalid_code"); err == nil {
+		t.Errorf("ClientGitLab.GetAccessToken() error = nil, want error")
+	}
+
+	token, err := c.GetAccessToken(ctx, "valid_code")
+	if err != nil {
+		t.Fatalf("ClientGitLab.GetAccessToken() error = %v", err)
+	}
+	if token.AccessToken != "glpat-stub" {
+		t.Errorf("ClientGitLab.GetAccessToken() = %v, want glpat-stub", token.AccessToken)
+	}
+
+	user, err := c.GetUser(ctx, token.AccessToken)
+	if err != nil {
+		t.Fatalf("ClientGitLab.GetUser() error = %v", err)
+	}
+	wantUser := model.GitLabUser{ID: 200000, Username: "alice", Name: "Alice", Email: "alice@example.com"}
+	if !reflect.DeepEqual(user, wantUser) {
+		t.Errorf("ClientGitLab.GetUser() = %v, want %v", user, wantUser)
+	}
+
+	groups, err := c.GetGroups(ctx, token.AccessToken)
+	if err != nil {
+		t.Fatalf("ClientGitLab.GetGroups() error = %v", err)
+	}
+	if !reflect.DeepEqual(groups, []string{"dev", "infra/sre"}) {
+		t.Errorf("ClientGitLab.GetGroups() = %v", groups)
+	}
+
+	if _, err := c.GetUser(ctx, "invalid_token"); err == nil {
+		t.Errorf("ClientGitLab.GetUser() error = nil, want error")
+	}
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+const (
+	googleAuthURL  = "https://accounts.google.com/o/oauth2/v2/auth"
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+	googleJWKSURL  = "https://www.googleapis.com/oauth2/v3/certs"
+)
+
+// ID Token の iss として Google が使う値
+var googleIssuers = map[string]bool{
+	"https://accounts.google.com": true,
+	"accounts.google.com":         true,
+}
+
+type ClientGoogle struct {
+	AuthConf   *oauth2.Config
+	HTTPClient *http.Client
+	jwks       *jwksCache
+}
+
+type googleIDTokenClaims struct {
+	jwt.RegisteredClaims
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	HostedDomain  string `json:"hd"`
+	Name          string `json:"name"`
+	Nonce         string `json:"nonce"`
+}
+
+func NewClientGoogle(redirectURL string) *ClientGoogle {
+	conf := &oauth2.Config{
+		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
+		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"openid", "email", "profile"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   googleAuthURL,
+			TokenURL:  googleTokenURL,
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+
+	return &ClientGoogle{
+		AuthConf:   conf,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		jwks:       &jwksCache{url: googleJWKSURL},
+	}
+}
+
+// GetUser は code を token endpoint で引き換え、返ってきた ID Token を検証してその claim を返す
+// nonce は認可リクエストで送った値で、ID Token の nonce と一致しなければエラーにする
+func (c *ClientGoogle) GetUser(ctx context.Context, code, nonce string) (user model.GoogleUser, err error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, c.HTTPClient)
+	token, err := c.AuthConf.Exchange(ctx, code)
+	if err != nil {
+		return model.GoogleUser{}, err
+	}
+
+	idToken, ok := token.Extra("id_token").(string)
+	if !ok || idToken == "" {
+		return model.GoogleUser{}, errors.New("id_token is not found in token response")
+	}
+
+	claims := &googleIDTokenClaims{}
+	_, err = jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.jwks.get(ctx, c.HTTPClient, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithAudience(c.AuthConf.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return model.GoogleUser{}, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	if !googleIssuers[claims.Issuer] {
+		return model.GoogleUser{}, fmt.Errorf("invalid id_token issuer: %s", claims.Issuer)
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return model.GoogleUser{}, errors.New("invalid id_token nonce")
+	}
+
+	return model.GoogleUser{
+		Sub:           claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		HostedDomain:  claims.HostedDomain,
+		Name:          claims.Name,
+	}, nil
+}
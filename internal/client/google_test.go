@@ -0,0 +1,171 @@
+package client
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const stubGoogleKeyID = "stub-key"
+
+// stubGoogle は Google の token endpoint と JWKS を模したテスト用サーバ
+type stubGoogle struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims // id_token に入れる claim
+}
+
+func newStubGoogle(t *testing.T, claims jwt.MapClaims) *stubGoogle {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubGoogle{key: key, claims: claims}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "valid_code" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, s.claims)
+		token.Header["kid"] = stubGoogleKeyID
+		idToken, err := token.SignedString(s.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "ya29.stub",
+			"token_type":   "Bearer",
+			"expires_in":   3599,
+			"id_token":     idToken,
+		})
+	})
+	mux.HandleFunc("/certs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kid": stubGoogleKeyID,
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+			}},
+		})
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubGoogle) client() *ClientGoogle {
+	c := NewClientGoogle("https://auth.example.com/callback/google")
+	c.AuthConf.ClientID = "stub-client-id"
+	c.AuthConf.ClientSecret = "stub-client-secret"
+	c.AuthConf.Endpoint.TokenURL = s.URL + "/token"
+	c.HTTPClient = s.Client()
+	c.jwks = &jwksCache{url: s.URL + "/certs"}
+	return c
+}
+
+func TestClientGoogle_GetUser(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		code     string
+		wantUser model.GoogleUser
+		wantErr  bool
+	}{
+		{
+			name: "ok",
+			claims: jwt.MapClaims{
+				"iss": "https://accounts.google.com", "aud": "stub-client-id", "exp": exp,
+				"sub": "1234567890", "email": "alice@example.com", "email_verified": true, "hd": "example.com", "name": "Alice",
+				"nonce": "stub-nonce",
+			},
+			code: "valid_code",
+			wantUser: model.GoogleUser{
+				Sub: "1234567890", Email: "alice@example.com", EmailVerified: true, HostedDomain: "example.com", Name: "Alice",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid code",
+			claims: jwt.MapClaims{
+				"iss": "https://accounts.google.com", "aud": "stub-client-id", "exp": exp, "sub": "1234567890",
+			},
+			code:    "invalid_code",
+			wantErr: true,
+		},
+		{
+			name: "audience mismatched",
+			claims: jwt.MapClaims{
+				"iss": "https://accounts.google.com", "aud": "another-client-id", "exp": exp, "sub": "1234567890",
+			},
+			code:    "valid_code",
+			wantErr: true,
+		},
+		{
+			name: "issuer mismatched",
+			claims: jwt.MapClaims{
+				"iss": "https://evil.example.com", "aud": "stub-client-id", "exp": exp, "sub": "1234567890",
+			},
+			code:    "valid_code",
+			wantErr: true,
+		},
+		{
+			name: "nonce mismatched",
+			claims: jwt.MapClaims{
+				"iss": "https://accounts.google.com", "aud": "stub-client-id", "exp": exp, "sub": "1234567890", "nonce": "replayed-nonce",
+			},
+			code:    "valid_code",
+			wantErr: true,
+		},
+		{
+			name: "nonce missing",
+			claims: jwt.MapClaims{
+				"iss": "https://accounts.google.com", "aud": "stub-client-id", "exp": exp, "sub": "1234567890",
+			},
+			code:    "valid_code",
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			claims: jwt.MapClaims{
+				"iss": "accounts.google.com", "aud": "stub-client-id", "exp": time.Now().Add(-time.Hour).Unix(), "sub": "1234567890",
+			},
+			code:    "valid_code",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newStubGoogle(t, tt.claims).client()
+			gotUser, err := c.GetUser(context.Background(), tt.code, "stub-nonce")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ClientGoogle.GetUser() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotUser, tt.wantUser) {
+				t.Errorf("ClientGoogle.GetUser() = %v, want %v", gotUser, tt.wantUser)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// exchangeCode は authorization code を access_token に引き換える
+func exchangeCode(ctx context.Context, conf *oauth2.Config, httpClient *http.Client, code string) (model.TokenResponse, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+	token, err := conf.Exchange(ctx, code)
+	if err != nil {
+		return model.TokenResponse{}, err
+	}
+
+	res := model.TokenResponse{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		TokenType:    token.TokenType,
+	}
+	if !token.Expiry.IsZero() {
+		res.ExpiresIn = int(time.Until(token.Expiry).Seconds())
+	}
+	return res, nil
+}
+
+// getJSON は access_token 付きで GET し、レスポンスを out に格納する
+func getJSON(ctx context.Context, httpClient *http.Client, url string, accessToken string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBin, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{URL: url, StatusCode: resp.StatusCode, Body: string(respBin)}
+	}
+
+	return json.Unmarshal(respBin, out)
+}
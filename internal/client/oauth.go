@@ -2,36 +2,90 @@ package client
 
 import (
 	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/util"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"go.uber.org/zap"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/endpoints"
 )
 
-const githubAPIUserEndpoint = "https://api.github.com/user"
+const (
+	GitHubDefaultBaseURL = "https://github.com"
+	GitHubDefaultAPIURL  = "https://api.github.com"
+)
+
+const (
+	githubDefaultTimeout    = 10 * time.Second
+	githubDefaultMaxRetries = 2
+	githubDefaultRetryWait  = 500 * time.Millisecond
+	githubMaxRetryWait      = 30 * time.Second // これ以上 Retry-After で待たされる場合はリトライしない
+	githubDefaultCacheTTL   = 5 * time.Minute
+)
 
 type ClientGitHub struct {
-	AuthConf *oauth2.Config
+	AuthConf   *oauth2.Config
+	APIURL     string // e.g. https://api.github.com, https://ghe.example.com/api/v3
+	HTTPClient *http.Client
+
+	MaxRetries    int           // GET が 5xx, secondary rate limit のときのリトライ回数
+	RetryBaseWait time.Duration // リトライ間隔の初期値 (リトライごとに倍になる)
+
+	cache *responseCache // nil の場合はキャッシュしない
+
+	mu           sync.Mutex
+	blockedUntil time.Time // rate limit に達したとき、この時刻まではリクエストを送らない
 }
 
-func NewClientGitHub() *ClientGitHub {
+// NewClientGitHub は GitHub (または GitHub Enterprise Server) 用のクライアントを返す
+// baseURL, apiURL が空の場合は github.com を使う
+func NewClientGitHub(baseURL string, apiURL string) *ClientGitHub {
+	if baseURL == "" {
+		baseURL = GitHubDefaultBaseURL
+	}
+	if apiURL == "" {
+		apiURL = GitHubDefaultAPIURL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
 	conf := &oauth2.Config{
 		ClientID:     os.Getenv("GITHUB_CLIENT_ID"),
 		ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
 		Scopes:       []string{"user:read"}, // scope は1つだけ対応
 		Endpoint: oauth2.Endpoint{
-			TokenURL: endpoints.GitHub.TokenURL,
-			AuthURL:  endpoints.GitHub.AuthURL,
+			TokenURL: baseURL + "/login/oauth/access_token",
+			AuthURL:  baseURL + "/login/oauth/authorize",
 		},
 	}
 
-	return &ClientGitHub{AuthConf: conf}
+	return &ClientGitHub{
+		AuthConf:      conf,
+		APIURL:        strings.TrimSuffix(apiURL, "/"),
+		HTTPClient:    &http.Client{Timeout: githubDefaultTimeout},
+		MaxRetries:    githubDefaultMaxRetries,
+		RetryBaseWait: githubDefaultRetryWait,
+		cache:         newResponseCache(githubDefaultCacheTTL),
+	}
+}
+
+// SetCacheTTL はユーザ・所属情報のキャッシュの TTL を設定する。0 以下の場合はキャッシュしない
+func (c *ClientGitHub) SetCacheTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		c.cache = nil
+		return
+	}
+	c.cache = newResponseCache(ttl)
 }
 
 func (c *ClientGitHub) GetAccessToken(ctx context.Context, code string) (res model.TokenResponse, err error) {
@@ -46,65 +100,229 @@ func (c *ClientGitHub) GetAccessToken(ctx context.Context, code string) (res mod
 		return model.TokenResponse{}, err
 	}
 
-	req, err := http.NewRequest(
-		"POST",
-		c.AuthConf.Endpoint.TokenURL,
-		bytes.NewBuffer(reqDataBin),
-	)
+	respBin, _, err := c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", c.AuthConf.Endpoint.TokenURL, bytes.NewReader(reqDataBin))
+		if err != nil {
+			return nil, err
+		}
+		// Content-Type 設定
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		return req, nil
+	})
 	if err != nil {
 		return model.TokenResponse{}, err
 	}
 
-	// Content-Type 設定
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return model.TokenResponse{}, err
-	}
-	defer resp.Body.Close()
-
-	respBin, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return model.TokenResponse{}, err
+	// エラーでも status 200 で返ってくるので、先に error フィールドを確認する
+	var oauthErr OAuthError
+	if err := json.Unmarshal(respBin, &oauthErr); err == nil && oauthErr.Code != "" {
+		return model.TokenResponse{}, &oauthErr
 	}
 
 	err = json.Unmarshal(respBin, &res)
 	if err != nil {
 		return model.TokenResponse{}, err
 	}
+	if res.AccessToken == "" {
+		return model.TokenResponse{}, errors.New("access_token is empty")
+	}
 
 	return res, nil
 }
 
 func (c *ClientGitHub) GetUser(ctx context.Context, accessToken string) (user model.GitHubUser, err error) {
-	req, err := http.NewRequest(
-		"GET",
-		githubAPIUserEndpoint,
-		nil,
-	)
-
-	// Content-Type 設定
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
-	req.Header.Set("Accept", "application/vnd.github+json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// access_token はログインごとに変わり、この時点ではユーザ ID もわからないのでキャッシュしない
+	respBin, _, err := c.get(ctx, c.APIURL+"/user", accessToken, "")
 	if err != nil {
 		return model.GitHubUser{}, err
 	}
-	defer resp.Body.Close()
 
-	respBin, err := io.ReadAll(resp.Body)
+	err = json.Unmarshal(respBin, &user)
 	if err != nil {
 		return model.GitHubUser{}, err
 	}
+	if user.ID == 0 {
+		return model.GitHubUser{}, errors.New("user id is empty")
+	}
+	return user, nil
+}
 
-	err = json.Unmarshal(respBin, &user)
+// GetTeams はユーザが所属するチームを "org/team-slug" の形式で返す (read:org scope が必要)
+func (c *ClientGitHub) GetTeams(ctx context.Context, accessToken string, userID int) (teams []string, err error) {
+	key := fmt.Sprintf("teams:%d", userID)
+	respBin, err := c.cachedGet(ctx, key, c.APIURL+"/user/teams?per_page=100", accessToken)
 	if err != nil {
-		return model.GitHubUser{}, err
+		return nil, err
 	}
-	return user, nil
+
+	var res []model.GitHubTeam
+	if err := json.Unmarshal(respBin, &res); err != nil {
+		return nil, err
+	}
+	for _, t := range res {
+		teams = append(teams, fmt.Sprintf("%s/%s", t.Organization.Login, t.Slug))
+	}
+	return teams, nil
+}
+
+// cachedGet は GET のレスポンスをキャッシュする
+// TTL 内ならキャッシュを返し、期限切れで ETag があれば条件付きリクエストで再検証する
+func (c *ClientGitHub) cachedGet(ctx context.Context, key string, url string, accessToken string) ([]byte, error) {
+	var entry cacheEntry
+	if c.cache != nil {
+		var fresh, ok bool
+		entry, fresh, ok = c.cache.get(key)
+		if ok && fresh {
+			recordCacheStat("hit")
+			return entry.body, nil
+		}
+	}
+
+	respBin, resp, err := c.get(ctx, url, accessToken, entry.etag)
+	if err != nil {
+		return nil, err
+	}
+	if c.cache == nil {
+		return respBin, nil
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		recordCacheStat("revalidated")
+		c.cache.refresh(key)
+		return entry.body, nil
+	}
+
+	recordCacheStat("miss")
+	c.cache.set(key, respBin, resp.Header.Get("ETag"))
+	return respBin, nil
+}
+
+// get は API を GET する。etag があれば条件付きリクエストにする
+func (c *ClientGitHub) get(ctx context.Context, url string, accessToken string, etag string) ([]byte, *http.Response, error) {
+	return c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+		req.Header.Set("Accept", "application/vnd.github+json")
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		return req, nil
+	})
+}
+
+// do はリクエストを送信し、2xx (と 304) のときレスポンスボディを返す
+// GET が 5xx と secondary rate limit で失敗した場合はバックオフしながら MaxRetries 回までリトライする
+// code の引き換え (POST) は code が使われた後に失敗した可能性があるので、リトライしない
+// rate limit に達した場合は、解除されるまでリクエストを送らずに RateLimitError を返す
+func (c *ClientGitHub) do(ctx context.Context, newRequest func() (*http.Request, error)) ([]byte, *http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if until := c.rateLimitedUntil(); !until.IsZero() {
+			return nil, nil, &RateLimitError{Until: until}
+		}
+
+		req, err := newRequest()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		respBin, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		c.updateRateLimit(resp)
+
+		if (resp.StatusCode >= 200 && resp.StatusCode < 300) || resp.StatusCode == http.StatusNotModified {
+			return respBin, resp, nil
+		}
+
+		statusErr := &StatusError{URL: req.URL.String(), StatusCode: resp.StatusCode, Body: string(respBin)}
+		wait, retryable := c.retryWait(resp, respBin, attempt)
+		if !retryable || req.Method != http.MethodGet || attempt >= c.MaxRetries {
+			// primary rate limit, または長い Retry-After の場合はしばらく API を呼ばない
+			if until := c.rateLimitedUntil(); !until.IsZero() {
+				return nil, nil, &RateLimitError{Until: until}
+			}
+			return nil, nil, statusErr
+		}
+
+		zap.L().Warn("retry github request", zap.String("url", statusErr.URL), zap.Int("status", resp.StatusCode), zap.Duration("wait", wait))
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// rateLimitedUntil は rate limit でリクエストを止めている場合その期限を返す。止めていなければゼロ値
+func (c *ClientGitHub) rateLimitedUntil() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if util.NowFunc().Before(c.blockedUntil) {
+		return c.blockedUntil
+	}
+	return time.Time{}
+}
+
+// updateRateLimit は X-RateLimit-Remaining, X-RateLimit-Reset, Retry-After からリクエストを止める期限を更新する
+func (c *ClientGitHub) updateRateLimit(resp *http.Response) {
+	var until time.Time
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			until = time.Unix(reset, 0)
+		}
+	}
+	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests {
+		if sec, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && time.Duration(sec)*time.Second > githubMaxRetryWait {
+			until = util.NowFunc().Add(time.Duration(sec) * time.Second)
+		}
+	}
+	if until.IsZero() {
+		return
+	}
+
+	zap.L().Warn("github api rate limit exceeded", zap.Time("until", until))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if until.After(c.blockedUntil) {
+		c.blockedUntil = until
+	}
+}
+
+// retryWait はリトライすべきかどうかと、次のリトライまでの待ち時間を返す
+func (c *ClientGitHub) retryWait(resp *http.Response, body []byte, attempt int) (time.Duration, bool) {
+	backoff := c.RetryBaseWait * time.Duration(math.Pow(2, float64(attempt)))
+
+	if resp.StatusCode >= 500 {
+		return backoff, true
+	}
+
+	// secondary rate limit は 403 か 429 で返ってくる
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		sec, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, false
+		}
+		wait := time.Duration(sec) * time.Second
+		if wait > githubMaxRetryWait {
+			return 0, false
+		}
+		return wait, true
+	}
+	if strings.Contains(strings.ToLower(string(body)), "secondary rate limit") {
+		return backoff, true
+	}
+	return 0, false
 }
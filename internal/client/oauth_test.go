@@ -0,0 +1,324 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewClientGitHub(t *testing.T) {
+	tests := []struct {
+		name         string
+		baseURL      string
+		apiURL       string
+		wantAuthURL  string
+		wantTokenURL string
+		wantAPIURL   string
+	}{
+		{
+			name:         "github.com",
+			wantAuthURL:  "https://github.com/login/oauth/authorize",
+			wantTokenURL: "https://github.com/login/oauth/access_token",
+			wantAPIURL:   "https://api.github.com",
+		},
+		{
+			name:         "github enterprise server",
+			baseURL:      "https://ghe.example.com/",
+			apiURL:       "https://ghe.example.com/api/v3/",
+			wantAuthURL:  "https://ghe.example.com/login/oauth/authorize",
+			wantTokenURL: "https://ghe.example.com/login/oauth/access_token",
+			wantAPIURL:   "https://ghe.example.com/api/v3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClientGitHub(tt.baseURL, tt.apiURL)
+			if c.AuthConf.Endpoint.AuthURL != tt.wantAuthURL {
+				t.Errorf("AuthURL = %v, want %v", c.AuthConf.Endpoint.AuthURL, tt.wantAuthURL)
+			}
+			if c.AuthConf.Endpoint.TokenURL != tt.wantTokenURL {
+				t.Errorf("TokenURL = %v, want %v", c.AuthConf.Endpoint.TokenURL, tt.wantTokenURL)
+			}
+			if c.APIURL != tt.wantAPIURL {
+				t.Errorf("APIURL = %v, want %v", c.APIURL, tt.wantAPIURL)
+			}
+		})
+	}
+}
+
+func TestClientGitHub_enterpriseServer(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"gho_stub","token_type":"bearer","scope":""}`))
+	})
+	mux.HandleFunc("/api/v3/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gho_stub" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"login":"octocat","id":100000}`))
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	c := NewClientGitHub(s.URL, s.URL+"/api/v3")
+	token, err := c.GetAccessToken(context.Background(), "0123456789abcdef")
+	if err != nil {
+		t.Fatalf("ClientGitHub.GetAccessToken() error = %v", err)
+	}
+	user, err := c.GetUser(context.Background(), token.AccessToken)
+	if err != nil {
+		t.Fatalf("ClientGitHub.GetUser() error = %v", err)
+	}
+	if user.ID != 100000 || user.Login != "octocat" {
+		t.Errorf("ClientGitHub.GetUser() = %v", user)
+	}
+}
+
+// fakeGitHub は GitHub の token endpoint と user API を模したテスト用サーバ
+// responses に積んだレスポンスを順番に返し、尽きたら正常なレスポンスを返す
+type fakeGitHub struct {
+	*httptest.Server
+	responses []fakeResponse
+	calls     int
+}
+
+type fakeResponse struct {
+	status int
+	header map[string]string
+	body   string
+}
+
+func newFakeGitHub(t *testing.T, responses ...fakeResponse) *fakeGitHub {
+	t.Helper()
+	f := &fakeGitHub{responses: responses}
+	reply := func(w http.ResponseWriter, ok string) {
+		f.calls++
+		if len(f.responses) == 0 {
+			w.Write([]byte(ok))
+			return
+		}
+		res := f.responses[0]
+		f.responses = f.responses[1:]
+		for k, v := range res.header {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(res.status)
+		w.Write([]byte(res.body))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, `{"access_token":"gho_stub","token_type":"bearer","scope":""}`)
+	})
+	mux.HandleFunc("/api/v3/user", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, `{"login":"octocat","id":100000}`)
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeGitHub) client() *ClientGitHub {
+	c := NewClientGitHub(f.URL, f.URL+"/api/v3")
+	c.HTTPClient = f.Client()
+	c.RetryBaseWait = time.Millisecond
+	return c
+}
+
+func TestClientGitHub_GetAccessToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		responses     []fakeResponse
+		wantToken     string
+		wantOAuthErr  string // OAuthError.Code
+		wantStatusErr int    // StatusError.StatusCode
+		wantCalls     int
+	}{
+		{
+			name:      "ok",
+			wantToken: "gho_stub",
+			wantCalls: 1,
+		},
+		{
+			name: "bad verification code (status 200)",
+			responses: []fakeResponse{
+				{status: 200, body: `{"error":"bad_verification_code","error_description":"The code passed is incorrect or expired."}`},
+			},
+			wantOAuthErr: "bad_verification_code",
+			wantCalls:    1,
+		},
+		// code は一度しか使えないので、POST はリトライしない
+		{
+			name: "no retry on 5xx",
+			responses: []fakeResponse{
+				{status: 502, body: "bad gateway"},
+			},
+			wantStatusErr: 502,
+			wantCalls:     1,
+		},
+		{
+			name: "no retry on secondary rate limit",
+			responses: []fakeResponse{
+				{status: 429, body: `{"message":"You have exceeded a secondary rate limit."}`},
+			},
+			wantStatusErr: 429,
+			wantCalls:     1,
+		},
+		{
+			name: "no retry on 4xx",
+			responses: []fakeResponse{
+				{status: 404, body: `{"message":"Not Found"}`},
+			},
+			wantStatusErr: 404,
+			wantCalls:     1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeGitHub(t, tt.responses...)
+			got, err := f.client().GetAccessToken(context.Background(), "0123456789abcdef")
+
+			var oauthErr *OAuthError
+			var statusErr *StatusError
+			switch {
+			case tt.wantOAuthErr != "":
+				if !errors.As(err, &oauthErr) || oauthErr.Code != tt.wantOAuthErr {
+					t.Errorf("ClientGitHub.GetAccessToken() error = %v, want OAuthError %v", err, tt.wantOAuthErr)
+				}
+			case tt.wantStatusErr != 0:
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatusErr {
+					t.Errorf("ClientGitHub.GetAccessToken() error = %v, want StatusError %v", err, tt.wantStatusErr)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("ClientGitHub.GetAccessToken() error = %v", err)
+				}
+				if got.AccessToken != tt.wantToken {
+					t.Errorf("ClientGitHub.GetAccessToken() = %v, want %v", got.AccessToken, tt.wantToken)
+				}
+			}
+			if f.calls != tt.wantCalls {
+				t.Errorf("calls = %v, want %v", f.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestClientGitHub_GetUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []fakeResponse
+		wantID    int
+		wantErr   bool
+		wantCalls int
+	}{
+		{
+			name:      "ok",
+			wantID:    100000,
+			wantCalls: 1,
+		},
+		{
+			name: "retry on 5xx",
+			responses: []fakeResponse{
+				{status: 502, body: "bad gateway"},
+				{status: 503, body: "unavailable"},
+			},
+			wantID:    100000,
+			wantCalls: 3,
+		},
+		{
+			name: "give up after max retries",
+			responses: []fakeResponse{
+				{status: 500}, {status: 500}, {status: 500},
+			},
+			wantErr:   true,
+			wantCalls: 3,
+		},
+		{
+			name: "secondary rate limit with Retry-After",
+			responses: []fakeResponse{
+				{status: 403, header: map[string]string{"Retry-After": "0"}, body: `{"message":"You have exceeded a secondary rate limit."}`},
+			},
+			wantID:    100000,
+			wantCalls: 2,
+		},
+		{
+			name: "secondary rate limit without Retry-After",
+			responses: []fakeResponse{
+				{status: 429, body: `{"message":"You have exceeded a secondary rate limit."}`},
+			},
+			wantID:    100000,
+			wantCalls: 2,
+		},
+		{
+			name: "Retry-After too long",
+			responses: []fakeResponse{
+				{status: 429, header: map[string]string{"Retry-After": "3600"}},
+			},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			name: "bad credentials",
+			responses: []fakeResponse{
+				{status: 401, body: `{"message":"Bad credentials"}`},
+			},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			name: "empty user",
+			responses: []fakeResponse{
+				{status: 200, body: `{}`},
+			},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeGitHub(t, tt.responses...)
+			got, err := f.client().GetUser(context.Background(), "gho_stub")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ClientGitHub.GetUser() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got.ID != tt.wantID {
+				t.Errorf("ClientGitHub.GetUser() = %v, want %v", got.ID, tt.wantID)
+			}
+			if f.calls != tt.wantCalls {
+				t.Errorf("calls = %v, want %v", f.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestClientGitHub_contextCanceled(t *testing.T) {
+	f := newFakeGitHub(t, fakeResponse{status: 500}, fakeResponse{status: 500})
+	c := f.client()
+	c.RetryBaseWait = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.GetUser(ctx, "gho_stub")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ClientGitHub.GetUser() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestClientGitHub_timeout(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer s.Close()
+
+	c := NewClientGitHub(s.URL, s.URL)
+	c.HTTPClient.Timeout = 50 * time.Millisecond
+	if _, err := c.GetUser(context.Background(), "gho_stub"); err == nil {
+		t.Errorf("ClientGitHub.GetUser() error = nil, want timeout error")
+	}
+}
@@ -0,0 +1,129 @@
+package cookie
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const DefaultName = "jwt"
+
+// ChunkSize は 1 つの Cookie に入れる値の長さ。ブラウザの上限 (name, value, 属性で 4096 byte) に余裕を持たせる
+const ChunkSize = 3800
+
+const (
+	PrefixHost   = "__Host-"
+	PrefixSecure = "__Secure-"
+)
+
+// Config は JWT を保存する Cookie の属性
+// 値が ChunkSize を超える場合は <Name>, <Name>_1, <Name>_2, ... に分割する
+type Config struct {
+	Name     string // prefix (__Host-, __Secure-) を含む
+	Domain   string
+	Path     string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// Default は設定がない場合の属性。http でも動くように Secure は付けない
+func Default() Config {
+	return Config{Name: DefaultName, Path: "/", SameSite: http.SameSiteLaxMode}
+}
+
+// Validate はブラウザに拒否される組み合わせ (prefix の要件, SameSite=None) を検出する
+func (c Config) Validate() error {
+	if c.Name == "" {
+		return errors.New("cookie name is empty")
+	}
+	if strings.HasPrefix(c.Name, PrefixSecure) && !c.Secure {
+		return fmt.Errorf("%s prefix requires secure", PrefixSecure)
+	}
+	if strings.HasPrefix(c.Name, PrefixHost) {
+		if !c.Secure || c.Domain != "" || c.Path != "/" {
+			return fmt.Errorf("%s prefix requires secure, path = \"/\" and no domain", PrefixHost)
+		}
+	}
+	if c.SameSite == http.SameSiteNoneMode && !c.Secure {
+		return errors.New("same_site = none requires secure")
+	}
+	return nil
+}
+
+// Cookies は value を保存する Cookie を返す。長い場合は分割する
+func (c Config) Cookies(value string, maxAge int) []*http.Cookie {
+	var cookies []*http.Cookie
+	for i := 0; i == 0 || len(value) > 0; i++ {
+		n := min(len(value), ChunkSize)
+		cookies = append(cookies, c.cookie(c.chunkName(i), value[:n], maxAge))
+		value = value[n:]
+	}
+	return cookies
+}
+
+// Value は分割された Cookie を結合して値を返す
+func (c Config) Value(r *http.Request) (string, bool) {
+	first, err := r.Cookie(c.Name)
+	if err != nil {
+		return "", false
+	}
+	var b strings.Builder
+	b.WriteString(first.Value)
+	for i := 1; ; i++ {
+		chunk, err := r.Cookie(c.chunkName(i))
+		if err != nil {
+			break
+		}
+		b.WriteString(chunk.Value)
+	}
+	return b.String(), true
+}
+
+// Stale はリクエストに残っている n 番目以降の分割された Cookie を削除する Cookie を返す
+// 以前より短い値をセットしたときに、古い断片が結合されないようにする
+func (c Config) Stale(r *http.Request, n int) []*http.Cookie {
+	var cookies []*http.Cookie
+	for i := max(n, 1); ; i++ {
+		if _, err := r.Cookie(c.chunkName(i)); err != nil {
+			break
+		}
+		cookies = append(cookies, c.cookie(c.chunkName(i), "", -1))
+	}
+	return cookies
+}
+
+func (c Config) chunkName(i int) string {
+	if i == 0 {
+		return c.Name
+	}
+	return c.Name + "_" + strconv.Itoa(i)
+}
+
+func (c Config) cookie(name string, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Domain:   c.Domain,
+		Path:     c.Path,
+		Secure:   c.Secure,
+		HttpOnly: true,
+		SameSite: c.SameSite,
+		MaxAge:   maxAge,
+	}
+}
+
+// ParseSameSite は config の same_site (lax, strict, none) を変換する
+func ParseSameSite(s string) (http.SameSite, error) {
+	switch strings.ToLower(s) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("unknown same_site: %s", s)
+	}
+}
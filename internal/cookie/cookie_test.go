@@ -0,0 +1,94 @@
+package cookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       Config
+		wantErr bool
+	}{
+		{name: "default", c: Default()},
+		{name: "__Host- ok", c: Config{Name: "__Host-jwt", Path: "/", Secure: true}},
+		{name: "__Host- with domain", c: Config{Name: "__Host-jwt", Path: "/", Domain: "example.com", Secure: true}, wantErr: true},
+		{name: "__Host- with path", c: Config{Name: "__Host-jwt", Path: "/app", Secure: true}, wantErr: true},
+		{name: "__Host- not secure", c: Config{Name: "__Host-jwt", Path: "/"}, wantErr: true},
+		{name: "__Secure- ok", c: Config{Name: "__Secure-jwt", Path: "/app", Domain: "example.com", Secure: true}},
+		{name: "__Secure- not secure", c: Config{Name: "__Secure-jwt", Path: "/"}, wantErr: true},
+		{name: "SameSite=None not secure", c: Config{Name: "jwt", Path: "/", SameSite: http.SameSiteNoneMode}, wantErr: true},
+		{name: "empty name", c: Config{Path: "/"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.c.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_Cookies(t *testing.T) {
+	c := Config{Name: "__Host-jwt", Path: "/", Secure: true, SameSite: http.SameSiteStrictMode}
+	tests := []struct {
+		name      string
+		value     string
+		wantNames []string
+	}{
+		{name: "short", value: "abc", wantNames: []string{"__Host-jwt"}},
+		{name: "just chunk size", value: strings.Repeat("a", ChunkSize), wantNames: []string{"__Host-jwt"}},
+		{name: "chunked", value: strings.Repeat("a", ChunkSize) + strings.Repeat("b", ChunkSize) + "c", wantNames: []string{"__Host-jwt", "__Host-jwt_1", "__Host-jwt_2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cookies := c.Cookies(tt.value, 300)
+			var names []string
+			r := httptest.NewRequest("GET", "/", nil)
+			for _, ck := range cookies {
+				names = append(names, ck.Name)
+				if !ck.Secure || !ck.HttpOnly || ck.SameSite != http.SameSiteStrictMode || ck.Path != "/" || ck.MaxAge != 300 {
+					t.Errorf("cookie attributes = %+v", ck)
+				}
+				if len(ck.String()) > 4096 {
+					t.Errorf("cookie is too large: %d", len(ck.String()))
+				}
+				r.AddCookie(&http.Cookie{Name: ck.Name, Value: ck.Value})
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("Config.Cookies() names = %v, want %v", names, tt.wantNames)
+			}
+
+			// 結合すると元に戻る
+			got, ok := c.Value(r)
+			if !ok || got != tt.value {
+				t.Errorf("Config.Value() = %v (len %d), want len %d", ok, len(got), len(tt.value))
+			}
+		})
+	}
+}
+
+func TestConfig_Stale(t *testing.T) {
+	c := Default()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "jwt", Value: "a"})
+	r.AddCookie(&http.Cookie{Name: "jwt_1", Value: "b"})
+	r.AddCookie(&http.Cookie{Name: "jwt_2", Value: "c"})
+
+	got := c.Stale(r, 1)
+	if len(got) != 2 || got[0].Name != "jwt_1" || got[1].Name != "jwt_2" || got[0].MaxAge != -1 {
+		t.Errorf("Config.Stale() = %v", got)
+	}
+	if got := c.Stale(r, 3); len(got) != 0 {
+		t.Errorf("Config.Stale() = %v, want empty", got)
+	}
+}
+
+func TestConfig_Value_noCookie(t *testing.T) {
+	if _, ok := Default().Value(httptest.NewRequest("GET", "/", nil)); ok {
+		t.Errorf("Config.Value() ok = true, want false")
+	}
+}
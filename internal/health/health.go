@@ -0,0 +1,115 @@
+package health
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"azuki774/go-authenticator/internal/util"
+)
+
+// StatusOK は成功したチェックの結果
+const StatusOK = "ok"
+
+// DefaultTimeout は Checker.Timeout が 0 の場合の、すべてのチェックを待つ時間
+const DefaultTimeout = 5 * time.Second
+
+type Check struct {
+	Name string
+	Func func(ctx context.Context) error
+}
+
+// Checker は /readyz のチェックをまとめて実行する
+type Checker struct {
+	Checks  []Check
+	Timeout time.Duration
+}
+
+// Ready はすべてのチェックを並行して実行し、名前ごとの結果 (StatusOK またはエラー) を返す
+func (c *Checker) Ready(ctx context.Context) (results map[string]string, ok bool) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	errs := make([]error, len(c.Checks))
+	var wg sync.WaitGroup
+	for i, check := range c.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = check.Func(ctx)
+		}()
+	}
+	wg.Wait()
+
+	results = make(map[string]string, len(c.Checks))
+	ok = true
+	for i, check := range c.Checks {
+		if errs[i] != nil {
+			results[check.Name] = errs[i].Error()
+			ok = false
+			continue
+		}
+		results[check.Name] = StatusOK
+	}
+	return results, ok
+}
+
+// Cached は成功した結果を ttl の間使い回す。外部のプロバイダへの probe を /readyz のたびに送らないようにする
+func Cached(ttl time.Duration, f func(ctx context.Context) error) func(ctx context.Context) error {
+	var mu sync.Mutex
+	var lastOK time.Time
+	return func(ctx context.Context) error {
+		mu.Lock()
+		fresh := !lastOK.IsZero() && util.NowFunc().Sub(lastOK) < ttl
+		mu.Unlock()
+		if fresh {
+			return nil
+		}
+		if err := f(ctx); err != nil {
+			return err
+		}
+		mu.Lock()
+		lastOK = util.NowFunc()
+		mu.Unlock()
+		return nil
+	}
+}
+
+// Probe は url に HEAD を送り、応答があれば (5xx 以外) 到達可能とみなす
+// OAuth2 の token endpoint などは HEAD に 404, 405 を返すが、到達できることはわかる
+func Probe(client *http.Client, url string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("%s returned %s", url, resp.Status)
+		}
+		return nil
+	}
+}
+
+// CertValid は証明書 (チェーンの先頭) が有効期限内であることを確認する
+func CertValid(cert *x509.Certificate) error {
+	now := util.NowFunc()
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("certificate %q is not valid until %s", cert.Subject.CommonName, cert.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("certificate %q expired at %s", cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
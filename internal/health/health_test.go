@@ -0,0 +1,156 @@
+package health
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChecker_Ready(t *testing.T) {
+	okCheck := Check{Name: "config", Func: func(ctx context.Context) error { return nil }}
+	ngCheck := Check{Name: "github", Func: func(ctx context.Context) error { return errors.New("connection refused") }}
+	slowCheck := Check{Name: "slow", Func: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	tests := []struct {
+		name        string
+		c           *Checker
+		wantResults map[string]string
+		wantOk      bool
+	}{
+		{
+			name:        "no checks",
+			c:           &Checker{},
+			wantResults: map[string]string{},
+			wantOk:      true,
+		},
+		{
+			name:        "all ok",
+			c:           &Checker{Checks: []Check{okCheck}},
+			wantResults: map[string]string{"config": "ok"},
+			wantOk:      true,
+		},
+		{
+			name:        "one failed",
+			c:           &Checker{Checks: []Check{okCheck, ngCheck}},
+			wantResults: map[string]string{"config": "ok", "github": "connection refused"},
+			wantOk:      false,
+		},
+		{
+			name:        "timeout",
+			c:           &Checker{Checks: []Check{okCheck, slowCheck}, Timeout: 10 * time.Millisecond},
+			wantResults: map[string]string{"config": "ok", "slow": "context deadline exceeded"},
+			wantOk:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotResults, gotOk := tt.c.Ready(context.Background())
+			if !reflect.DeepEqual(gotResults, tt.wantResults) {
+				t.Errorf("Checker.Ready() gotResults = %v, want %v", gotResults, tt.wantResults)
+			}
+			if gotOk != tt.wantOk {
+				t.Errorf("Checker.Ready() gotOk = %v, want %v", gotOk, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestCached(t *testing.T) {
+	now := time.Date(2024, 7, 16, 15, 0, 0, 0, time.UTC)
+	util.NowFunc = func() time.Time { return now }
+	defer func() { util.NowFunc = time.Now }()
+
+	calls := 0
+	var err error
+	f := Cached(time.Minute, func(ctx context.Context) error {
+		calls++
+		return err
+	})
+
+	// 失敗した結果は使い回さない
+	err = errors.New("unreachable")
+	f(context.Background())
+	f(context.Background())
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+
+	err = nil
+	f(context.Background())
+	f(context.Background())
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+
+	now = now.Add(time.Minute)
+	f(context.Background())
+	if calls != 4 {
+		t.Errorf("calls = %d, want 4", calls)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "ok", status: http.StatusOK, wantErr: false},
+		{name: "method not allowed", status: http.StatusMethodNotAllowed, wantErr: false},
+		{name: "server error", status: http.StatusBadGateway, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodHead {
+					t.Errorf("method = %s, want HEAD", r.Method)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer ts.Close()
+			if err := Probe(ts.Client(), ts.URL+"/login/oauth/access_token")(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("Probe() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// 到達できない
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+	if err := Probe(http.DefaultClient, ts.URL)(context.Background()); err == nil {
+		t.Errorf("Probe() to closed server error = nil")
+	}
+}
+
+func TestCertValid(t *testing.T) {
+	now := time.Date(2024, 7, 16, 15, 0, 0, 0, time.UTC)
+	util.NowFunc = func() time.Time { return now }
+	defer func() { util.NowFunc = time.Now }()
+
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		wantErr bool
+	}{
+		{name: "valid", cert: &x509.Certificate{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)}, wantErr: false},
+		{name: "expired", cert: &x509.Certificate{NotBefore: now.Add(-2 * time.Hour), NotAfter: now.Add(-time.Hour)}, wantErr: true},
+		{name: "not yet valid", cert: &x509.Certificate{NotBefore: now.Add(time.Hour), NotAfter: now.Add(2 * time.Hour)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cert.Subject = pkix.Name{CommonName: "registry.example.com"}
+			if err := CertValid(tt.cert); (err != nil) != tt.wantErr {
+				t.Errorf("CertValid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
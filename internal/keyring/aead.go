@@ -0,0 +1,101 @@
+package keyring
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// AEADKeySize は AEADKeyring の鍵の長さ (A256GCM)
+const AEADKeySize = 32
+
+// AEADKey は Cookie の暗号化 (JWE dir + A256GCM) に使う共通鍵
+type AEADKey struct {
+	ID   string // JWE の kid
+	AEAD cipher.AEAD
+}
+
+// AEADKeyring は共通鍵の集合。先頭の鍵で暗号化し、残りの鍵はローテーション中の古い鍵として復号にのみ使う
+type AEADKeyring struct {
+	keys []AEADKey
+}
+
+func NewAEAD(keys ...[]byte) (*AEADKeyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no encryption key")
+	}
+	k := &AEADKeyring{}
+	for _, key := range keys {
+		if len(key) != AEADKeySize {
+			return nil, fmt.Errorf("encryption key must be %d bytes, got %d", AEADKeySize, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.keys = append(k.keys, AEADKey{ID: aeadKeyID(key), AEAD: gcm})
+	}
+	return k, nil
+}
+
+// LoadAEADFile は 1 行に 1 つ base64 の鍵 (e.g. openssl rand -base64 32) を書いたファイルを読み込む。先頭の鍵で暗号化する
+// 空行と # で始まる行は無視する
+func LoadAEADFile(path string) (*AEADKeyring, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys [][]byte
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(string(line))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	k, err := NewAEAD(keys...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return k, nil
+}
+
+// Current は暗号化に使う鍵を返す
+func (k *AEADKeyring) Current() AEADKey {
+	return k.keys[0]
+}
+
+// Lookup は kid に対応する鍵を返す
+func (k *AEADKeyring) Lookup(kid string) (AEADKey, bool) {
+	for _, key := range k.keys {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return AEADKey{}, false
+}
+
+// aeadKeyID は鍵そのものを推測できないよう、用途を付けたハッシュを kid にする
+func aeadKeyID(key []byte) string {
+	sum := sha256.Sum256(append([]byte("go-authenticator jwe kid:"), key...))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
@@ -0,0 +1,151 @@
+package keyring
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// Key は JWT の署名に使う RSA 鍵
+type Key struct {
+	ID      string // JWT の kid。公開鍵の thumbprint
+	Private *rsa.PrivateKey
+}
+
+// Keyring は署名鍵と、検証のために公開している鍵を持つ
+// 先頭の鍵で署名し、残りの鍵はローテーション中の古い鍵として JWKS にのみ載せる
+type Keyring struct {
+	keys []Key
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func New(keys ...*rsa.PrivateKey) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no signing key")
+	}
+	k := &Keyring{}
+	for _, priv := range keys {
+		id, err := keyID(&priv.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		k.keys = append(k.keys, Key{ID: id, Private: priv})
+	}
+	return k, nil
+}
+
+// Generate は一時的な署名鍵を作る。再起動すると発行済みのトークンは検証できなくなる
+func Generate() (*Keyring, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return New(priv)
+}
+
+// LoadFile は PEM ファイル (PKCS#1 または PKCS#8) から RSA 秘密鍵を読み込む。先頭の鍵が署名鍵になる
+func LoadFile(path string) (*Keyring, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*rsa.PrivateKey
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		priv, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if priv != nil {
+			keys = append(keys, priv)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no RSA private key found", path)
+	}
+	return New(keys...)
+}
+
+func parsePrivateKey(block *pem.Block) (*rsa.PrivateKey, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		priv, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("not an RSA private key")
+		}
+		return priv, nil
+	}
+	// 証明書など、鍵以外のブロックは無視する
+	return nil, nil
+}
+
+// Signing は署名に使う鍵を返す
+func (k *Keyring) Signing() Key {
+	return k.keys[0]
+}
+
+// PublicKey は kid に対応する公開鍵を返す
+func (k *Keyring) PublicKey(kid string) (*rsa.PublicKey, bool) {
+	for _, key := range k.keys {
+		if key.ID == kid {
+			return &key.Private.PublicKey, true
+		}
+	}
+	return nil, false
+}
+
+// JWKS は公開鍵を JWK Set の形式で返す
+func (k *Keyring) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range k.keys {
+		pub := key.Private.PublicKey
+		set.Keys = append(set.Keys, JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			Kid: key.ID,
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		})
+	}
+	return set
+}
+
+func keyID(pub *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12]), nil
+}
@@ -0,0 +1,141 @@
+package keyring
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadFile(t *testing.T) {
+	key1, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	// 署名鍵 (PKCS#1) とローテーション中の古い鍵 (PKCS#8)
+	keysPEM := append(
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key1)}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})...,
+	)
+	if err := os.WriteFile(filepath.Join(dir, "keys.pem"), keysPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "empty.pem"), []byte("not a pem"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantKeys int
+		wantErr  bool
+	}{
+		{name: "ok", path: filepath.Join(dir, "keys.pem"), wantKeys: 2},
+		{name: "no key", path: filepath.Join(dir, "empty.pem"), wantErr: true},
+		{name: "not found", path: filepath.Join(dir, "notfound.pem"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadFile(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			jwks := got.JWKS()
+			if len(jwks.Keys) != tt.wantKeys {
+				t.Fatalf("LoadFile() keys = %d, want %d", len(jwks.Keys), tt.wantKeys)
+			}
+			if !got.Signing().Private.Equal(key1) {
+				t.Errorf("LoadFile() signing key is not the first key")
+			}
+			for _, k := range jwks.Keys {
+				if k.Kty != "RSA" || k.Alg != "RS256" || k.E != "AQAB" {
+					t.Errorf("JWKS() = %+v", k)
+				}
+				if _, ok := got.PublicKey(k.Kid); !ok {
+					t.Errorf("PublicKey(%v) not found", k.Kid)
+				}
+			}
+			if _, ok := got.PublicKey("unknown"); ok {
+				t.Errorf("PublicKey(unknown) found")
+			}
+		})
+	}
+}
+
+func TestLoadAEADFile(t *testing.T) {
+	dir := t.TempDir()
+	key1 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, AEADKeySize))
+	key2 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, AEADKeySize))
+	files := map[string]string{
+		"keys":       "# 現在の鍵\n" + key1 + "\n\n# ローテーション中の古い鍵\n" + key2 + "\n",
+		"short":      base64.StdEncoding.EncodeToString([]byte("short")) + "\n",
+		"not base64": "not base64\n",
+		"empty":      "# no key\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "ok", path: filepath.Join(dir, "keys")},
+		{name: "short key", path: filepath.Join(dir, "short"), wantErr: true},
+		{name: "not base64", path: filepath.Join(dir, "not base64"), wantErr: true},
+		{name: "no key", path: filepath.Join(dir, "empty"), wantErr: true},
+		{name: "not found", path: filepath.Join(dir, "notfound"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadAEADFile(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadAEADFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			current := got.Current()
+			if k, ok := got.Lookup(current.ID); !ok || k.ID != current.ID {
+				t.Errorf("Lookup(%v) not found", current.ID)
+			}
+			other, err := NewAEAD(bytes.Repeat([]byte{2}, AEADKeySize))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if current.ID == other.Current().ID {
+				t.Errorf("current key is not the first key")
+			}
+			if _, ok := got.Lookup(other.Current().ID); !ok {
+				t.Errorf("old key is not found")
+			}
+			if _, ok := got.Lookup("unknown"); ok {
+				t.Errorf("Lookup(unknown) found")
+			}
+		})
+	}
+}
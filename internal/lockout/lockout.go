@@ -0,0 +1,81 @@
+package lockout
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxFailures = 5
+	DefaultWindow      = 5 * time.Minute
+	DefaultDuration    = 15 * time.Minute
+)
+
+// Limiter は Window の間に MaxFailures 回失敗したキー (ユーザ名, 送信元 IP) を Duration の間ロックする
+type Limiter struct {
+	MaxFailures int
+	Window      time.Duration
+	Duration    time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	failures    int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+func New(maxFailures int, window, duration time.Duration) *Limiter {
+	return &Limiter{MaxFailures: maxFailures, Window: window, Duration: duration, entries: make(map[string]*entry)}
+}
+
+// Locked はキーがロックされていれば、解除される時刻を返す
+func (l *Limiter) Locked(key string) (bool, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[key]
+	if !ok || !util.NowFunc().Before(e.lockedUntil) {
+		return false, time.Time{}
+	}
+	return true, e.lockedUntil
+}
+
+// Fail は失敗を記録し、この失敗でロックした場合に true を返す
+func (l *Limiter) Fail(key string) (locked bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := util.NowFunc()
+	for k, e := range l.entries {
+		if now.Sub(e.first) > l.Window && !now.Before(e.lockedUntil) {
+			delete(l.entries, k)
+		}
+	}
+
+	e, ok := l.entries[key]
+	if !ok {
+		e = &entry{first: now}
+		l.entries[key] = e
+	}
+	if now.Before(e.lockedUntil) {
+		return false
+	}
+	e.failures++
+	if e.failures < l.MaxFailures {
+		return false
+	}
+	e.lockedUntil = now.Add(l.Duration)
+	e.failures = 0
+	e.first = now
+	return true
+}
+
+// Reset はログインに成功したキーの失敗の記録を消す
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
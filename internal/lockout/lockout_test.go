@@ -0,0 +1,58 @@
+package lockout
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(1721142000, 0)
+	util.NowFunc = func() time.Time { return now }
+	defer func() { util.NowFunc = time.Now }()
+
+	l := New(3, time.Minute, 10*time.Minute)
+	for i := 0; i < 2; i++ {
+		if l.Fail("user:alice") {
+			t.Fatalf("Limiter.Fail() #%d = true, want false", i+1)
+		}
+	}
+	if locked, _ := l.Locked("user:alice"); locked {
+		t.Fatalf("Limiter.Locked() before max failures = true")
+	}
+	if !l.Fail("user:alice") {
+		t.Fatalf("Limiter.Fail() #3 = false, want true")
+	}
+	locked, until := l.Locked("user:alice")
+	if !locked || !until.Equal(now.Add(10*time.Minute)) {
+		t.Errorf("Limiter.Locked() = %v, %v", locked, until)
+	}
+	// ロック中の失敗で再びロックしたことにはならない
+	if l.Fail("user:alice") {
+		t.Errorf("Limiter.Fail() while locked = true")
+	}
+	if locked, _ := l.Locked("user:bob"); locked {
+		t.Errorf("Limiter.Locked(bob) = true")
+	}
+
+	now = now.Add(10 * time.Minute)
+	if locked, _ := l.Locked("user:alice"); locked {
+		t.Errorf("Limiter.Locked() after duration = true")
+	}
+
+	// Window を過ぎた失敗は数えない
+	l.Fail("user:bob")
+	l.Fail("user:bob")
+	now = now.Add(2 * time.Minute)
+	if l.Fail("user:bob") {
+		t.Errorf("Limiter.Fail() after window = true")
+	}
+
+	// 成功すると失敗の記録は消える
+	l.Fail("user:bob")
+	l.Reset("user:bob")
+	l.Fail("user:bob")
+	if l.Fail("user:bob") {
+		t.Errorf("Limiter.Fail() after Reset = true")
+	}
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// APIKey は API キー (personal access token) の情報。トークンそのものは保存せず、ハッシュのみを持つ
+type APIKey struct {
+	ID         string     `json:"id"`
+	Owner      string     `json:"owner"`
+	Scopes     []string   `json:"scopes,omitempty"`
+	Hash       string     `json:"hash"` // sha256(secret) の hex
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // nil の場合は無期限
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active は now の時点で失効・期限切れになっていないかを返す
+func (k APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	if k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+		return false
+	}
+	return true
+}
@@ -51,3 +51,54 @@ type GitHubUser struct {
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
 }
+
+// GoogleUser は Google の ID Token に含まれる claim のうち、認可に使うもの
+type GoogleUser struct {
+	Sub           string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	HostedDomain  string `json:"hd"`
+	Name          string `json:"name"`
+}
+
+type GitLabUser struct {
+	ID        int    `json:"id"`
+	Username  string `json:"username"`
+	Name      string `json:"name"`
+	State     string `json:"state"`
+	AvatarURL string `json:"avatar_url"`
+	WebURL    string `json:"web_url"`
+	Email     string `json:"email"`
+}
+
+// GitLabUserInfo は GitLab の OIDC userinfo endpoint のレスポンス
+type GitLabUserInfo struct {
+	Sub      string   `json:"sub"`
+	Nickname string   `json:"nickname"`
+	Groups   []string `json:"groups"` // 所属グループの full path
+}
+
+type GiteaUser struct {
+	ID        int    `json:"id"`
+	Login     string `json:"login"`
+	FullName  string `json:"full_name"`
+	Email     string `json:"email"`
+	AvatarURL string `json:"avatar_url"`
+	IsAdmin   bool   `json:"is_admin"`
+	Active    bool   `json:"active"`
+}
+
+type GiteaOrganization struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+}
+
+type GitHubTeam struct {
+	ID           int    `json:"id"`
+	Slug         string `json:"slug"`
+	Name         string `json:"name"`
+	Organization struct {
+		Login string `json:"login"`
+	} `json:"organization"`
+}
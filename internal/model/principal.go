@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// Principal は認証に成功したユーザの情報。JWT の claim に埋め込まれる
+type Principal struct {
+	Provider string // 認証したプロバイダ (basic, github, google など)
+	Subject  string // プロバイダ内で一意な ID
+	Name     string
+	Email    string
+	Groups   []string // プロバイダ上で所属しているグループ・組織
+	Roles    []string // config の roles で付与されたロール
+	Scopes   []string // API キー, client_credentials で許可された scope
+	Audience []string // トークンの宛先 (aud claim)。client_credentials で発行したトークンのみ
+	// ログインした時刻 (JWT の iat, セッションの作成時刻)。OIDC の auth_time になる。不明な場合はゼロ値
+	AuthTime time.Time `json:"-"`
+}
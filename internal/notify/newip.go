@@ -0,0 +1,35 @@
+package notify
+
+import "sync"
+
+// maxIPsPerUser を超えたら古いものから忘れる
+const maxIPsPerUser = 20
+
+// KnownIPs はユーザごとにログインした IP アドレスを覚え、新しい IP アドレスからのログインを検出する
+// メモリ上にのみ保持するので、再起動後の最初のログインは新しいとみなさない
+type KnownIPs struct {
+	mu  sync.Mutex
+	ips map[string][]string
+}
+
+func NewKnownIPs() *KnownIPs {
+	return &KnownIPs{ips: make(map[string][]string)}
+}
+
+// Seen は user の ip からのログインを記録し、以前に別の IP アドレスからログインしていれば true を返す
+func (k *KnownIPs) Seen(user, ip string) (isNew bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	known := k.ips[user]
+	for _, v := range known {
+		if v == ip {
+			return false
+		}
+	}
+	if len(known) >= maxIPsPerUser {
+		known = known[1:]
+	}
+	k.ips[user] = append(known, ip)
+	return len(known) > 0
+}
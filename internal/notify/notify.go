@@ -0,0 +1,233 @@
+package notify
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 通知するイベントの種類
+const (
+	TypeLoginNewIP      = "login.new_ip"      // 以前と違う IP アドレスからのログイン
+	TypeLoginLockout    = "login.lockout"     // パスワードの連続した失敗によるロックアウト
+	TypeLoginNotAllowed = "login.not_allowed" // 許可リストにないユーザのログイン
+)
+
+const (
+	FormatSlack    = "slack"    // {"text": "..."} (Slack の Incoming Webhook 互換)
+	FormatTemplate = "template" // Template で本文を作る
+)
+
+// SignatureHeader は本文の HMAC-SHA256 (Secret が設定されている場合)。値は sha256=<hex>
+const SignatureHeader = "X-Authenticator-Signature-256"
+
+const (
+	DefaultQueueSize  = 100
+	DefaultMaxRetries = 3
+	DefaultRetryWait  = time.Second
+)
+
+type Event struct {
+	Type     string            `json:"type"`
+	Time     time.Time         `json:"time"`
+	Provider string            `json:"provider,omitempty"`
+	Subject  string            `json:"subject,omitempty"`
+	Name     string            `json:"name,omitempty"`
+	SourceIP string            `json:"source_ip,omitempty"`
+	Message  string            `json:"message"`
+	Detail   map[string]string `json:"detail,omitempty"`
+}
+
+type Webhook struct {
+	Name        string
+	URL         string
+	Format      string             // FormatSlack または FormatTemplate
+	Template    *template.Template // Format = FormatTemplate のときの本文。Event を渡して実行する
+	ContentType string             // 空の場合は application/json
+	Secret      string             // 空でなければ本文に署名する
+	Events      []string           // 通知するイベントの種類。空の場合はすべて
+}
+
+// ParseTemplate は FormatTemplate の本文のテンプレートをパースする
+// text/template はエスケープしないので、JSON の値には {{json .Subject}} のように json を使う (ユーザ名などは攻撃者が選べる)
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Funcs(template.FuncMap{"json": templateJSON}).Parse(text)
+}
+
+// templateJSON は値を JSON (文字列は " で囲んでエスケープしたもの) にする
+func templateJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Body は Event を送信する本文にする
+func (w Webhook) Body(e Event) ([]byte, error) {
+	if w.Format == FormatTemplate {
+		var buf bytes.Buffer
+		if err := w.Template.Execute(&buf, e); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return json.Marshal(map[string]string{"text": slackText(e)})
+}
+
+func slackText(e Event) string {
+	text := fmt.Sprintf("[go-authenticator] %s: %s", e.Type, e.Message)
+	switch {
+	case e.Provider != "":
+		text += fmt.Sprintf("\nuser: %s:%s", e.Provider, e.Name)
+	case e.Name != "":
+		text += "\nuser: " + e.Name
+	}
+	if e.SourceIP != "" {
+		text += "\nsource ip: " + e.SourceIP
+	}
+	return text
+}
+
+func (w Webhook) wants(typ string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, typ)
+}
+
+type job struct {
+	webhook Webhook
+	event   Event
+}
+
+// Notifier は webhook をバックグラウンドで送信する。キューが一杯の場合は捨てて、ログインを遅らせない
+type Notifier struct {
+	Webhooks   []Webhook
+	HTTPClient *http.Client
+	MaxRetries int           // 5xx, 429, 通信エラーのときのリトライ回数
+	RetryWait  time.Duration // リトライの間隔 (2 倍ずつ増やす)
+
+	queue   chan job
+	wg      sync.WaitGroup
+	dropped atomic.Int64
+}
+
+// NewNotifier は送信する goroutine を起動する。終了時は Close で残りを送り切る
+func NewNotifier(webhooks []Webhook, queueSize int) *Notifier {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	n := &Notifier{
+		Webhooks:   webhooks,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		MaxRetries: DefaultMaxRetries,
+		RetryWait:  DefaultRetryWait,
+		queue:      make(chan job, queueSize),
+	}
+	n.wg.Add(1)
+	go n.run()
+	return n
+}
+
+// Notify は Event を送信キューに入れる。待たずに返る
+func (n *Notifier) Notify(e Event) {
+	if e.Time.IsZero() {
+		e.Time = util.NowFunc().UTC()
+	}
+	for _, w := range n.Webhooks {
+		if !w.wants(e.Type) {
+			continue
+		}
+		select {
+		case n.queue <- job{webhook: w, event: e}:
+		default:
+			n.dropped.Add(1)
+			zap.L().Warn("notify queue is full, event dropped", zap.String("webhook", w.Name), zap.String("type", e.Type))
+		}
+	}
+}
+
+// Dropped はキューが一杯で捨てた数
+func (n *Notifier) Dropped() int64 {
+	return n.dropped.Load()
+}
+
+func (n *Notifier) Close() {
+	close(n.queue)
+	n.wg.Wait()
+}
+
+func (n *Notifier) run() {
+	defer n.wg.Done()
+	for j := range n.queue {
+		if err := n.send(j.webhook, j.event); err != nil {
+			zap.L().Error("failed to send webhook", zap.String("webhook", j.webhook.Name), zap.String("type", j.event.Type), zap.Error(err))
+		}
+	}
+}
+
+var errRetryable = errors.New("retryable webhook response")
+
+func (n *Notifier) send(w Webhook, e Event) error {
+	body, err := w.Body(e)
+	if err != nil {
+		return err
+	}
+	wait := n.RetryWait
+	for i := 0; ; i++ {
+		err = n.post(w, e, body)
+		if err == nil || !errors.Is(err, errRetryable) || i >= n.MaxRetries {
+			return err
+		}
+		zap.L().Warn("retry webhook", zap.String("webhook", w.Name), zap.Int("attempt", i+1), zap.Error(err))
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+func (n *Notifier) post(w Webhook, e Event, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	contentType := w.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Authenticator-Event", e.Type)
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+
+	resp, err := n.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errRetryable, err)
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode/100 == 2:
+		return nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %s", errRetryable, resp.Status)
+	}
+	return fmt.Errorf("webhook returned %s", resp.Status)
+}
+
+// Sign は受信側で検証する署名 (sha256=<HMAC-SHA256 の hex>) を返す
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,172 @@
+package notify
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+)
+
+// receiver は受け取った webhook を記録する。statuses の順に応答し、使い切ったら 200 を返す
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   []string
+	headers  []http.Header
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.bodies = append(rc.bodies, string(body))
+	rc.headers = append(rc.headers, r.Header.Clone())
+	if len(rc.statuses) > 0 {
+		w.WriteHeader(rc.statuses[0])
+		rc.statuses = rc.statuses[1:]
+	}
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	event := Event{Type: TypeLoginNewIP, Time: time.Unix(1721142000, 0).UTC(), Provider: "github", Subject: "100000", Name: "octocat", SourceIP: "192.0.2.1", Message: "login from a new IP address"}
+	tests := []struct {
+		name        string
+		webhook     Webhook
+		statuses    []int
+		event       Event
+		wantBodies  []string
+		wantSigned  bool
+		wantHeaders map[string]string
+	}{
+		{
+			name:       "slack",
+			webhook:    Webhook{Name: "slack", Format: FormatSlack},
+			event:      event,
+			wantBodies: []string{`{"text":"[go-authenticator] login.new_ip: login from a new IP address\nuser: github:octocat\nsource ip: 192.0.2.1"}`},
+		},
+		{
+			name:        "template",
+			webhook:     Webhook{Name: "generic", Format: FormatTemplate, Template: template.Must(template.New("").Parse(`{{.Type}} {{.Name}} {{.SourceIP}} {{.Time.Unix}}`)), ContentType: "text/plain"},
+			event:       event,
+			wantBodies:  []string{"login.new_ip octocat 192.0.2.1 1721142000"},
+			wantHeaders: map[string]string{"Content-Type": "text/plain", "X-Authenticator-Event": "login.new_ip"},
+		},
+		{
+			// ユーザ名に " を含めても JSON のフィールドを追加できない
+			name:       "template with json",
+			webhook:    Webhook{Name: "siem", Format: FormatTemplate, Template: mustParseTemplate(`{"event": {{json .Type}}, "user": {{json (printf "%s:%s" .Provider .Subject)}}, "ip": {{json .SourceIP}}}`)},
+			event:      Event{Type: TypeLoginLockout, Provider: "basic", Subject: `alice", "admin": true, "x": "`, SourceIP: "192.0.2.1"},
+			wantBodies: []string{`{"event": "login.lockout", "user": "basic:alice\", \"admin\": true, \"x\": \"", "ip": "192.0.2.1"}`},
+		},
+		{
+			name:       "signed",
+			webhook:    Webhook{Name: "signed", Format: FormatTemplate, Template: template.Must(template.New("").Parse(`{{.Type}}`)), Secret: "webhook-secret"},
+			event:      event,
+			wantBodies: []string{"login.new_ip"},
+			wantSigned: true,
+		},
+		{
+			name:       "retry on 5xx and 429",
+			webhook:    Webhook{Name: "retry", Format: FormatTemplate, Template: template.Must(template.New("").Parse(`{{.Type}}`))},
+			statuses:   []int{http.StatusBadGateway, http.StatusTooManyRequests},
+			event:      event,
+			wantBodies: []string{"login.new_ip", "login.new_ip", "login.new_ip"},
+		},
+		{
+			name:       "no retry on 4xx",
+			webhook:    Webhook{Name: "gone", Format: FormatTemplate, Template: template.Must(template.New("").Parse(`{{.Type}}`))},
+			statuses:   []int{http.StatusNotFound},
+			event:      event,
+			wantBodies: []string{"login.new_ip"},
+		},
+		{
+			name:    "filtered by events",
+			webhook: Webhook{Name: "lockout only", Format: FormatSlack, Events: []string{TypeLoginLockout}},
+			event:   event,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &receiver{statuses: tt.statuses}
+			ts := httptest.NewServer(rc)
+			defer ts.Close()
+
+			tt.webhook.URL = ts.URL
+			n := NewNotifier([]Webhook{tt.webhook}, 10)
+			n.RetryWait = time.Millisecond
+			n.Notify(tt.event)
+			n.Close()
+
+			if len(rc.bodies) != len(tt.wantBodies) {
+				t.Fatalf("received %d requests (%v), want %d", len(rc.bodies), rc.bodies, len(tt.wantBodies))
+			}
+			for i, want := range tt.wantBodies {
+				if rc.bodies[i] != want {
+					t.Errorf("body[%d] = %s, want %s", i, rc.bodies[i], want)
+				}
+			}
+			for k, v := range tt.wantHeaders {
+				if got := rc.headers[0].Get(k); got != v {
+					t.Errorf("header %s = %s, want %s", k, got, v)
+				}
+			}
+			if len(rc.headers) > 0 {
+				got := rc.headers[0].Get(SignatureHeader)
+				if tt.wantSigned && got != Sign(tt.webhook.Secret, []byte(rc.bodies[0])) {
+					t.Errorf("signature = %s, want %s", got, Sign(tt.webhook.Secret, []byte(rc.bodies[0])))
+				}
+				if !tt.wantSigned && got != "" {
+					t.Errorf("signature = %s, want none", got)
+				}
+			}
+		})
+	}
+}
+
+func TestNotifier_Notify_queueFull(t *testing.T) {
+	// 受信側が止まっていても Notify は待たずに返り、あふれた分は捨てる
+	block := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-block }))
+	defer ts.Close()
+
+	n := NewNotifier([]Webhook{{Name: "slow", URL: ts.URL, Format: FormatSlack}}, 2)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		n.Notify(Event{Type: TypeLoginLockout, Message: "locked"})
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Notify() took %v", d)
+	}
+	// 1 件は送信中、2 件はキューにある
+	if got := n.Dropped(); got < 7 || got > 8 {
+		t.Errorf("Notifier.Dropped() = %d, want 7 or 8", got)
+	}
+	close(block)
+	n.Close()
+}
+
+func TestKnownIPs_Seen(t *testing.T) {
+	k := NewKnownIPs()
+	steps := []struct {
+		user, ip string
+		want     bool
+	}{
+		{"github:octocat", "192.0.2.1", false}, // 最初のログイン
+		{"github:octocat", "192.0.2.1", false},
+		{"github:octocat", "198.51.100.1", true},
+		{"github:octocat", "198.51.100.1", false},
+		{"basic:user", "198.51.100.1", false},
+	}
+	for i, s := range steps {
+		if got := k.Seen(s.user, s.ip); got != s.want {
+			t.Errorf("step %d: KnownIPs.Seen(%s, %s) = %v, want %v", i, s.user, s.ip, got, s.want)
+		}
+	}
+}
+
+func mustParseTemplate(text string) *template.Template {
+	return template.Must(ParseTemplate("test", text))
+}
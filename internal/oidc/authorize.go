@@ -0,0 +1,115 @@
+package oidc
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/util"
+	"crypto/rand"
+	"encoding/base64"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AuthorizeRequest は /oauth2/authorize のパラメータ
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Prompt              string
+}
+
+// authCode は発行した認可コードに紐づく情報。一度しか使えない
+type authCode struct {
+	clientID      string
+	redirectURI   string
+	scope         string
+	nonce         string
+	codeChallenge string
+	principal     model.Principal
+	authTime      time.Time
+	expires       time.Time
+}
+
+// ValidateAuthorizeRequest は authorize endpoint のパラメータを検証する
+func (p *Provider) ValidateAuthorizeRequest(req AuthorizeRequest) *Error {
+	client, ok := p.Clients[req.ClientID]
+	if !ok {
+		return newError("invalid_client", "unknown client_id")
+	}
+	if !client.allowedRedirect(req.RedirectURI) {
+		return newError("invalid_request", "redirect_uri is not registered")
+	}
+	if !client.allowedGrant(GrantTypeAuthorizationCode) {
+		return newError("unauthorized_client", "authorization_code is not allowed for this client")
+	}
+
+	// ここから先のエラーは redirect_uri に返す
+	if req.ResponseType != "code" {
+		return &Error{Code: "unsupported_response_type", Description: "only code is supported", redirect: true}
+	}
+	if !slices.Contains(strings.Fields(req.Scope), "openid") {
+		return &Error{Code: "invalid_scope", Description: "openid scope is required", redirect: true}
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return &Error{Code: "invalid_request", Description: "PKCE with S256 is required", redirect: true}
+	}
+	return nil
+}
+
+// IssueCode はログイン済みのユーザに対して認可コードを発行する
+// auth_time は principal のログインした時刻。不明な場合 (iat のない古いトークン) はコードの発行時刻にする
+func (p *Provider) IssueCode(req AuthorizeRequest, principal model.Principal) (string, error) {
+	code, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := util.NowFunc()
+	authTime := principal.AuthTime
+	if authTime.IsZero() {
+		authTime = now
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for k, v := range p.codes {
+		if now.After(v.expires) {
+			delete(p.codes, k)
+		}
+	}
+	p.codes[code] = authCode{
+		clientID:      req.ClientID,
+		redirectURI:   req.RedirectURI,
+		scope:         req.Scope,
+		nonce:         req.Nonce,
+		codeChallenge: req.CodeChallenge,
+		principal:     principal,
+		authTime:      authTime,
+		expires:       now.Add(p.CodeLife),
+	}
+	return code, nil
+}
+
+// popCode は認可コードを取り出す。使ったコードは失敗しても再利用できないように削除する
+func (p *Provider) popCode(code string) (authCode, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.codes[code]
+	delete(p.codes, code)
+	if !ok || util.NowFunc().After(c.expires) {
+		return authCode{}, false
+	}
+	return c, true
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,59 @@
+package oidc
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// clientCredentials はサービス間通信のために、client 自身を principal とするトークンを発行する
+// トークンは Authenticator の JWT なので、そのまま /auth_jwt_request に使える
+func (p *Provider) clientCredentials(client Client, scope string, audience []string) (TokenResponse, *Error) {
+	if client.public() {
+		// secret を持たない client は自分自身を証明できない
+		return TokenResponse{}, newError("unauthorized_client", "client_credentials requires a client secret")
+	}
+
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, s := range scopes {
+		if !slices.Contains(client.Scopes, s) {
+			return TokenResponse{}, newError("invalid_scope", "scope is not allowed: "+s)
+		}
+	}
+
+	if len(audience) == 0 {
+		audience = client.Audiences
+	}
+	for _, aud := range audience {
+		if !slices.Contains(client.Audiences, aud) {
+			// RFC 8707
+			return TokenResponse{}, newError("invalid_target", "audience is not allowed: "+aud)
+		}
+	}
+
+	principal := model.Principal{
+		Provider: "client",
+		Subject:  client.ID,
+		Name:     client.ID,
+		Scopes:   scopes,
+		Audience: audience,
+	}
+	token, err := p.JWTIssuer.GenerateToken(int(p.TokenLife.Seconds()), principal)
+	if err != nil {
+		return TokenResponse{}, &Error{Code: "server_error", status: http.StatusInternalServerError}
+	}
+
+	zap.L().Info("issue client credentials token", zap.String("client_id", client.ID), zap.Strings("aud", audience), zap.Strings("scope", scopes))
+	return TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(p.TokenLife.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
@@ -0,0 +1,100 @@
+package oidc
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestProvider_clientCredentials(t *testing.T) {
+	p := newTestDeviceProvider(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("inventory-secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Clients["inventory"] = Client{
+		ID:         "inventory",
+		SecretHash: string(hash),
+		GrantTypes: []string{GrantTypeClientCredentials},
+		Scopes:     []string{"invoices:read", "invoices:write"},
+		Audiences:  []string{"billing", "shipping"},
+	}
+	p.Clients["public"] = Client{ID: "public", GrantTypes: []string{GrantTypeClientCredentials}, Audiences: []string{"billing"}}
+	// JWT の中身の代わりに principal を返す
+	p.JWTIssuer = &principalJWTIssuer{}
+
+	tests := []struct {
+		name      string
+		req       TokenRequest
+		wantToken string
+		wantScope string
+		wantCode  string
+	}{
+		{
+			name:      "default scopes and audiences",
+			req:       TokenRequest{ClientID: "inventory", ClientSecret: "inventory-secret"},
+			wantToken: "client:inventory aud=billing,shipping scope=invoices:read,invoices:write",
+			wantScope: "invoices:read invoices:write",
+		},
+		{
+			name:      "requested scope and audience",
+			req:       TokenRequest{ClientID: "inventory", ClientSecret: "inventory-secret", Scope: "invoices:read", Audience: []string{"billing"}},
+			wantToken: "client:inventory aud=billing scope=invoices:read",
+			wantScope: "invoices:read",
+		},
+		{
+			name:     "scope not allowed",
+			req:      TokenRequest{ClientID: "inventory", ClientSecret: "inventory-secret", Scope: "invoices:delete"},
+			wantCode: "invalid_scope",
+		},
+		{
+			name:     "audience not allowed",
+			req:      TokenRequest{ClientID: "inventory", ClientSecret: "inventory-secret", Audience: []string{"payroll"}},
+			wantCode: "invalid_target",
+		},
+		{
+			name:     "wrong secret",
+			req:      TokenRequest{ClientID: "inventory", ClientSecret: "wrong"},
+			wantCode: "invalid_client",
+		},
+		{
+			name:     "public client",
+			req:      TokenRequest{ClientID: "public"},
+			wantCode: "unauthorized_client",
+		},
+		{
+			name:     "grant not allowed",
+			req:      TokenRequest{ClientID: "grafana", ClientSecret: "grafana-secret"},
+			wantCode: "unauthorized_client",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.GrantType = GrantTypeClientCredentials
+			got, oerr := p.Token(tt.req)
+			if tt.wantCode != "" {
+				if oerr == nil || oerr.Code != tt.wantCode {
+					t.Errorf("Provider.Token() error = %v, want %v", oerr, tt.wantCode)
+				}
+				return
+			}
+			if oerr != nil {
+				t.Fatalf("Provider.Token() error = %v", oerr)
+			}
+			if got.AccessToken != tt.wantToken || got.Scope != tt.wantScope {
+				t.Errorf("Provider.Token() = %+v, want %v (scope %v)", got, tt.wantToken, tt.wantScope)
+			}
+		})
+	}
+}
+
+// principalJWTIssuer は発行対象の principal を文字列にして返す
+type principalJWTIssuer struct{}
+
+func (m *principalJWTIssuer) GenerateToken(life int, principal model.Principal) (string, error) {
+	return principal.Provider + ":" + principal.Subject +
+		" aud=" + strings.Join(principal.Audience, ",") +
+		" scope=" + strings.Join(principal.Scopes, ","), nil
+}
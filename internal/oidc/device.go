@@ -0,0 +1,243 @@
+package oidc
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/util"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// device flow の polling 間隔。これより短い間隔で polling されたら slow_down を返す
+const defaultDeviceInterval = 5 * time.Second
+
+// user_code に使う文字。読み間違えにくいように母音と似た形の文字を除いている (RFC 8628 6.1)
+const userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+
+var (
+	ErrUserCodeNotFound = errors.New("user_code is invalid or expired")
+)
+
+type deviceStatus int
+
+const (
+	devicePending deviceStatus = iota
+	deviceApproved
+	deviceDenied
+)
+
+// deviceAuth は発行した device_code の状態
+type deviceAuth struct {
+	clientID  string
+	scope     string
+	userCode  string
+	expires   time.Time
+	interval  time.Duration
+	lastPoll  time.Time
+	status    deviceStatus
+	principal model.Principal
+}
+
+type DeviceAuthorizationRequest struct {
+	ClientID     string
+	ClientSecret string
+	Scope        string
+}
+
+// DeviceAuthorizationResponse は RFC 8628 3.2 のレスポンス
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceInfo は user_code の確認画面に表示する情報
+type DeviceInfo struct {
+	UserCode   string
+	ClientID   string
+	ClientName string
+	Scope      string
+}
+
+// DeviceAuthorization は device_code と user_code を発行する
+func (p *Provider) DeviceAuthorization(req DeviceAuthorizationRequest) (DeviceAuthorizationResponse, *Error) {
+	client, oerr := p.authenticateClient(req.ClientID, req.ClientSecret)
+	if oerr != nil {
+		return DeviceAuthorizationResponse{}, oerr
+	}
+	if !client.allowedGrant(GrantTypeDeviceCode) {
+		return DeviceAuthorizationResponse{}, newError("unauthorized_client", "device flow is not allowed for this client")
+	}
+
+	deviceCode, err := randomToken()
+	if err != nil {
+		return DeviceAuthorizationResponse{}, &Error{Code: "server_error", status: http.StatusInternalServerError}
+	}
+
+	now := util.NowFunc()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for k, v := range p.devices {
+		if now.After(v.expires) {
+			delete(p.devices, k)
+		}
+	}
+
+	var userCode string
+	for {
+		userCode, err = randomUserCode()
+		if err != nil {
+			return DeviceAuthorizationResponse{}, &Error{Code: "server_error", status: http.StatusInternalServerError}
+		}
+		if p.lookupUserCode(userCode) == nil {
+			break
+		}
+	}
+	p.devices[deviceCode] = &deviceAuth{
+		clientID: client.ID,
+		scope:    req.Scope,
+		userCode: userCode,
+		expires:  now.Add(p.DeviceLife),
+		interval: defaultDeviceInterval,
+	}
+
+	verificationURI := p.Issuer + "/device"
+	zap.L().Info("issue device code", zap.String("client_id", client.ID), zap.String("user_code", userCode))
+	return DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?" + url.Values{"user_code": {userCode}}.Encode(),
+		ExpiresIn:               int(p.DeviceLife.Seconds()),
+		Interval:                int(defaultDeviceInterval.Seconds()),
+	}, nil
+}
+
+// LookupDevice は user_code に対応する承認待ちの device の情報を返す
+func (p *Provider) LookupDevice(userCode string) (DeviceInfo, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d := p.lookupUserCode(userCode)
+	if d == nil || d.status != devicePending {
+		return DeviceInfo{}, false
+	}
+	client := p.Clients[d.clientID]
+	return DeviceInfo{UserCode: d.userCode, ClientID: client.ID, ClientName: client.Name, Scope: d.scope}, true
+}
+
+// ApproveDevice はログインしたユーザが user_code を承認したことを記録する
+func (p *Provider) ApproveDevice(userCode string, principal model.Principal) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d := p.lookupUserCode(userCode)
+	if d == nil || d.status != devicePending {
+		return ErrUserCodeNotFound
+	}
+	d.status = deviceApproved
+	d.principal = principal
+	zap.L().Info("device approved", zap.String("client_id", d.clientID), zap.String("user", principal.Name))
+	return nil
+}
+
+// DenyDevice はユーザが user_code を拒否したことを記録する
+func (p *Provider) DenyDevice(userCode string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d := p.lookupUserCode(userCode)
+	if d == nil || d.status != devicePending {
+		return ErrUserCodeNotFound
+	}
+	d.status = deviceDenied
+	zap.L().Info("device denied", zap.String("client_id", d.clientID))
+	return nil
+}
+
+// lookupUserCode は有効期限内の user_code に対応する device を返す。p.mu を取ってから呼ぶこと
+func (p *Provider) lookupUserCode(userCode string) *deviceAuth {
+	userCode = normalizeUserCode(userCode)
+	now := util.NowFunc()
+	for _, d := range p.devices {
+		if normalizeUserCode(d.userCode) == userCode && now.Before(d.expires) {
+			return d
+		}
+	}
+	return nil
+}
+
+// exchangeDeviceCode は承認された device_code と引き換えに Authenticator の JWT を発行する
+func (p *Provider) exchangeDeviceCode(client Client, deviceCode string) (TokenResponse, *Error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	d, ok := p.devices[deviceCode]
+	if !ok || d.clientID != client.ID {
+		return TokenResponse{}, newError("invalid_grant", "device_code is invalid")
+	}
+	now := util.NowFunc()
+	if now.After(d.expires) {
+		delete(p.devices, deviceCode)
+		return TokenResponse{}, newError("expired_token", "")
+	}
+
+	switch d.status {
+	case deviceDenied:
+		delete(p.devices, deviceCode)
+		return TokenResponse{}, newError("access_denied", "")
+	case devicePending:
+		// polling が速すぎる場合は間隔を 5 秒延ばしてもらう (RFC 8628 3.5)
+		if !d.lastPoll.IsZero() && now.Sub(d.lastPoll) < d.interval {
+			d.lastPoll = now
+			d.interval += 5 * time.Second
+			return TokenResponse{}, newError("slow_down", "")
+		}
+		d.lastPoll = now
+		return TokenResponse{}, newError("authorization_pending", "")
+	}
+
+	delete(p.devices, deviceCode)
+	token, err := p.JWTIssuer.GenerateToken(int(p.TokenLife.Seconds()), d.principal)
+	if err != nil {
+		return TokenResponse{}, &Error{Code: "server_error", status: http.StatusInternalServerError}
+	}
+
+	zap.L().Info("issue device token", zap.String("client_id", client.ID), zap.String("user", d.principal.Name))
+	return TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(p.TokenLife.Seconds()),
+		Scope:       d.scope,
+	}, nil
+}
+
+// randomUserCode は XXXX-XXXX 形式の user_code を作る
+func randomUserCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(userCodeCharset)))
+	for i := 0; i < 8; i++ {
+		if i == 4 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(userCodeCharset[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// normalizeUserCode は入力の揺れ (小文字, ハイフン, 空白) を吸収する
+func normalizeUserCode(userCode string) string {
+	userCode = strings.ToUpper(userCode)
+	userCode = strings.ReplaceAll(userCode, "-", "")
+	return strings.Join(strings.Fields(userCode), "")
+}
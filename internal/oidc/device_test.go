@@ -0,0 +1,144 @@
+package oidc
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/util"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockJWTIssuer struct{}
+
+func (m *mockJWTIssuer) GenerateToken(life int, principal model.Principal) (string, error) {
+	return "jwt-for-" + principal.Name, nil
+}
+
+func newTestDeviceProvider(t *testing.T) *Provider {
+	t.Helper()
+	p := newTestProvider(t)
+	p.Clients["ssh-cli"] = Client{ID: "ssh-cli", Name: "SSH CLI", GrantTypes: []string{GrantTypeDeviceCode}}
+	p.JWTIssuer = &mockJWTIssuer{}
+	return p
+}
+
+func TestProvider_DeviceFlow(t *testing.T) {
+	now := time.Unix(1721142000, 0)
+	util.NowFunc = func() time.Time { return now }
+	defer func() { util.NowFunc = time.Now }()
+	principal := model.Principal{Provider: "github", Subject: "100000", Name: "octocat"}
+
+	tests := []struct {
+		name      string
+		decide    func(p *Provider, userCode string) error
+		wait      time.Duration // 承認してから polling するまでの時間
+		wantToken string
+		wantCode  string
+	}{
+		{
+			name:      "approved",
+			decide:    func(p *Provider, userCode string) error { return p.ApproveDevice(userCode, principal) },
+			wait:      5 * time.Second,
+			wantToken: "jwt-for-octocat",
+		},
+		{
+			name: "approved with normalized user_code",
+			decide: func(p *Provider, userCode string) error {
+				return p.ApproveDevice(strings.ToLower(strings.ReplaceAll(userCode, "-", " ")), principal)
+			},
+			wait:      5 * time.Second,
+			wantToken: "jwt-for-octocat",
+		},
+		{
+			name:     "denied",
+			decide:   func(p *Provider, userCode string) error { return p.DenyDevice(userCode) },
+			wait:     5 * time.Second,
+			wantCode: "access_denied",
+		},
+		{
+			name:     "polling too fast",
+			decide:   func(p *Provider, userCode string) error { return nil },
+			wait:     time.Second,
+			wantCode: "slow_down",
+		},
+		{
+			name:     "pending",
+			decide:   func(p *Provider, userCode string) error { return nil },
+			wait:     5 * time.Second,
+			wantCode: "authorization_pending",
+		},
+		{
+			name:     "expired",
+			decide:   func(p *Provider, userCode string) error { return nil },
+			wait:     DefaultDeviceLife + time.Second,
+			wantCode: "expired_token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = time.Unix(1721142000, 0)
+			p := newTestDeviceProvider(t)
+			res, oerr := p.DeviceAuthorization(DeviceAuthorizationRequest{ClientID: "ssh-cli", Scope: "openid"})
+			if oerr != nil {
+				t.Fatal(oerr)
+			}
+			if !regexp.MustCompile(`^[BCDFGHJKLMNPQRSTVWXZ]{4}-[BCDFGHJKLMNPQRSTVWXZ]{4}$`).MatchString(res.UserCode) {
+				t.Errorf("user_code = %v", res.UserCode)
+			}
+			if res.VerificationURIComplete != "https://auth.example.com/device?user_code="+res.UserCode {
+				t.Errorf("verification_uri_complete = %v", res.VerificationURIComplete)
+			}
+			info, ok := p.LookupDevice(res.UserCode)
+			if !ok || info.ClientName != "SSH CLI" {
+				t.Errorf("Provider.LookupDevice() = %v, %v", info, ok)
+			}
+
+			tokenReq := TokenRequest{GrantType: GrantTypeDeviceCode, ClientID: "ssh-cli", DeviceCode: res.DeviceCode}
+			// 承認前の polling
+			if _, oerr := p.Token(tokenReq); oerr == nil || oerr.Code != "authorization_pending" {
+				t.Fatalf("Provider.Token() before approval error = %v", oerr)
+			}
+			if err := tt.decide(p, res.UserCode); err != nil {
+				t.Fatal(err)
+			}
+
+			now = now.Add(tt.wait)
+			got, oerr := p.Token(tokenReq)
+			if tt.wantCode != "" {
+				if oerr == nil || oerr.Code != tt.wantCode {
+					t.Errorf("Provider.Token() error = %v, want %v", oerr, tt.wantCode)
+				}
+				return
+			}
+			if oerr != nil {
+				t.Fatalf("Provider.Token() error = %v", oerr)
+			}
+			if got.AccessToken != tt.wantToken || got.TokenType != "Bearer" {
+				t.Errorf("Provider.Token() = %+v, want %v", got, tt.wantToken)
+			}
+			// device_code は一度しか使えない
+			if _, oerr := p.Token(tokenReq); oerr == nil || oerr.Code != "invalid_grant" {
+				t.Errorf("Provider.Token() with used device_code error = %v", oerr)
+			}
+			if _, ok := p.LookupDevice(res.UserCode); ok {
+				t.Errorf("Provider.LookupDevice() after approval found")
+			}
+		})
+	}
+}
+
+func TestProvider_DeviceAuthorization_unauthorizedClient(t *testing.T) {
+	p := newTestDeviceProvider(t)
+	// authorization_code のみの client
+	if _, oerr := p.DeviceAuthorization(DeviceAuthorizationRequest{ClientID: "cli"}); oerr == nil || oerr.Code != "unauthorized_client" {
+		t.Errorf("Provider.DeviceAuthorization() error = %v, want unauthorized_client", oerr)
+	}
+	// device flow のみの client は authorization_code を使えない
+	if _, oerr := p.Token(TokenRequest{GrantType: GrantTypeAuthorizationCode, ClientID: "ssh-cli", Code: "code"}); oerr == nil || oerr.Code != "unauthorized_client" {
+		t.Errorf("Provider.Token() error = %v, want unauthorized_client", oerr)
+	}
+	if err := p.ApproveDevice("BCDF-GHJK", model.Principal{}); err != ErrUserCodeNotFound {
+		t.Errorf("Provider.ApproveDevice() error = %v, want %v", err, ErrUserCodeNotFound)
+	}
+}
@@ -0,0 +1,167 @@
+package oidc
+
+import (
+	"azuki774/go-authenticator/internal/keyring"
+	"azuki774/go-authenticator/internal/model"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCodeLife   = time.Minute
+	DefaultTokenLife  = time.Hour
+	DefaultDeviceLife = 10 * time.Minute
+)
+
+// 対応している scope。それ以外の scope は無視する
+var supportedScopes = []string{"openid", "profile", "email", "groups"}
+
+// Client は config に登録された下流のアプリケーション (Relying Party)
+type Client struct {
+	ID           string
+	Name         string
+	SecretHash   string // bcrypt。空の場合は public client (PKCE のみで認証する)
+	RedirectURIs []string
+	GrantTypes   []string // 空の場合は authorization_code のみ
+	Scopes       []string // client_credentials で要求できる scope
+	Audiences    []string // client_credentials で要求できる宛先 (upstream)
+}
+
+func (c Client) allowedGrant(grantType string) bool {
+	if len(c.GrantTypes) == 0 {
+		return grantType == GrantTypeAuthorizationCode
+	}
+	return slices.Contains(c.GrantTypes, grantType)
+}
+
+func (c Client) public() bool {
+	return c.SecretHash == ""
+}
+
+func (c Client) allowedRedirect(uri string) bool {
+	for _, v := range c.RedirectURIs {
+		if v == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// JWTIssuer は Authenticator の JWT (Cookie, Authorization: Bearer で使えるもの) を発行する
+type JWTIssuer interface {
+	GenerateToken(life int, principal model.Principal) (string, error)
+}
+
+// Provider は OpenID Connect Provider として認可コードとトークンを発行する
+type Provider struct {
+	Issuer     string // e.g. https://auth.example.com
+	Keys       *keyring.Keyring
+	Clients    map[string]Client
+	CodeLife   time.Duration
+	TokenLife  time.Duration // ID Token, access token の有効期限
+	DeviceLife time.Duration // device_code, user_code の有効期限
+	JWTIssuer  JWTIssuer     // device flow で発行するトークン
+
+	mu      sync.Mutex
+	codes   map[string]authCode
+	devices map[string]*deviceAuth // key: device_code
+}
+
+func NewProvider(issuer string, keys *keyring.Keyring, clients []Client) *Provider {
+	p := &Provider{
+		Issuer:     strings.TrimSuffix(issuer, "/"),
+		Keys:       keys,
+		Clients:    make(map[string]Client),
+		CodeLife:   DefaultCodeLife,
+		TokenLife:  DefaultTokenLife,
+		DeviceLife: DefaultDeviceLife,
+		codes:      make(map[string]authCode),
+		devices:    make(map[string]*deviceAuth),
+	}
+	for _, c := range clients {
+		p.Clients[c.ID] = c
+	}
+	return p
+}
+
+// Error は RFC 6749 のエラーレスポンス
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+
+	status   int  // token endpoint などで返す HTTP ステータス
+	redirect bool // authorize endpoint で redirect_uri にエラーを返してよいか
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// Status はエラーを返すときの HTTP ステータスを返す
+func (e *Error) Status() int {
+	if e.status == 0 {
+		return http.StatusBadRequest
+	}
+	return e.status
+}
+
+// Redirectable は authorize endpoint でエラーを redirect_uri に返してよいかどうかを返す
+// client_id, redirect_uri が不正な場合は、オープンリダイレクトにならないようにその場でエラーを表示する
+func (e *Error) Redirectable() bool {
+	return e.redirect
+}
+
+func newError(code, description string) *Error {
+	return &Error{Code: code, Description: description}
+}
+
+// Discovery は /.well-known/openid-configuration の内容
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+func (p *Provider) Discovery() Discovery {
+	return Discovery{
+		Issuer:                            p.Issuer,
+		AuthorizationEndpoint:             p.Issuer + "/oauth2/authorize",
+		TokenEndpoint:                     p.Issuer + "/oauth2/token",
+		UserinfoEndpoint:                  p.Issuer + "/oauth2/userinfo",
+		DeviceAuthorizationEndpoint:       p.Issuer + "/oauth2/device_authorization",
+		IntrospectionEndpoint:             p.Issuer + "/oauth2/introspect",
+		RevocationEndpoint:                p.Issuer + "/oauth2/revoke",
+		JWKSURI:                           p.Issuer + "/oauth2/jwks",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{GrantTypeAuthorizationCode, GrantTypeDeviceCode, GrantTypeClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		ScopesSupported:                   supportedScopes,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "preferred_username", "email", "groups", "roles"},
+	}
+}
+
+func (p *Provider) JWKS() keyring.JWKS {
+	return p.Keys.JWKS()
+}
@@ -0,0 +1,267 @@
+package oidc
+
+import (
+	"azuki774/go-authenticator/internal/keyring"
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/util"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func testChallenge() string {
+	sum := sha256.Sum256([]byte(testVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func newTestProvider(t *testing.T) *Provider {
+	t.Helper()
+	keys, err := keyring.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("grafana-secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewProvider("https://auth.example.com/", keys, []Client{
+		{ID: "grafana", SecretHash: string(hash), RedirectURIs: []string{"https://grafana.example.com/login/generic_oauth"}},
+		{ID: "cli", RedirectURIs: []string{"http://127.0.0.1:8000/callback"}},
+	})
+}
+
+func TestProvider_ValidateAuthorizeRequest(t *testing.T) {
+	p := newTestProvider(t)
+	valid := AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            "grafana",
+		RedirectURI:         "https://grafana.example.com/login/generic_oauth",
+		Scope:               "openid profile",
+		CodeChallenge:       testChallenge(),
+		CodeChallengeMethod: "S256",
+	}
+	tests := []struct {
+		name         string
+		modify       func(req *AuthorizeRequest)
+		wantCode     string // 空ならエラーなし
+		wantRedirect bool
+	}{
+		{name: "ok", modify: func(req *AuthorizeRequest) {}},
+		{name: "unknown client", modify: func(req *AuthorizeRequest) { req.ClientID = "unknown" }, wantCode: "invalid_client"},
+		{name: "unregistered redirect_uri", modify: func(req *AuthorizeRequest) { req.RedirectURI = "https://evil.example.com/" }, wantCode: "invalid_request"},
+		{name: "token response", modify: func(req *AuthorizeRequest) { req.ResponseType = "token" }, wantCode: "unsupported_response_type", wantRedirect: true},
+		{name: "no openid scope", modify: func(req *AuthorizeRequest) { req.Scope = "profile" }, wantCode: "invalid_scope", wantRedirect: true},
+		{name: "no PKCE", modify: func(req *AuthorizeRequest) { req.CodeChallenge = "" }, wantCode: "invalid_request", wantRedirect: true},
+		{name: "plain PKCE", modify: func(req *AuthorizeRequest) { req.CodeChallengeMethod = "plain" }, wantCode: "invalid_request", wantRedirect: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.modify(&req)
+			got := p.ValidateAuthorizeRequest(req)
+			if tt.wantCode == "" {
+				if got != nil {
+					t.Errorf("Provider.ValidateAuthorizeRequest() = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil || got.Code != tt.wantCode || got.Redirectable() != tt.wantRedirect {
+				t.Errorf("Provider.ValidateAuthorizeRequest() = %+v, want %v (redirect %v)", got, tt.wantCode, tt.wantRedirect)
+			}
+		})
+	}
+}
+
+func TestProvider_Token(t *testing.T) {
+	util.NowFunc = func() time.Time { return time.Unix(1721142000, 0) }
+	defer func() { util.NowFunc = time.Now }()
+
+	principal := model.Principal{Provider: "github", Subject: "100000", Name: "octocat", Groups: []string{"myorg/infra"}, Roles: []string{"admin"}}
+	authReq := AuthorizeRequest{
+		ClientID:      "grafana",
+		RedirectURI:   "https://grafana.example.com/login/generic_oauth",
+		Scope:         "openid profile groups",
+		Nonce:         "n-0S6_WzA2Mj",
+		CodeChallenge: testChallenge(),
+	}
+	tokenReq := TokenRequest{
+		GrantType:    GrantTypeAuthorizationCode,
+		ClientID:     "grafana",
+		ClientSecret: "grafana-secret",
+		RedirectURI:  "https://grafana.example.com/login/generic_oauth",
+		CodeVerifier: testVerifier,
+	}
+	tests := []struct {
+		name     string
+		modify   func(req *TokenRequest)
+		wantCode string // 空ならエラーなし
+	}{
+		{name: "ok", modify: func(req *TokenRequest) {}},
+		{name: "wrong secret", modify: func(req *TokenRequest) { req.ClientSecret = "wrong" }, wantCode: "invalid_client"},
+		{name: "unknown client", modify: func(req *TokenRequest) { req.ClientID = "unknown" }, wantCode: "invalid_client"},
+		{name: "other client", modify: func(req *TokenRequest) { req.ClientID = "cli" }, wantCode: "invalid_grant"},
+		{name: "wrong verifier", modify: func(req *TokenRequest) { req.CodeVerifier = "wrong" }, wantCode: "invalid_grant"},
+		{name: "no verifier", modify: func(req *TokenRequest) { req.CodeVerifier = "" }, wantCode: "invalid_grant"},
+		{name: "wrong redirect_uri", modify: func(req *TokenRequest) { req.RedirectURI = "https://grafana.example.com/" }, wantCode: "invalid_grant"},
+		{name: "unknown code", modify: func(req *TokenRequest) { req.Code = "unknown" }, wantCode: "invalid_grant"},
+		{name: "unsupported grant_type", modify: func(req *TokenRequest) { req.GrantType = "password" }, wantCode: "unsupported_grant_type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProvider(t)
+			code, err := p.IssueCode(authReq, principal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := tokenReq
+			req.Code = code
+			tt.modify(&req)
+
+			got, oerr := p.Token(req)
+			if tt.wantCode != "" {
+				if oerr == nil || oerr.Code != tt.wantCode {
+					t.Errorf("Provider.Token() error = %v, want %v", oerr, tt.wantCode)
+				}
+				return
+			}
+			if oerr != nil {
+				t.Fatalf("Provider.Token() error = %v", oerr)
+			}
+
+			idToken, err := jwt.Parse(got.IDToken, func(token *jwt.Token) (interface{}, error) {
+				pub, _ := p.Keys.PublicKey(token.Header["kid"].(string))
+				return pub, nil
+			}, jwt.WithTimeFunc(util.NowFunc))
+			if err != nil {
+				t.Fatalf("id_token: %v", err)
+			}
+			claims := idToken.Claims.(jwt.MapClaims)
+			want := jwt.MapClaims{
+				"iss":                "https://auth.example.com",
+				"sub":                "github:100000",
+				"aud":                "grafana",
+				"iat":                float64(1721142000),
+				"exp":                float64(1721145600),
+				"auth_time":          float64(1721142000),
+				"nonce":              "n-0S6_WzA2Mj",
+				"name":               "octocat",
+				"preferred_username": "octocat",
+				"groups":             []interface{}{"myorg/infra"},
+				"roles":              []interface{}{"admin"},
+			}
+			if !reflect.DeepEqual(claims, want) {
+				t.Errorf("id_token claims = %v, want %v", claims, want)
+			}
+
+			info, oerr := p.UserInfo(got.AccessToken)
+			if oerr != nil {
+				t.Fatalf("Provider.UserInfo() error = %v", oerr)
+			}
+			wantInfo := map[string]any{
+				"sub":                "github:100000",
+				"name":               "octocat",
+				"preferred_username": "octocat",
+				"groups":             []interface{}{"myorg/infra"},
+				"roles":              []interface{}{"admin"},
+			}
+			if !reflect.DeepEqual(info, wantInfo) {
+				t.Errorf("Provider.UserInfo() = %v, want %v", info, wantInfo)
+			}
+
+			// code は一度しか使えない
+			if _, oerr := p.Token(req); oerr == nil || oerr.Code != "invalid_grant" {
+				t.Errorf("Provider.Token() with used code error = %v, want invalid_grant", oerr)
+			}
+			// ID Token は access token として使えない
+			if _, oerr := p.UserInfo(got.IDToken); oerr == nil {
+				t.Errorf("Provider.UserInfo() with id_token error = nil")
+			}
+		})
+	}
+}
+
+func TestProvider_Token_expiredCode(t *testing.T) {
+	now := time.Unix(1721142000, 0)
+	util.NowFunc = func() time.Time { return now }
+	defer func() { util.NowFunc = time.Now }()
+
+	p := newTestProvider(t)
+	code, err := p.IssueCode(AuthorizeRequest{ClientID: "cli", RedirectURI: "http://127.0.0.1:8000/callback", Scope: "openid", CodeChallenge: testChallenge()}, model.Principal{Provider: "basic", Subject: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(DefaultCodeLife + time.Second)
+	_, oerr := p.Token(TokenRequest{GrantType: GrantTypeAuthorizationCode, ClientID: "cli", Code: code, RedirectURI: "http://127.0.0.1:8000/callback", CodeVerifier: testVerifier})
+	if oerr == nil || oerr.Code != "invalid_grant" {
+		t.Errorf("Provider.Token() error = %v, want invalid_grant", oerr)
+	}
+}
+
+func TestProvider_Token_authTime(t *testing.T) {
+	util.NowFunc = func() time.Time { return time.Unix(1721142000, 0) }
+	defer func() { util.NowFunc = time.Now }()
+
+	// auth_time はコードの発行時刻ではなく、ログインした時刻
+	p := newTestProvider(t)
+	principal := model.Principal{Provider: "basic", Subject: "user", AuthTime: time.Unix(1721138400, 0)}
+	code, err := p.IssueCode(AuthorizeRequest{ClientID: "cli", RedirectURI: "http://127.0.0.1:8000/callback", Scope: "openid", CodeChallenge: testChallenge()}, principal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, oerr := p.Token(TokenRequest{GrantType: GrantTypeAuthorizationCode, ClientID: "cli", Code: code, RedirectURI: "http://127.0.0.1:8000/callback", CodeVerifier: testVerifier})
+	if oerr != nil {
+		t.Fatalf("Provider.Token() error = %v", oerr)
+	}
+
+	idToken, err := jwt.Parse(got.IDToken, func(token *jwt.Token) (interface{}, error) {
+		pub, _ := p.Keys.PublicKey(token.Header["kid"].(string))
+		return pub, nil
+	}, jwt.WithTimeFunc(util.NowFunc))
+	if err != nil {
+		t.Fatalf("id_token: %v", err)
+	}
+	if authTime := idToken.Claims.(jwt.MapClaims)["auth_time"]; authTime != float64(1721138400) {
+		t.Errorf("auth_time = %v, want %v", authTime, float64(1721138400))
+	}
+}
+
+func TestProvider_AuthenticateClient(t *testing.T) {
+	p := newTestProvider(t)
+	tests := []struct {
+		name     string
+		clientID string
+		secret   string
+		wantErr  bool
+	}{
+		{name: "ok", clientID: "grafana", secret: "grafana-secret"},
+		{name: "wrong secret", clientID: "grafana", secret: "wrong", wantErr: true},
+		{name: "unknown client", clientID: "unknown", secret: "grafana-secret", wantErr: true},
+		{name: "public client", clientID: "cli", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, oerr := p.AuthenticateClient(tt.clientID, tt.secret)
+			if (oerr != nil) != tt.wantErr {
+				t.Fatalf("Provider.AuthenticateClient() error = %v, wantErr %v", oerr, tt.wantErr)
+			}
+			if oerr != nil {
+				if oerr.Code != "invalid_client" || oerr.Status() != http.StatusUnauthorized {
+					t.Errorf("Provider.AuthenticateClient() error = %v, status %d", oerr, oerr.Status())
+				}
+				return
+			}
+			if got.ID != tt.clientID {
+				t.Errorf("Provider.AuthenticateClient() = %v, want %v", got.ID, tt.clientID)
+			}
+		})
+	}
+}
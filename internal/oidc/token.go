@@ -0,0 +1,280 @@
+package oidc
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/util"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+// access token の JWT header の typ (RFC 9068)
+const accessTokenType = "at+jwt"
+
+// TokenRequest は /oauth2/token のパラメータ
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	DeviceCode   string
+	Scope        string
+	Audience     []string
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token,omitempty"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// Token は grant_type に応じてトークンを発行する
+func (p *Provider) Token(req TokenRequest) (TokenResponse, *Error) {
+	client, oerr := p.authenticateClient(req.ClientID, req.ClientSecret)
+	if oerr != nil {
+		return TokenResponse{}, oerr
+	}
+
+	switch req.GrantType {
+	case "":
+		return TokenResponse{}, newError("invalid_request", "grant_type is required")
+	case GrantTypeAuthorizationCode, GrantTypeDeviceCode, GrantTypeClientCredentials:
+	default:
+		return TokenResponse{}, newError("unsupported_grant_type", "")
+	}
+	if !client.allowedGrant(req.GrantType) {
+		return TokenResponse{}, newError("unauthorized_client", "grant_type is not allowed for this client")
+	}
+
+	switch req.GrantType {
+	case GrantTypeDeviceCode:
+		return p.exchangeDeviceCode(client, req.DeviceCode)
+	case GrantTypeClientCredentials:
+		return p.clientCredentials(client, req.Scope, req.Audience)
+	default:
+		return p.exchangeCode(client, req)
+	}
+}
+
+// AuthenticateClient は introspection, revocation endpoint で client を認証する。public client は認証できない
+func (p *Provider) AuthenticateClient(clientID, secret string) (Client, *Error) {
+	client, oerr := p.authenticateClient(clientID, secret)
+	if oerr != nil {
+		return Client{}, oerr
+	}
+	if client.public() {
+		zap.L().Warn("public client is not allowed", zap.String("client_id", clientID))
+		return Client{}, &Error{Code: "invalid_client", status: http.StatusUnauthorized}
+	}
+	return client, nil
+}
+
+// authenticateClient は client_secret_basic / client_secret_post / none (public client) で client を認証する
+func (p *Provider) authenticateClient(clientID, secret string) (Client, *Error) {
+	client, ok := p.Clients[clientID]
+	if !ok {
+		zap.L().Warn("unknown oidc client", zap.String("client_id", clientID))
+		return Client{}, &Error{Code: "invalid_client", status: http.StatusUnauthorized}
+	}
+	if client.public() {
+		return client, nil
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(secret)); err != nil {
+		zap.L().Warn("oidc client secret mismatched", zap.String("client_id", clientID))
+		return Client{}, &Error{Code: "invalid_client", status: http.StatusUnauthorized}
+	}
+	return client, nil
+}
+
+func (p *Provider) exchangeCode(client Client, req TokenRequest) (TokenResponse, *Error) {
+	code, ok := p.popCode(req.Code)
+	if !ok {
+		return TokenResponse{}, newError("invalid_grant", "code is invalid or expired")
+	}
+	if code.clientID != client.ID {
+		return TokenResponse{}, newError("invalid_grant", "code was issued to another client")
+	}
+	if code.redirectURI != req.RedirectURI {
+		return TokenResponse{}, newError("invalid_grant", "redirect_uri mismatched")
+	}
+	if !verifyPKCE(code.codeChallenge, req.CodeVerifier) {
+		return TokenResponse{}, newError("invalid_grant", "code_verifier mismatched")
+	}
+
+	accessToken, err := p.signAccessToken(client.ID, code.scope, code.principal)
+	if err != nil {
+		zap.L().Error("failed to sign access token", zap.Error(err))
+		return TokenResponse{}, &Error{Code: "server_error", status: http.StatusInternalServerError}
+	}
+	idToken, err := p.signIDToken(client.ID, code)
+	if err != nil {
+		zap.L().Error("failed to sign id token", zap.Error(err))
+		return TokenResponse{}, &Error{Code: "server_error", status: http.StatusInternalServerError}
+	}
+
+	zap.L().Info("issue oidc token", zap.String("client_id", client.ID), zap.String("sub", subject(code.principal)))
+	return TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(p.TokenLife.Seconds()),
+		IDToken:     idToken,
+		Scope:       code.scope,
+	}, nil
+}
+
+// verifyPKCE は code_verifier が S256 の code_challenge に一致するかを返す
+func verifyPKCE(challenge, verifier string) bool {
+	if verifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+func (p *Provider) signIDToken(clientID string, code authCode) (string, error) {
+	now := util.NowFunc()
+	claims := jwt.MapClaims{
+		"iss":       p.Issuer,
+		"sub":       subject(code.principal),
+		"aud":       clientID,
+		"iat":       now.Unix(),
+		"exp":       now.Add(p.TokenLife).Unix(),
+		"auth_time": code.authTime.Unix(),
+	}
+	if code.nonce != "" {
+		claims["nonce"] = code.nonce
+	}
+	for k, v := range scopedClaims(code.scope, code.principal) {
+		claims[k] = v
+	}
+	return p.sign(claims, "")
+}
+
+// signAccessToken は userinfo endpoint で使う access token を発行する
+// userinfo で返す情報も埋め込み、サーバ側には状態を持たない
+func (p *Provider) signAccessToken(clientID, scope string, principal model.Principal) (string, error) {
+	now := util.NowFunc()
+	jti, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	claims := jwt.MapClaims{
+		"iss":       p.Issuer,
+		"sub":       subject(principal),
+		"aud":       p.Issuer,
+		"client_id": clientID,
+		"scope":     scope,
+		"iat":       now.Unix(),
+		"exp":       now.Add(p.TokenLife).Unix(),
+		"jti":       jti,
+	}
+	for k, v := range scopedClaims(scope, principal) {
+		claims[k] = v
+	}
+	return p.sign(claims, accessTokenType)
+}
+
+func (p *Provider) sign(claims jwt.MapClaims, typ string) (string, error) {
+	key := p.Keys.Signing()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.ID
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	return token.SignedString(key.Private)
+}
+
+// UserInfo は access token を検証し、scope に応じたユーザの情報を返す
+func (p *Provider) UserInfo(accessToken string) (map[string]any, *Error) {
+	claims, oerr := p.verifyAccessToken(accessToken)
+	if oerr != nil {
+		return nil, oerr
+	}
+
+	info := map[string]any{"sub": claims["sub"]}
+	for _, k := range []string{"name", "preferred_username", "email", "groups", "roles"} {
+		if v, ok := claims[k]; ok {
+			info[k] = v
+		}
+	}
+	return info, nil
+}
+
+func (p *Provider) verifyAccessToken(tokenString string) (jwt.MapClaims, *Error) {
+	invalid := &Error{Code: "invalid_token", status: http.StatusUnauthorized}
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["typ"] != accessTokenType {
+			return nil, fmt.Errorf("unexpected token type: %v", token.Header["typ"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		pub, ok := p.Keys.PublicKey(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id: %s", kid)
+		}
+		return pub, nil
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.Issuer),
+		jwt.WithTimeFunc(util.NowFunc),
+		jwt.WithStrictDecoding(),
+	)
+	if err != nil {
+		zap.L().Warn("invalid access token", zap.Error(err))
+		return nil, invalid
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, invalid
+	}
+	return claims, nil
+}
+
+// subject はプロバイダをまたいで一意になるように sub を作る (e.g. github:100000)
+func subject(principal model.Principal) string {
+	return principal.Provider + ":" + principal.Subject
+}
+
+// scopedClaims は scope で要求された claim を返す
+func scopedClaims(scope string, principal model.Principal) map[string]any {
+	scopes := strings.Fields(scope)
+	claims := make(map[string]any)
+	if slices.Contains(scopes, "profile") {
+		claims["name"] = principal.Name
+		claims["preferred_username"] = principal.Name
+	}
+	if slices.Contains(scopes, "email") && principal.Email != "" {
+		claims["email"] = principal.Email
+	}
+	if slices.Contains(scopes, "groups") {
+		groups := principal.Groups
+		if groups == nil {
+			groups = []string{}
+		}
+		roles := principal.Roles
+		if roles == nil {
+			roles = []string{}
+		}
+		claims["groups"] = groups
+		claims["roles"] = roles
+	}
+	return claims
+}
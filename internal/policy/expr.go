@@ -0,0 +1,137 @@
+package policy
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+var (
+	celEnvOnce sync.Once
+	celEnv     *cel.Env
+	celEnvErr  error
+)
+
+// exprEnv は認可ルールの式で使える変数・関数を宣言した CEL の環境を返す
+//
+//	claims    map(string, dyn): sub, provider, name, email, groups, roles, scopes, aud
+//	headers   map(string, string): リクエストヘッダ (key は小文字)
+//	source_ip string
+//	host      string
+//	path      string
+//	now       timestamp
+//	inCIDR(ip string, cidr string) bool
+func exprEnv() (*cel.Env, error) {
+	celEnvOnce.Do(func() {
+		celEnv, celEnvErr = cel.NewEnv(
+			cel.Variable("claims", cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable("headers", cel.MapType(cel.StringType, cel.StringType)),
+			cel.Variable("source_ip", cel.StringType),
+			cel.Variable("host", cel.StringType),
+			cel.Variable("path", cel.StringType),
+			cel.Variable("now", cel.TimestampType),
+			cel.Function("inCIDR",
+				cel.Overload("inCIDR_string_string", []*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+					cel.BinaryBinding(inCIDR),
+				),
+			),
+		)
+	})
+	return celEnv, celEnvErr
+}
+
+func inCIDR(ipVal ref.Val, cidrVal ref.Val) ref.Val {
+	ip, err := netip.ParseAddr(string(ipVal.(types.String)))
+	if err != nil {
+		return types.False
+	}
+	prefix, err := netip.ParsePrefix(string(cidrVal.(types.String)))
+	if err != nil {
+		return types.NewErr("invalid CIDR: %s", cidrVal)
+	}
+	return types.Bool(prefix.Contains(ip.Unmap()))
+}
+
+// Expr は CEL で書かれた認可ルールの式。config の読み込み時に CompileExpr でコンパイルしておく
+type Expr struct {
+	Source  string
+	program cel.Program
+}
+
+// CompileExpr は式をパース・型検査し、評価可能な形にする。式の結果は bool でなければならない
+func CompileExpr(source string) (*Expr, error) {
+	env, err := exprEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	ast, iss := env.Compile(source)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("expression must return bool, but returns %s", ast.OutputType())
+	}
+
+	program, err := env.Program(ast, cel.EvalOptions(cel.OptOptimize))
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{Source: source, program: program}, nil
+}
+
+// Eval は req に対して式を評価する
+func (e *Expr) Eval(req Request, now time.Time) (bool, error) {
+	headers := make(map[string]string)
+	for k := range req.Headers {
+		headers[strings.ToLower(k)] = req.Headers.Get(k)
+	}
+	groups := req.Principal.Groups
+	if groups == nil {
+		groups = []string{}
+	}
+	roles := req.Principal.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	scopes := req.Principal.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	aud := req.Principal.Audience
+	if aud == nil {
+		aud = []string{}
+	}
+
+	out, _, err := e.program.Eval(map[string]any{
+		"claims": map[string]any{
+			"sub":      req.Principal.Subject,
+			"provider": req.Principal.Provider,
+			"name":     req.Principal.Name,
+			"email":    req.Principal.Email,
+			"groups":   groups,
+			"roles":    roles,
+			"scopes":   scopes,
+			"aud":      aud,
+		},
+		"headers":   headers,
+		"source_ip": req.SourceIP,
+		"host":      normalizeHost(req.Host),
+		"path":      req.Path,
+		"now":       now,
+	})
+	if err != nil {
+		return false, err
+	}
+	allowed, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returns non-bool value: %v", out)
+	}
+	return allowed, nil
+}
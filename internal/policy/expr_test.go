@@ -0,0 +1,148 @@
+package policy
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/util"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCompileExpr(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		wantErr bool
+	}{
+		{"ok", `"infra" in claims.roles || inCIDR(source_ip, "10.0.0.0/8")`, false},
+		{"syntax error", `claims.roles.exists(r, r == "admin"`, true},
+		{"undeclared variable", `user.name == "octocat"`, true},
+		{"non-bool", `claims.name`, true},
+		{"type error", `source_ip + 1 == 2`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CompileExpr(tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CompileExpr() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpr_Eval(t *testing.T) {
+	// 2024-07-17 10:00 JST (水)
+	businessHours := time.Date(2024, 7, 17, 10, 0, 0, 0, time.FixedZone("Asia/Tokyo", 9*60*60))
+	const onCall = `"infra" in claims.groups || ("oncall" in claims.groups && now.getHours("Asia/Tokyo") >= 9 && now.getHours("Asia/Tokyo") < 18 && inCIDR(source_ip, "192.0.2.0/24"))`
+
+	tests := []struct {
+		name    string
+		source  string
+		req     Request
+		now     time.Time
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:   "team infra",
+			source: onCall,
+			req:    Request{Principal: model.Principal{Groups: []string{"infra"}}, SourceIP: "203.0.113.1"},
+			now:    businessHours.Add(12 * time.Hour),
+			want:   true,
+		},
+		{
+			name:   "on-call during business hours from office",
+			source: onCall,
+			req:    Request{Principal: model.Principal{Groups: []string{"oncall"}}, SourceIP: "192.0.2.10"},
+			now:    businessHours,
+			want:   true,
+		},
+		{
+			name:   "on-call outside business hours",
+			source: onCall,
+			req:    Request{Principal: model.Principal{Groups: []string{"oncall"}}, SourceIP: "192.0.2.10"},
+			now:    businessHours.Add(12 * time.Hour),
+			want:   false,
+		},
+		{
+			name:   "on-call from outside the office",
+			source: onCall,
+			req:    Request{Principal: model.Principal{Groups: []string{"oncall"}}, SourceIP: "203.0.113.1"},
+			now:    businessHours,
+			want:   false,
+		},
+		{
+			name:   "headers and host",
+			source: `headers["x-forwarded-proto"] == "https" && host == "grafana.example.com" && path.startsWith("/d/")`,
+			req: Request{
+				Host:    "Grafana.example.com:443",
+				Path:    "/d/abc",
+				Headers: http.Header{"X-Forwarded-Proto": []string{"https"}},
+			},
+			now:  businessHours,
+			want: true,
+		},
+		{
+			name:    "missing header",
+			source:  `headers["x-forwarded-proto"] == "https"`,
+			req:     Request{},
+			now:     businessHours,
+			want:    false,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := CompileExpr(tt.source)
+			if err != nil {
+				t.Fatalf("CompileExpr() error = %v", err)
+			}
+			got, err := e.Eval(tt.req, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expr.Eval() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Expr.Eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_Evaluate_expr(t *testing.T) {
+	util.NowFunc = func() time.Time { return time.Date(2024, 7, 17, 1, 0, 0, 0, time.UTC) } // 10:00 JST
+	defer func() { util.NowFunc = time.Now }()
+
+	businessHours, err := CompileExpr(`now.getHours("Asia/Tokyo") >= 9 && now.getHours("Asia/Tokyo") < 18`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	brokenExpr, err := CompileExpr(`headers["x-missing"] == "1"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Policy{
+		Default: ActionDeny,
+		Rules: []Rule{
+			{Host: "grafana.example.com", Roles: []string{"oncall"}, Expr: businessHours},
+			{Host: "wiki.example.com", Expr: brokenExpr},
+		},
+	}
+
+	tests := []struct {
+		name string
+		req  Request
+		want Decision
+	}{
+		{"principal and expr", Request{Principal: model.Principal{Roles: []string{"oncall"}}, Host: "grafana.example.com", Path: "/"}, Decision{Allowed: true, RuleIndex: 0}},
+		{"expr only", Request{Principal: model.Principal{Roles: []string{"dev"}}, Host: "grafana.example.com", Path: "/"}, Decision{Allowed: false, RuleIndex: 0}},
+		{"evaluation error", Request{Host: "wiki.example.com", Path: "/"}, Decision{Allowed: false, RuleIndex: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Evaluate(tt.req); got != tt.want {
+				t.Errorf("Policy.Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package policy
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// CIDRList は IP アドレスの範囲のリスト
+type CIDRList []netip.Prefix
+
+// ParseCIDRs は "10.0.0.0/8" や "192.0.2.1" (単一アドレス) の形式の文字列をパースする
+func ParseCIDRs(cidrs []string) (CIDRList, error) {
+	var l CIDRList
+	for _, c := range cidrs {
+		if !strings.Contains(c, "/") {
+			addr, err := netip.ParseAddr(c)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR: %s", c)
+			}
+			l = append(l, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR: %s", c)
+		}
+		l = append(l, prefix.Masked())
+	}
+	return l, nil
+}
+
+// Contains は ip がいずれかの範囲に含まれるかを返す。ip がパースできない場合は false
+func (l CIDRList) Contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range l {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipAllowed は Deny に含まれず、Allow が空または Allow に含まれる場合に true を返す
+func ipAllowed(ip string, allow CIDRList, deny CIDRList) bool {
+	if deny.Contains(ip) {
+		return false
+	}
+	return len(allow) == 0 || allow.Contains(ip)
+}
+
+// Bypass は CIDRs からのアクセスをログインなしで Principal として扱う設定 (e.g. VPN)
+type Bypass struct {
+	CIDRs     CIDRList
+	Principal model.Principal
+}
+
+// NetworkPolicy は送信元 IP アドレスによるアクセス制御
+type NetworkPolicy struct {
+	Allow  CIDRList // 空の場合はすべて許可
+	Deny   CIDRList
+	Bypass []Bypass
+}
+
+// Allowed は送信元 ip からのアクセスを許可するかを返す。n が nil の場合はすべて許可する
+func (n *NetworkPolicy) Allowed(ip string) bool {
+	if n == nil {
+		return true
+	}
+	return ipAllowed(ip, n.Allow, n.Deny)
+}
+
+// BypassPrincipal は ip がログイン不要な範囲に含まれる場合、その Principal を返す
+func (n *NetworkPolicy) BypassPrincipal(ip string) (model.Principal, bool) {
+	if n == nil {
+		return model.Principal{}, false
+	}
+	for _, b := range n.Bypass {
+		if b.CIDRs.Contains(ip) {
+			return b.Principal, true
+		}
+	}
+	return model.Principal{}, false
+}
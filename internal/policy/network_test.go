@@ -0,0 +1,95 @@
+package policy
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"reflect"
+	"testing"
+)
+
+func mustParseCIDRs(t *testing.T, cidrs ...string) CIDRList {
+	t.Helper()
+	l, err := ParseCIDRs(cidrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestParseCIDRs(t *testing.T) {
+	tests := []struct {
+		name    string
+		cidrs   []string
+		wantErr bool
+	}{
+		{"ok", []string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"}, false},
+		{"invalid address", []string{"10.0.0.256"}, true},
+		{"invalid prefix", []string{"10.0.0.0/33"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCIDRs(tt.cidrs); (err != nil) != tt.wantErr {
+				t.Errorf("ParseCIDRs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNetworkPolicy(t *testing.T) {
+	vpn := model.Principal{Provider: "network", Subject: "vpn", Name: "vpn"}
+	n := &NetworkPolicy{
+		Allow:  mustParseCIDRs(t, "10.0.0.0/8", "192.0.2.0/24"),
+		Deny:   mustParseCIDRs(t, "10.99.0.0/16"),
+		Bypass: []Bypass{{CIDRs: mustParseCIDRs(t, "10.8.0.0/16"), Principal: vpn}},
+	}
+	tests := []struct {
+		name          string
+		ip            string
+		wantAllowed   bool
+		wantPrincipal model.Principal
+		wantBypass    bool
+	}{
+		{"allowed", "192.0.2.10", true, model.Principal{}, false},
+		{"ipv4-mapped ipv6", "::ffff:192.0.2.10", true, model.Principal{}, false},
+		{"denied", "10.99.1.1", false, model.Principal{}, false},
+		{"not in allow", "203.0.113.1", false, model.Principal{}, false},
+		{"bypass", "10.8.1.1", true, vpn, true},
+		{"invalid ip", "unknown", false, model.Principal{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := n.Allowed(tt.ip); got != tt.wantAllowed {
+				t.Errorf("NetworkPolicy.Allowed() = %v, want %v", got, tt.wantAllowed)
+			}
+			gotPrincipal, gotBypass := n.BypassPrincipal(tt.ip)
+			if gotBypass != tt.wantBypass || !reflect.DeepEqual(gotPrincipal, tt.wantPrincipal) {
+				t.Errorf("NetworkPolicy.BypassPrincipal() = %v, %v, want %v, %v", gotPrincipal, gotBypass, tt.wantPrincipal, tt.wantBypass)
+			}
+		})
+	}
+}
+
+func TestPolicy_Evaluate_cidrs(t *testing.T) {
+	p := &Policy{
+		Default: ActionAllow,
+		Rules: []Rule{
+			{Host: "grafana.example.com", AllowCIDRs: mustParseCIDRs(t, "192.0.2.0/24"), DenyCIDRs: mustParseCIDRs(t, "192.0.2.128/25")},
+		},
+	}
+	tests := []struct {
+		name string
+		ip   string
+		want bool
+	}{
+		{"allowed", "192.0.2.1", true},
+		{"denied", "192.0.2.200", false},
+		{"not in allow", "203.0.113.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.Evaluate(Request{Host: "grafana.example.com", Path: "/", SourceIP: tt.ip})
+			if got.Allowed != tt.want {
+				t.Errorf("Policy.Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package policy
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// NormalizePath は percent-encoding された path をデコードし、upstream が解決するのと同じ形 (path.Clean) にする
+// /x/../admin/, //admin/, /%61dmin/ はすべて /admin/ になる。末尾の / は残す
+// デコードしてもまだ dot-segment (%2e%2e など二重にエンコードされたもの) を含む場合はエラーにする
+func NormalizePath(p string) (string, error) {
+	decoded, err := url.PathUnescape(p)
+	if err != nil {
+		return "", fmt.Errorf("invalid path %q: %w", p, err)
+	}
+	if !strings.HasPrefix(decoded, "/") {
+		return "", fmt.Errorf("invalid path %q: must start with /", p)
+	}
+
+	cleaned := path.Clean(decoded) // 連続した / と dot-segment も解決される
+	if strings.HasSuffix(decoded, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	for _, seg := range strings.Split(cleaned, "/") {
+		if s, err := url.PathUnescape(seg); err == nil && (s == "." || s == "..") {
+			return "", fmt.Errorf("invalid path %q: contains dot-segment", p)
+		}
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,237 @@
+package policy
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/util"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+)
+
+// Rule は host, path のパターンに一致したリクエストに対して、アクセスを許可するユーザ・グループ・プロバイダを定める
+// Users, Groups, Roles, Providers がすべて空の場合は、認証済みのユーザをすべて許可する
+type Rule struct {
+	Host      string   // e.g. grafana.example.com, *.example.com (空の場合はすべて)
+	Path      string   // e.g. /admin/* (末尾の * は前方一致、空の場合はすべて)
+	Users     []string // e.g. github:octocat, basic:user, alice@example.com
+	Groups    []string // <provider>:<プロバイダ上のグループ> e.g. gitlab:infra/sre, github:myorg/infra。別のプロバイダの同名のグループには一致しない
+	Roles     []string // RoleMapping で付与されたロール
+	Providers []string // e.g. github, google
+	Expr      *Expr    // 指定した場合は、上記に加えて式が true になることを要求する
+	Audience  string   // 指定した場合は、aud claim を持つトークン (client_credentials) に対してこの宛先を含むことを要求する
+
+	AllowCIDRs CIDRList // 指定した場合は、送信元 IP アドレスがこの範囲に含まれることを要求する
+	DenyCIDRs  CIDRList
+}
+
+// Request は認可の判断に使うリクエストの情報
+type Request struct {
+	Principal model.Principal
+	Host      string
+	Path      string // percent-encoding されたままの path。Evaluate で NormalizePath してから照合する
+	Headers   http.Header
+	SourceIP  string
+}
+
+// Policy は Rules を先頭から評価し、最初に host, path が一致したルールで許可・拒否を決める
+// どのルールにも一致しない場合は Default に従う
+type Policy struct {
+	Default string // allow or deny
+	Rules   []Rule
+}
+
+// Decision は評価結果
+type Decision struct {
+	Allowed     bool
+	RuleIndex   int  // 一致したルールの index。どのルールにも一致しなかった場合は -1
+	InvalidPath bool // path を正規化できずに拒否した
+}
+
+func (d Decision) String() string {
+	action := ActionDeny
+	if d.Allowed {
+		action = ActionAllow
+	}
+	if d.InvalidPath {
+		return fmt.Sprintf("%s (invalid path)", action)
+	}
+	if d.RuleIndex < 0 {
+		return fmt.Sprintf("%s (default)", action)
+	}
+	return fmt.Sprintf("%s (rule #%d)", action, d.RuleIndex)
+}
+
+// Validate は設定値の誤りを検出する
+func (p *Policy) Validate() error {
+	if p.Default != ActionAllow && p.Default != ActionDeny {
+		return fmt.Errorf("invalid policy default: %q (allow or deny)", p.Default)
+	}
+	for i, r := range p.Rules {
+		if _, err := path.Match(r.Host, ""); err != nil {
+			return fmt.Errorf("invalid host pattern in rule #%d: %w", i, err)
+		}
+		for _, g := range r.Groups {
+			if !validGroup(g) {
+				return fmt.Errorf("group must be <provider>:<group> in rule #%d: %s", i, g)
+			}
+		}
+	}
+	return nil
+}
+
+// NeedGroups は provider のグループを参照するルールがあるかどうか (グループ取得の API を呼ぶ必要があるか) を返す
+// 式はどのプロバイダの claims.groups を見るか分からないため、groups を含む式があれば true にする
+func (p *Policy) NeedGroups(provider string) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Rules {
+		for _, g := range r.Groups {
+			if strings.HasPrefix(g, provider+":") {
+				return true
+			}
+		}
+		if r.Expr != nil && strings.Contains(r.Expr.Source, "groups") {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate は req.Principal が req.Host, req.Path にアクセスしてよいかを判断する
+// p が nil の場合はすべて許可する
+func (p *Policy) Evaluate(req Request) Decision {
+	if p == nil {
+		return Decision{Allowed: true, RuleIndex: -1}
+	}
+
+	// upstream と違う path で照合すると、/x/../admin/ などで path のルールを回避できてしまう
+	normalized, err := NormalizePath(req.Path)
+	if err != nil {
+		zap.L().Warn("invalid request path", zap.Error(err))
+		return Decision{Allowed: false, RuleIndex: -1, InvalidPath: true}
+	}
+	req.Path = normalized
+
+	host := normalizeHost(req.Host)
+	for i, r := range p.Rules {
+		if !matchHost(r.Host, host) || !matchPath(r.Path, req.Path) {
+			continue
+		}
+		return Decision{Allowed: r.allows(req), RuleIndex: i}
+	}
+	return Decision{Allowed: p.Default != ActionDeny, RuleIndex: -1}
+}
+
+func (r Rule) allows(req Request) bool {
+	if !ipAllowed(req.SourceIP, r.AllowCIDRs, r.DenyCIDRs) {
+		return false
+	}
+	if !r.allowsAudience(req.Principal) {
+		return false
+	}
+	if !r.allowsPrincipal(req.Principal) {
+		return false
+	}
+	if r.Expr == nil {
+		return true
+	}
+
+	allowed, err := r.Expr.Eval(req, util.NowFunc())
+	if err != nil {
+		// 評価できない場合は拒否する
+		zap.L().Warn("failed to evaluate policy expression", zap.String("expr", r.Expr.Source), zap.Error(err))
+		return false
+	}
+	return allowed
+}
+
+// allowsAudience は別の upstream 宛てに発行されたトークンを拒否する
+// aud を持たないトークン (ブラウザのセッションなど) はここでは判断しない
+func (r Rule) allowsAudience(principal model.Principal) bool {
+	if r.Audience == "" || len(principal.Audience) == 0 {
+		return true
+	}
+	return slices.Contains(principal.Audience, r.Audience)
+}
+
+func (r Rule) allowsPrincipal(principal model.Principal) bool {
+	if len(r.Users) == 0 && len(r.Groups) == 0 && len(r.Roles) == 0 && len(r.Providers) == 0 {
+		return true
+	}
+	for _, u := range r.Users {
+		if MatchUser(u, principal) {
+			return true
+		}
+	}
+	for _, g := range r.Groups {
+		if matchGroup(g, principal) {
+			return true
+		}
+	}
+	for _, role := range r.Roles {
+		if slices.Contains(principal.Roles, role) {
+			return true
+		}
+	}
+	return slices.Contains(r.Providers, principal.Provider)
+}
+
+// MatchUser は "provider:name" (name はユーザ名か ID) またはメールアドレスの形式の user が principal と一致するかを返す
+func MatchUser(user string, principal model.Principal) bool {
+	provider, name, ok := strings.Cut(user, ":")
+	if !ok {
+		return principal.Email != "" && strings.EqualFold(user, principal.Email)
+	}
+	if provider != principal.Provider {
+		return false
+	}
+	return name == principal.Subject || name == principal.Name
+}
+
+// validGroup は group が <provider>:<group> の形式かを返す
+func validGroup(group string) bool {
+	provider, name, ok := strings.Cut(group, ":")
+	return ok && provider != "" && name != ""
+}
+
+// matchGroup は <provider>:<group> 形式の group が principal の所属グループと一致するかを返す
+func matchGroup(group string, principal model.Principal) bool {
+	provider, name, _ := strings.Cut(group, ":")
+	return provider == principal.Provider && slices.Contains(principal.Groups, name)
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+func matchHost(pattern string, host string) bool {
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+	ok, _ := path.Match(strings.ToLower(pattern), host)
+	return ok
+}
+
+func matchPath(pattern string, reqPath string) bool {
+	if pattern == "" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(reqPath, prefix)
+	}
+	return pattern == reqPath
+}
@@ -0,0 +1,154 @@
+package policy
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"testing"
+)
+
+func TestPolicy_Evaluate(t *testing.T) {
+	p := &Policy{
+		Default: ActionDeny,
+		Rules: []Rule{
+			{Host: "grafana.example.com", Path: "/admin/*", Users: []string{"github:octocat", "alice@example.com"}, Groups: []string{"gitlab:infra"}},
+			{Host: "grafana.example.com"},
+			{Host: "*.internal.example.com", Providers: []string{"google"}},
+			{Host: "argo.example.com", Roles: []string{"admin"}},
+			{Host: "billing.example.com", Audience: "billing"},
+		},
+	}
+	octocat := model.Principal{Provider: "github", Subject: "100000", Name: "octocat"}
+	alice := model.Principal{Provider: "google", Subject: "1234567890", Name: "Alice", Email: "Alice@example.com"}
+	bob := model.Principal{Provider: "gitlab", Subject: "200000", Name: "bob", Groups: []string{"dev", "infra"}}
+	carol := model.Principal{Provider: "basic", Subject: "carol", Name: "carol"}
+	inventory := model.Principal{Provider: "client", Subject: "inventory", Name: "inventory", Audience: []string{"billing", "shipping"}}
+	shipping := model.Principal{Provider: "client", Subject: "shipping", Name: "shipping", Audience: []string{"shipping"}}
+
+	tests := []struct {
+		name      string
+		principal model.Principal
+		host      string
+		path      string
+		want      Decision
+	}{
+		{"user by name", octocat, "grafana.example.com", "/admin/users", Decision{Allowed: true, RuleIndex: 0}},
+		{"user by id", model.Principal{Provider: "github", Subject: "octocat"}, "grafana.example.com", "/admin/", Decision{Allowed: true, RuleIndex: 0}},
+		{"user by email", alice, "grafana.example.com", "/admin/users", Decision{Allowed: true, RuleIndex: 0}},
+		{"group", bob, "grafana.example.com", "/admin/users", Decision{Allowed: true, RuleIndex: 0}},
+		{"group of other provider", model.Principal{Provider: "gitea", Subject: "300000", Name: "mallory", Groups: []string{"infra"}}, "grafana.example.com", "/admin/users", Decision{Allowed: false, RuleIndex: 0}},
+		{"not allowed", carol, "grafana.example.com", "/admin/users", Decision{Allowed: false, RuleIndex: 0}},
+		{"provider mismatched", model.Principal{Provider: "gitea", Name: "octocat"}, "grafana.example.com", "/admin/", Decision{Allowed: false, RuleIndex: 0}},
+		{"any authenticated user", carol, "Grafana.example.com:443", "/d/abc", Decision{Allowed: true, RuleIndex: 1}},
+		{"wildcard host, provider", alice, "wiki.internal.example.com", "/", Decision{Allowed: true, RuleIndex: 2}},
+		{"wildcard host, other provider", octocat, "wiki.internal.example.com", "/", Decision{Allowed: false, RuleIndex: 2}},
+		{"role", model.Principal{Provider: "basic", Name: "user", Roles: []string{"admin"}}, "argo.example.com", "/", Decision{Allowed: true, RuleIndex: 3}},
+		{"role mismatched", carol, "argo.example.com", "/", Decision{Allowed: false, RuleIndex: 3}},
+		{"audience", inventory, "billing.example.com", "/invoices", Decision{Allowed: true, RuleIndex: 4}},
+		{"audience mismatched", shipping, "billing.example.com", "/invoices", Decision{Allowed: false, RuleIndex: 4}},
+		{"audience, token without aud", carol, "billing.example.com", "/invoices", Decision{Allowed: true, RuleIndex: 4}},
+		{"default", octocat, "prometheus.example.com", "/", Decision{Allowed: false, RuleIndex: -1}},
+		// upstream で /admin/ に解決される path は rule #0 で判断する
+		{"dot-segment", carol, "grafana.example.com", "/x/../admin/", Decision{Allowed: false, RuleIndex: 0}},
+		{"encoded dot-segment", carol, "grafana.example.com", "/x/%2e%2e/admin/", Decision{Allowed: false, RuleIndex: 0}},
+		{"double slash", carol, "grafana.example.com", "//admin/", Decision{Allowed: false, RuleIndex: 0}},
+		{"percent-encoded", carol, "grafana.example.com", "/%61dmin/", Decision{Allowed: false, RuleIndex: 0}},
+		{"encoded slash", carol, "grafana.example.com", "/%2Fadmin/users", Decision{Allowed: false, RuleIndex: 0}},
+		{"double encoded dot-segment", carol, "grafana.example.com", "/x/%252e%252e/admin/", Decision{Allowed: false, RuleIndex: -1, InvalidPath: true}},
+		{"invalid escape", carol, "grafana.example.com", "/%zz", Decision{Allowed: false, RuleIndex: -1, InvalidPath: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Evaluate(Request{Principal: tt.principal, Host: tt.host, Path: tt.path}); got != tt.want {
+				t.Errorf("Policy.Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_Evaluate_nil(t *testing.T) {
+	var p *Policy
+	if got := p.Evaluate(Request{Host: "grafana.example.com", Path: "/"}); !got.Allowed {
+		t.Errorf("Policy.Evaluate() = %v, want allowed", got)
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       *Policy
+		wantErr bool
+	}{
+		{"ok", &Policy{Default: ActionAllow, Rules: []Rule{{Host: "*.example.com"}}}, false},
+		{"invalid default", &Policy{Default: "permit"}, true},
+		{"invalid host pattern", &Policy{Default: ActionDeny, Rules: []Rule{{Host: "[example.com"}}}, true},
+		{"group with provider", &Policy{Default: ActionDeny, Rules: []Rule{{Groups: []string{"gitlab:infra/sre"}}}}, false},
+		{"group without provider", &Policy{Default: ActionDeny, Rules: []Rule{{Groups: []string{"infra/sre"}}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.p.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Policy.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       string
+		want    string
+		wantErr bool
+	}{
+		{name: "root", p: "/", want: "/"},
+		{name: "plain", p: "/admin/users", want: "/admin/users"},
+		{name: "trailing slash", p: "/admin/", want: "/admin/"},
+		{name: "dot-segment", p: "/x/../admin/", want: "/admin/"},
+		{name: "dot", p: "/./admin", want: "/admin"},
+		{name: "above root", p: "/../../admin", want: "/admin"},
+		{name: "double slash", p: "//admin//users", want: "/admin/users"},
+		{name: "percent-encoded", p: "/%61dmin/", want: "/admin/"},
+		{name: "encoded dot-segment", p: "/x/%2E%2e/admin", want: "/admin"},
+		{name: "encoded slash", p: "/x%2F..%2Fadmin", want: "/admin"},
+		{name: "double encoded dot-segment", p: "/x/%252e%252e/admin", wantErr: true},
+		{name: "invalid escape", p: "/%zz", wantErr: true},
+		{name: "relative", p: "admin", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizePath(tt.p)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NormalizePath() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("NormalizePath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_NeedGroups(t *testing.T) {
+	expr, err := CompileExpr(`"infra" in claims.groups`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		p        *Policy
+		provider string
+		want     bool
+	}{
+		{"nil", nil, "gitlab", false},
+		{"group", &Policy{Rules: []Rule{{Groups: []string{"gitlab:infra/sre"}}}}, "gitlab", true},
+		{"group of other provider", &Policy{Rules: []Rule{{Groups: []string{"gitlab:infra/sre"}}}}, "gitea", false},
+		{"expr", &Policy{Rules: []Rule{{Expr: expr}}}, "github", true},
+		{"no groups", &Policy{Rules: []Rule{{Users: []string{"github:octocat"}}}}, "github", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.NeedGroups(tt.provider); got != tt.want {
+				t.Errorf("Policy.NeedGroups() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
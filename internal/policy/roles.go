@@ -0,0 +1,87 @@
+package policy
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// RoleMapping は Users, GitHubTeams, Groups のいずれかに一致したユーザに Role を付与する
+type RoleMapping struct {
+	Role        string
+	Users       []string // e.g. basic:user, github:50764643 (MatchUser と同じ形式)
+	GitHubTeams []string // e.g. myorg/infra
+	Groups      []string // <provider>:<プロバイダ上のグループ> e.g. gitlab:infra/sre, gitea:infra。別のプロバイダの同名のグループには一致しない
+}
+
+type Roles []RoleMapping
+
+// Resolve は principal に付与されるロールを返す
+func (rs Roles) Resolve(principal model.Principal) []string {
+	var roles []string
+	for _, r := range rs {
+		if slices.Contains(roles, r.Role) {
+			continue
+		}
+		if r.matches(principal) {
+			roles = append(roles, r.Role)
+		}
+	}
+	return roles
+}
+
+// Validate は Groups がプロバイダで修飾されているかを確認する
+func (rs Roles) Validate() error {
+	for _, r := range rs {
+		for _, g := range r.Groups {
+			if !validGroup(g) {
+				return fmt.Errorf("role %s: group must be <provider>:<group>: %s", r.Role, g)
+			}
+		}
+	}
+	return nil
+}
+
+// NeedGitHubTeams は GitHub のチームによるロール付与があるかどうか (チーム取得の API を呼ぶ必要があるか) を返す
+func (rs Roles) NeedGitHubTeams() bool {
+	for _, r := range rs {
+		if len(r.GitHubTeams) > 0 {
+			return true
+		}
+	}
+	return rs.NeedGroups("github")
+}
+
+// NeedGroups は provider のグループによるロール付与があるかどうか (グループ取得の API を呼ぶ必要があるか) を返す
+func (rs Roles) NeedGroups(provider string) bool {
+	for _, r := range rs {
+		for _, g := range r.Groups {
+			if strings.HasPrefix(g, provider+":") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r RoleMapping) matches(principal model.Principal) bool {
+	for _, u := range r.Users {
+		if MatchUser(u, principal) {
+			return true
+		}
+	}
+	if principal.Provider == "github" {
+		for _, t := range r.GitHubTeams {
+			if slices.Contains(principal.Groups, t) {
+				return true
+			}
+		}
+	}
+	for _, g := range r.Groups {
+		if matchGroup(g, principal) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"reflect"
+	"testing"
+)
+
+func TestRoles_Resolve(t *testing.T) {
+	rs := Roles{
+		{Role: "admin", Users: []string{"basic:user", "github:50764643"}, GitHubTeams: []string{"myorg/infra"}},
+		{Role: "dev", Groups: []string{"gitlab:dev", "github:myorg/dev"}},
+		{Role: "admin", Groups: []string{"gitlab:admins"}},
+	}
+	tests := []struct {
+		name      string
+		principal model.Principal
+		want      []string
+	}{
+		{"basic user", model.Principal{Provider: "basic", Subject: "user", Name: "user"}, []string{"admin"}},
+		{"github id", model.Principal{Provider: "github", Subject: "50764643", Name: "azuki774"}, []string{"admin"}},
+		{"github team", model.Principal{Provider: "github", Subject: "100000", Groups: []string{"myorg/infra", "myorg/dev"}}, []string{"admin", "dev"}},
+		{"team name from another provider", model.Principal{Provider: "gitlab", Subject: "200000", Groups: []string{"myorg/infra"}}, nil},
+		{"provider groups", model.Principal{Provider: "gitlab", Subject: "200000", Groups: []string{"admins", "dev"}}, []string{"dev", "admin"}},
+		// Gitea の組織名は誰でも作れるので、GitLab のグループと同名でも一致しない
+		{"group name from another provider", model.Principal{Provider: "gitea", Subject: "300000", Groups: []string{"admins", "dev"}}, nil},
+		{"no roles", model.Principal{Provider: "basic", Subject: "guest", Name: "guest"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rs.Resolve(tt.principal); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Roles.Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoles_NeedGroups(t *testing.T) {
+	rs := Roles{
+		{Role: "admin", GitHubTeams: []string{"myorg/infra"}},
+		{Role: "dev", Groups: []string{"gitlab:dev"}},
+	}
+	tests := []struct {
+		provider string
+		want     bool
+	}{
+		{"gitlab", true},
+		{"gitea", false},
+		{"git", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			if got := rs.NeedGroups(tt.provider); got != tt.want {
+				t.Errorf("Roles.NeedGroups() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoles_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rs      Roles
+		wantErr bool
+	}{
+		{"ok", Roles{{Role: "dev", Groups: []string{"gitlab:infra/sre", "gitea:infra"}}}, false},
+		{"without provider", Roles{{Role: "dev", Groups: []string{"infra/sre"}}}, true},
+		{"empty group", Roles{{Role: "dev", Groups: []string{"gitlab:"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rs.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Roles.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package registry
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/policy"
+	"azuki774/go-authenticator/internal/util"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+const DefaultTokenLife = 5 * time.Minute
+
+var ErrUnknownService = errors.New("unknown service")
+
+// Rule は Users, Roles のいずれかに一致したユーザに、Repositories への Actions を許可する
+// docker login で使える basic auth, API キーはグループを持たないため、グループでの指定はロールを介して行う
+type Rule struct {
+	Users        []string // e.g. basic:user, apikey:ci (policy.MatchUser と同じ形式)
+	Roles        []string
+	Repositories []string // e.g. myteam/app, myteam/* (末尾の * は前方一致), *
+	Actions      []string // pull, push, delete, *
+}
+
+// Issuer は Docker distribution の token authentication (https://distribution.github.io/distribution/spec/auth/token/) のトークンを発行する
+type Issuer struct {
+	Service   string // registry の auth.token.service
+	Issuer    string // registry の auth.token.issuer
+	Key       *rsa.PrivateKey
+	CertChain []*x509.Certificate // 先頭が Key の証明書。registry は x5c を auth.token.rootcertbundle で検証する
+	TokenLife time.Duration
+	Rules     []Rule
+}
+
+type TokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"` // OAuth2 互換
+	ExpiresIn   int    `json:"expires_in"`
+	IssuedAt    string `json:"issued_at"`
+}
+
+func NewIssuer(service, issuer string, key *rsa.PrivateKey, chain []*x509.Certificate, rules []Rule) (*Issuer, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("registry: certificate chain is empty")
+	}
+	pub, ok := chain[0].PublicKey.(*rsa.PublicKey)
+	if !ok || !pub.Equal(&key.PublicKey) {
+		return nil, errors.New("registry: certificate does not match the signing key")
+	}
+	return &Issuer{
+		Service:   service,
+		Issuer:    issuer,
+		Key:       key,
+		CertChain: chain,
+		TokenLife: DefaultTokenLife,
+		Rules:     rules,
+	}, nil
+}
+
+// LoadCertChain は PEM ファイルから証明書を読み込む。先頭が署名鍵の証明書、続けて中間証明書を書く
+func LoadCertChain(path string) ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%s: no certificate found", path)
+	}
+	return chain, nil
+}
+
+// Token は principal に対して、要求された scope のうち許可されたものだけを持つトークンを発行する
+// 許可されない scope は拒否せずに落とす (registry 側で 401 になる)
+func (i *Issuer) Token(principal model.Principal, service string, scopes []string) (TokenResponse, error) {
+	if service != i.Service {
+		return TokenResponse{}, ErrUnknownService
+	}
+
+	access := []Access{}
+	for _, s := range scopes {
+		requested, err := ParseScope(s)
+		if err != nil {
+			return TokenResponse{}, fmt.Errorf("%w: %s", err, s)
+		}
+		if granted, ok := i.authorize(principal, requested); ok {
+			access = append(access, granted)
+		}
+	}
+
+	now := util.NowFunc()
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return TokenResponse{}, err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":    i.Issuer,
+		"sub":    subject(principal),
+		"aud":    i.Service,
+		"exp":    now.Add(i.TokenLife).Unix(),
+		"nbf":    now.Unix(),
+		"iat":    now.Unix(),
+		"jti":    hex.EncodeToString(jti),
+		"access": access,
+	})
+	x5c := make([]string, 0, len(i.CertChain))
+	for _, cert := range i.CertChain {
+		x5c = append(x5c, base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+	token.Header["x5c"] = x5c
+
+	signed, err := token.SignedString(i.Key)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	zap.L().Info("issue registry token", zap.String("sub", subject(principal)), zap.Any("access", access))
+	return TokenResponse{
+		Token:       signed,
+		AccessToken: signed,
+		ExpiresIn:   int(i.TokenLife.Seconds()),
+		IssuedAt:    now.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// authorize は一致するルールで許可された actions の和をとり、要求された actions との共通部分を返す
+func (i *Issuer) authorize(principal model.Principal, requested Access) (Access, bool) {
+	if requested.Type != "repository" {
+		// registry:catalog:* などは許可しない
+		return Access{}, false
+	}
+
+	var allowed []string
+	for _, r := range i.Rules {
+		if !r.matchesPrincipal(principal) || !r.matchesRepository(requested.Name) {
+			continue
+		}
+		allowed = append(allowed, r.Actions...)
+	}
+
+	granted := Access{Type: requested.Type, Name: requested.Name}
+	for _, action := range requested.Actions {
+		if slices.Contains(allowed, "*") || slices.Contains(allowed, action) {
+			granted.Actions = append(granted.Actions, action)
+		}
+	}
+	if len(granted.Actions) == 0 {
+		zap.L().Warn("registry access denied", zap.String("sub", subject(principal)), zap.String("repository", requested.Name), zap.Strings("actions", requested.Actions))
+		return Access{}, false
+	}
+	return granted, true
+}
+
+func (r Rule) matchesPrincipal(principal model.Principal) bool {
+	for _, u := range r.Users {
+		if policy.MatchUser(u, principal) {
+			return true
+		}
+	}
+	for _, role := range r.Roles {
+		if slices.Contains(principal.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) matchesRepository(name string) bool {
+	for _, pattern := range r.Repositories {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+			continue
+		}
+		if pattern == name {
+			return true
+		}
+	}
+	return false
+}
+
+// subject は registry のログに残るユーザ名 (e.g. basic:user)
+func subject(principal model.Principal) string {
+	return principal.Provider + ":" + principal.Name
+}
@@ -0,0 +1,202 @@
+package registry
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/util"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testBaseTime = 1721142000
+
+func newTestIssuer(t *testing.T) *Issuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "registry-token"},
+		NotBefore:    time.Unix(testBaseTime-3600, 0),
+		NotAfter:     time.Unix(testBaseTime+3600, 0),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := NewIssuer("registry.example.com", "go-authenticator", key, []*x509.Certificate{cert}, []Rule{
+		{Users: []string{"basic:user"}, Repositories: []string{"user/*"}, Actions: []string{"*"}},
+		{Roles: []string{"infra"}, Repositories: []string{"infra/*"}, Actions: []string{"pull", "push"}},
+		{Roles: []string{"reader"}, Repositories: []string{"*"}, Actions: []string{"pull"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		scope   string
+		want    Access
+		wantErr bool
+	}{
+		{name: "pull, push", scope: "repository:samalba/my-app:pull,push", want: Access{Type: "repository", Name: "samalba/my-app", Actions: []string{"pull", "push"}}},
+		{name: "host with port", scope: "repository:localhost:5000/foo:pull", want: Access{Type: "repository", Name: "localhost:5000/foo", Actions: []string{"pull"}}},
+		{name: "catalog", scope: "registry:catalog:*", want: Access{Type: "registry", Name: "catalog", Actions: []string{"*"}}},
+		{name: "no actions", scope: "repository:foo", wantErr: true},
+		{name: "empty", scope: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseScope(tt.scope)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseScope() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseScope() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIssuer_Token(t *testing.T) {
+	i := newTestIssuer(t)
+	tests := []struct {
+		name       string
+		principal  model.Principal
+		service    string
+		scopes     []string
+		wantSub    string
+		wantAccess []any
+		wantErr    error
+	}{
+		{
+			name:       "own namespace",
+			principal:  model.Principal{Provider: "basic", Subject: "user", Name: "user"},
+			service:    "registry.example.com",
+			scopes:     []string{"repository:user/app:pull,push,delete"},
+			wantSub:    "basic:user",
+			wantAccess: []any{map[string]any{"type": "repository", "name": "user/app", "actions": []any{"pull", "push", "delete"}}},
+		},
+		{
+			name:       "role: delete is not allowed",
+			principal:  model.Principal{Provider: "basic", Subject: "alice", Name: "alice", Roles: []string{"infra"}},
+			service:    "registry.example.com",
+			scopes:     []string{"repository:infra/app:pull,push,delete"},
+			wantSub:    "basic:alice",
+			wantAccess: []any{map[string]any{"type": "repository", "name": "infra/app", "actions": []any{"pull", "push"}}},
+		},
+		{
+			name:      "role: pull only, multiple scopes",
+			principal: model.Principal{Provider: "apikey", Subject: "ci", Name: "ci", Roles: []string{"reader"}},
+			service:   "registry.example.com",
+			scopes:    []string{"repository:infra/app:pull", "repository:user/app:push"},
+			wantSub:   "apikey:ci",
+			wantAccess: []any{
+				map[string]any{"type": "repository", "name": "infra/app", "actions": []any{"pull"}},
+			},
+		},
+		{
+			name:       "docker login (no scope)",
+			principal:  model.Principal{Provider: "basic", Subject: "user", Name: "user"},
+			service:    "registry.example.com",
+			wantSub:    "basic:user",
+			wantAccess: []any{},
+		},
+		{
+			name:       "catalog is not allowed",
+			principal:  model.Principal{Provider: "basic", Subject: "user", Name: "user", Roles: []string{"reader"}},
+			service:    "registry.example.com",
+			scopes:     []string{"registry:catalog:*"},
+			wantSub:    "basic:user",
+			wantAccess: []any{},
+		},
+		{
+			name:      "unknown service",
+			principal: model.Principal{Provider: "basic", Subject: "user", Name: "user"},
+			service:   "other.example.com",
+			wantErr:   ErrUnknownService,
+		},
+		{
+			name:      "invalid scope",
+			principal: model.Principal{Provider: "basic", Subject: "user", Name: "user"},
+			service:   "registry.example.com",
+			scopes:    []string{"repository"},
+			wantErr:   ErrInvalidScope,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			util.NowFunc = func() time.Time { return time.Unix(testBaseTime, 0) }
+			got, err := i.Token(tt.principal, tt.service, tt.scopes)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Issuer.Token() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Token != got.AccessToken || got.ExpiresIn != 300 || got.IssuedAt != "2024-07-16T15:00:00Z" {
+				t.Errorf("Issuer.Token() = %+v", got)
+			}
+
+			// registry と同じく x5c の証明書で検証する
+			token, err := jwt.Parse(got.Token, func(token *jwt.Token) (interface{}, error) {
+				x5c, _ := token.Header["x5c"].([]any)
+				if len(x5c) != 1 {
+					t.Fatalf("x5c = %v", token.Header["x5c"])
+				}
+				der, err := base64.StdEncoding.DecodeString(x5c[0].(string))
+				if err != nil {
+					return nil, err
+				}
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					return nil, err
+				}
+				return cert.PublicKey, nil
+			}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithTimeFunc(util.NowFunc), jwt.WithAudience("registry.example.com"), jwt.WithIssuer("go-authenticator"))
+			if err != nil {
+				t.Fatalf("failed to verify token: %v", err)
+			}
+			claims := token.Claims.(jwt.MapClaims)
+			if claims["sub"] != tt.wantSub {
+				t.Errorf("sub = %v, want %v", claims["sub"], tt.wantSub)
+			}
+			if !reflect.DeepEqual(claims["access"], tt.wantAccess) {
+				t.Errorf("access = %v, want %v", claims["access"], tt.wantAccess)
+			}
+			if claims["exp"] != float64(testBaseTime+300) || claims["jti"] == "" {
+				t.Errorf("claims = %v", claims)
+			}
+		})
+	}
+}
+
+func TestNewIssuer_keyMismatch(t *testing.T) {
+	i := newTestIssuer(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewIssuer("registry.example.com", "go-authenticator", other, i.CertChain, nil); err == nil {
+		t.Errorf("NewIssuer() error = nil, want error")
+	}
+}
@@ -0,0 +1,40 @@
+package registry
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidScope = errors.New("invalid scope")
+
+// Access は scope (e.g. repository:samalba/my-app:pull,push) で要求された、またはトークンで許可したアクセス
+type Access struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Actions []string `json:"actions"`
+}
+
+// ParseScope は /v2/token の scope パラメータを解釈する
+// リソース名にはポート付きのホスト名 (e.g. localhost:5000/foo) が含まれうるので、最初と最後の ":" で区切る
+func ParseScope(scope string) (Access, error) {
+	typ, rest, ok := strings.Cut(scope, ":")
+	if !ok {
+		return Access{}, ErrInvalidScope
+	}
+	i := strings.LastIndex(rest, ":")
+	if i < 0 {
+		return Access{}, ErrInvalidScope
+	}
+	name, actions := rest[:i], rest[i+1:]
+	if typ == "" || name == "" || actions == "" {
+		return Access{}, ErrInvalidScope
+	}
+
+	a := Access{Type: typ, Name: name}
+	for _, action := range strings.Split(actions, ",") {
+		if action != "" {
+			a.Actions = append(a.Actions, action)
+		}
+	}
+	return a, nil
+}
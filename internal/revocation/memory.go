@@ -0,0 +1,40 @@
+package revocation
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"sync"
+	"time"
+)
+
+// MemoryList は失効させたトークンをメモリ上に有効期限まで保持する
+// 再起動すると失われ、複数台で動かしている場合は共有されない
+type MemoryList struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time // key: token ID, value: トークンの有効期限
+}
+
+func NewMemoryList() *MemoryList {
+	return &MemoryList{revoked: make(map[string]time.Time)}
+}
+
+// Revoke はトークンを失効させる。exp を過ぎたトークンはどのみち使えないので、その時点で忘れる
+func (l *MemoryList) Revoke(id string, exp time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := util.NowFunc()
+	for k, v := range l.revoked {
+		if now.After(v) {
+			delete(l.revoked, k)
+		}
+	}
+	l.revoked[id] = exp
+	return nil
+}
+
+func (l *MemoryList) Revoked(id string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.revoked[id]
+	return ok, nil
+}
@@ -0,0 +1,36 @@
+package revocation
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"testing"
+	"time"
+)
+
+func TestMemoryList(t *testing.T) {
+	now := time.Unix(1721142000, 0)
+	util.NowFunc = func() time.Time { return now }
+	defer func() { util.NowFunc = time.Now }()
+
+	l := NewMemoryList()
+	if err := l.Revoke("a", now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := l.Revoked("a"); !got {
+		t.Errorf("MemoryList.Revoked(a) = false, want true")
+	}
+	if got, _ := l.Revoked("b"); got {
+		t.Errorf("MemoryList.Revoked(b) = true, want false")
+	}
+
+	// 有効期限を過ぎたものは次の Revoke で消える
+	now = now.Add(2 * time.Minute)
+	if err := l.Revoke("b", now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := l.Revoked("a"); got {
+		t.Errorf("MemoryList.Revoked(a) after expiry = true, want false")
+	}
+	if got, _ := l.Revoked("b"); !got {
+		t.Errorf("MemoryList.Revoked(b) = false, want true")
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/audit"
+	"azuki774/go-authenticator/internal/authenticator"
+	"azuki774/go-authenticator/internal/session"
+	"crypto/subtle"
+	"errors"
+	"expvar"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// SessionAdmin はログイン中のセッション (サーバ側のセッション、または jti で記録した JWT) を管理する
+type SessionAdmin interface {
+	ListSessions() ([]session.Session, error)
+	RevokeSession(id string) (found bool, err error)
+	RevokeUserSessions(provider, subject string) (int, error)
+}
+
+// adminSession は管理 API で返すセッションの情報
+type adminSession struct {
+	ID         string    `json:"id"`
+	Provider   string    `json:"provider"`
+	Subject    string    `json:"subject"`
+	Name       string    `json:"name,omitempty"`
+	Email      string    `json:"email,omitempty"`
+	Groups     []string  `json:"groups,omitempty"`
+	Roles      []string  `json:"roles,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// adminHandler は AdminAddr で待ち受ける管理 API。Authorization: Bearer <AdminToken> が必要
+func (s Server) adminHandler() http.Handler {
+	r := chi.NewRouter()
+	r.Use(s.publishAuthReqID)
+	r.Use(s.middlewareLogging)
+	r.Use(s.adminAuth)
+
+	r.Get("/sessions", s.adminListSessions)
+	r.Delete("/sessions/{id}", s.adminRevokeSession)
+	r.Delete("/users/{provider}/{subject}/sessions", s.adminRevokeUserSessions)
+	// GitHub API のキャッシュヒット率などの metrics (expvar)。公開ポートには出さない
+	r.Handle("/debug/vars", expvar.Handler())
+	return r
+}
+
+func (s Server) adminAuth(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.AdminToken)) != 1 {
+			zap.L().Warn("admin api unauthorized", zap.String("remote_addr", r.RemoteAddr))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// adminListSessions はセッションを最終アクセスの新しい順に返す。provider, subject, ip で絞り込める
+// e.g. GET /sessions?provider=github&subject=100000
+func (s Server) adminListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := s.Admin.ListSessions()
+	if err != nil {
+		s.adminError(w, err)
+		return
+	}
+
+	q := r.URL.Query()
+	res := []adminSession{}
+	for _, ss := range sessions {
+		p := ss.Principal
+		if v := q.Get("provider"); v != "" && v != p.Provider {
+			continue
+		}
+		if v := q.Get("subject"); v != "" && v != p.Subject {
+			continue
+		}
+		if v := q.Get("ip"); v != "" && v != ss.IP {
+			continue
+		}
+		res = append(res, adminSession{
+			ID:         ss.ID,
+			Provider:   p.Provider,
+			Subject:    p.Subject,
+			Name:       p.Name,
+			Email:      p.Email,
+			Groups:     p.Groups,
+			Roles:      p.Roles,
+			IP:         ss.IP,
+			CreatedAt:  ss.CreatedAt,
+			LastSeenAt: ss.LastSeenAt,
+			ExpiresAt:  ss.ExpiresAt,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].LastSeenAt.After(res[j].LastSeenAt) })
+	writeJSON(w, http.StatusOK, map[string]any{"sessions": res})
+}
+
+// adminRevokeSession は 1 つのセッションを失効させる
+func (s Server) adminRevokeSession(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	found, err := s.Admin.RevokeSession(id)
+	if err != nil {
+		s.adminError(w, err)
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	zap.L().Info("session revoked by admin", zap.String("id", id))
+	s.audit(r, audit.Event{Type: audit.TypeSessionRevoked, Reason: "admin", Detail: map[string]string{"id": id}})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminRevokeUserSessions はユーザのセッションをすべて失効させる
+func (s Server) adminRevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	provider, subject := chi.URLParam(r, "provider"), chi.URLParam(r, "subject")
+	n, err := s.Admin.RevokeUserSessions(provider, subject)
+	if err != nil {
+		s.adminError(w, err)
+		return
+	}
+	zap.L().Info("user sessions revoked by admin", zap.String("provider", provider), zap.String("subject", subject), zap.Int("revoked", n))
+	s.audit(r, audit.Event{Type: audit.TypeSessionRevoked, Provider: provider, Subject: subject, Reason: "admin", Detail: map[string]string{"count": strconv.Itoa(n)}})
+	writeJSON(w, http.StatusOK, map[string]any{"revoked": n})
+}
+
+func (s Server) adminError(w http.ResponseWriter, err error) {
+	if errors.Is(err, authenticator.ErrSessionTrackingDisabled) {
+		writeJSON(w, http.StatusNotImplemented, map[string]any{"error": err.Error()})
+		return
+	}
+	zap.L().Error("admin api error", zap.Error(err))
+	w.WriteHeader(http.StatusInternalServerError)
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/authenticator"
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/session"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_adminHandler(t *testing.T) {
+	base := time.Unix(1721142000, 0).UTC()
+	sessions := []session.Session{
+		{ID: "s1", Principal: model.Principal{Provider: "github", Subject: "100000", Name: "octocat"}, IP: "192.0.2.1", CreatedAt: base, LastSeenAt: base.Add(time.Minute), ExpiresAt: base.Add(time.Hour)},
+		{ID: "s2", Principal: model.Principal{Provider: "github", Subject: "100000", Name: "octocat"}, IP: "192.0.2.2", CreatedAt: base, LastSeenAt: base.Add(2 * time.Minute), ExpiresAt: base.Add(time.Hour)},
+		{ID: "s3", Principal: model.Principal{Provider: "basic", Subject: "user", Name: "user"}, IP: "192.0.2.1", CreatedAt: base, LastSeenAt: base, ExpiresAt: base.Add(time.Hour)},
+	}
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		token       string
+		err         error
+		wantStatus  int
+		wantBody    string // 含まれていること
+		wantRevoked []string
+	}{
+		{name: "no token", method: "GET", path: "/sessions", wantStatus: http.StatusUnauthorized},
+		{name: "debug vars", method: "GET", path: "/debug/vars", token: "admin-token", wantStatus: http.StatusOK, wantBody: `"github_cache"`},
+		{name: "debug vars without token", method: "GET", path: "/debug/vars", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", method: "GET", path: "/sessions", token: "wrong", wantStatus: http.StatusUnauthorized},
+		{name: "list", method: "GET", path: "/sessions", token: "admin-token", wantStatus: http.StatusOK, wantBody: `"id":"s2"`},
+		{name: "list by ip", method: "GET", path: "/sessions?ip=192.0.2.2", token: "admin-token", wantStatus: http.StatusOK, wantBody: `{"sessions":[{"id":"s2","provider":"github","subject":"100000","name":"octocat","ip":"192.0.2.2","created_at":"2024-07-16T15:00:00Z","last_seen_at":"2024-07-16T15:02:00Z","expires_at":"2024-07-16T16:00:00Z"}]}`},
+		{name: "list none", method: "GET", path: "/sessions?provider=gitlab", token: "admin-token", wantStatus: http.StatusOK, wantBody: `{"sessions":[]}`},
+		{name: "disabled", method: "GET", path: "/sessions", token: "admin-token", err: authenticator.ErrSessionTrackingDisabled, wantStatus: http.StatusNotImplemented},
+		{name: "revoke", method: "DELETE", path: "/sessions/s1", token: "admin-token", wantStatus: http.StatusNoContent, wantRevoked: []string{"s1"}},
+		{name: "revoke unknown", method: "DELETE", path: "/sessions/unknown", token: "admin-token", wantStatus: http.StatusNotFound},
+		{name: "revoke user", method: "DELETE", path: "/users/github/100000/sessions", token: "admin-token", wantStatus: http.StatusOK, wantBody: `{"revoked":2}`, wantRevoked: []string{"s1", "s2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin := &mockSessionAdmin{sessions: sessions, err: tt.err}
+			s := Server{Admin: admin, AdminToken: "admin-token"}
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+
+			s.adminHandler().ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.wantBody)
+			}
+			if !reflect.DeepEqual(admin.revoked, tt.wantRevoked) {
+				t.Errorf("revoked = %v, want %v", admin.revoked, tt.wantRevoked)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/audit"
+	"azuki774/go-authenticator/internal/model"
+	"net/http"
+)
+
+type AuditLogger interface {
+	Log(e audit.Event)
+}
+
+// audit は監査ログに送信元と authRequestId を付けて書き込む。Audit が nil の場合は何もしない
+func (s Server) audit(r *http.Request, e audit.Event) {
+	if s.Audit == nil {
+		return
+	}
+	e.SourceIP = clientIP(r)
+	e.AuthRequestID, _ = r.Context().Value(authReqIdKey).(string)
+	s.Audit.Log(e)
+}
+
+func principalEvent(typ string, principal model.Principal) audit.Event {
+	return audit.Event{Type: typ, Provider: principal.Provider, Subject: principal.Subject, Name: principal.Name}
+}
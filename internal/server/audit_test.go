@@ -0,0 +1,47 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/audit"
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/policy"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestServer_audit(t *testing.T) {
+	logger := &mockAuditLogger{}
+	s := Server{Audit: logger, TrustedProxies: policy.CIDRList{}}
+	r := httptest.NewRequest("GET", "/basic_login", nil)
+	r.RemoteAddr = "192.0.2.1:12345"
+	r = r.WithContext(context.WithValue(r.Context(), authReqIdKey, "abc"))
+
+	s.audit(r, principalEvent(audit.TypeLoginSuccess, model.Principal{Provider: "github", Subject: "100000", Name: "octocat", Groups: []string{"infra"}}))
+	want := []audit.Event{{Type: audit.TypeLoginSuccess, Provider: "github", Subject: "100000", Name: "octocat", SourceIP: "192.0.2.1", AuthRequestID: "abc"}}
+	if !reflect.DeepEqual(logger.events, want) {
+		t.Errorf("events = %+v, want %+v", logger.events, want)
+	}
+
+	// Audit が nil の場合は何もしない
+	Server{}.audit(r, audit.Event{Type: audit.TypeLogout})
+}
+
+func TestServer_adminHandler_audit(t *testing.T) {
+	logger := &mockAuditLogger{}
+	admin := &mockSessionAdmin{}
+	s := Server{Admin: admin, AdminToken: "admin-token", Audit: logger}
+	r := httptest.NewRequest("DELETE", "/users/github/100000/sessions", nil)
+	r.Header.Set("Authorization", "Bearer admin-token")
+	w := httptest.NewRecorder()
+
+	s.adminHandler().ServeHTTP(w, r)
+	if w.Code != http.StatusOK || len(logger.events) != 1 {
+		t.Fatalf("status = %d, events = %v", w.Code, logger.events)
+	}
+	e := logger.events[0]
+	if e.Type != audit.TypeSessionRevoked || e.Provider != "github" || e.Subject != "100000" || e.Detail["count"] != "0" || e.AuthRequestID == "" {
+		t.Errorf("event = %+v", e)
+	}
+}
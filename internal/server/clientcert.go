@@ -0,0 +1,83 @@
+package server
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// nginx の $ssl_client_verify。このヘッダが SUCCESS でなければ証明書を信用しない
+// ClientCAs が設定されていない場合は、このヘッダがないと検証済みかどうかわからないので信用しない
+const XSSLClientVerifyHeader = "X-SSL-Client-Verify"
+
+// clientCertificate は検証済みのクライアント証明書を返す。なければ nil
+// このサーバで TLS を終端している場合は TLS の接続情報から、
+// nginx で終端している場合は信用できるプロキシからの ClientCertHeader ($ssl_client_escaped_cert) から取得する
+func (s *Server) clientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		return r.TLS.VerifiedChains[0][0]
+	}
+
+	if s.ClientCertHeader == "" {
+		return nil
+	}
+	v := r.Header.Get(s.ClientCertHeader)
+	if v == "" {
+		return nil
+	}
+	if !s.TrustedProxies.Contains(remoteIP(r)) {
+		zap.L().Warn("client certificate header from untrusted address", zap.String("Remote-Addr", r.RemoteAddr))
+		return nil
+	}
+	verify := r.Header.Get(XSSLClientVerifyHeader)
+	if verify != "" && verify != "SUCCESS" {
+		zap.L().Warn("client certificate is not verified by proxy", zap.String("verify", verify))
+		return nil
+	}
+	if verify == "" && s.ClientCAs == nil {
+		// ssl_verify_client optional_no_ca や proxy_set_header の設定漏れでは、自己署名の証明書がそのまま渡ってくる
+		zap.L().Warn("client certificate header without " + XSSLClientVerifyHeader + " and no client_ca_file")
+		return nil
+	}
+
+	cert, err := parseCertHeader(v)
+	if err != nil {
+		zap.L().Warn("failed to parse client certificate header", zap.Error(err))
+		return nil
+	}
+
+	// CA が設定されていれば、プロキシが検証済みでもここで再度検証する
+	if s.ClientCAs != nil {
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:     s.ClientCAs,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			zap.L().Warn("failed to verify client certificate", zap.Error(err))
+			return nil
+		}
+	}
+	return cert
+}
+
+// parseCertHeader は URL エンコードされた ($ssl_client_escaped_cert) またはそのままの PEM をパースする
+func parseCertHeader(v string) (*x509.Certificate, error) {
+	if strings.Contains(v, "%") {
+		// nginx は '+' も %2B にエスケープするので PathUnescape で戻す
+		unescaped, err := url.PathUnescape(v)
+		if err != nil {
+			return nil, err
+		}
+		v = unescaped
+	}
+
+	block, _ := pem.Decode([]byte(v))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errInvalidCertPEM
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
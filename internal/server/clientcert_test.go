@@ -0,0 +1,159 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/policy"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestCert は parent で署名した証明書を作る。parent が nil なら自己署名の CA
+func newTestCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func certPEM(cert *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
+
+// escapedCertPEM は nginx の $ssl_client_escaped_cert と同じくエスケープする
+func escapedCertPEM(cert *x509.Certificate) string {
+	return strings.ReplaceAll(url.QueryEscape(certPEM(cert)), "+", "%20")
+}
+
+func TestServer_clientCertificate(t *testing.T) {
+	ca, caKey := newTestCert(t, "test-ca", nil, nil)
+	leaf, _ := newTestCert(t, "deploy-bot", ca, caKey)
+	otherCA, otherKey := newTestCert(t, "other-ca", nil, nil)
+	forged, _ := newTestCert(t, "deploy-bot", otherCA, otherKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	trusted, err := policy.ParseCIDRs([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{TrustedProxies: trusted, ClientCAs: roots, ClientCertHeader: "X-SSL-Client-Cert"}
+	noCA := &Server{TrustedProxies: trusted, ClientCertHeader: "X-SSL-Client-Cert"}
+
+	tests := []struct {
+		name       string
+		s          *Server // nil なら s
+		remoteAddr string
+		header     http.Header
+		wantCN     string // 空なら nil
+	}{
+		{
+			name:       "escaped PEM from trusted proxy",
+			remoteAddr: "127.0.0.1:50000",
+			header:     http.Header{"X-Ssl-Client-Cert": {escapedCertPEM(leaf)}},
+			wantCN:     "deploy-bot",
+		},
+		{
+			name:       "raw PEM from trusted proxy",
+			remoteAddr: "127.0.0.1:50000",
+			header:     http.Header{"X-Ssl-Client-Cert": {certPEM(leaf)}},
+			wantCN:     "deploy-bot",
+		},
+		{
+			name:       "untrusted remote",
+			remoteAddr: "203.0.113.1:50000",
+			header:     http.Header{"X-Ssl-Client-Cert": {escapedCertPEM(leaf)}},
+		},
+		{
+			name:       "not verified by proxy",
+			remoteAddr: "127.0.0.1:50000",
+			header: http.Header{
+				"X-Ssl-Client-Cert":   {escapedCertPEM(leaf)},
+				"X-Ssl-Client-Verify": {"FAILED:unable to verify the first certificate"},
+			},
+		},
+		{
+			name:       "signed by unknown CA",
+			remoteAddr: "127.0.0.1:50000",
+			header:     http.Header{"X-Ssl-Client-Cert": {escapedCertPEM(forged)}},
+		},
+		{
+			name:       "invalid PEM",
+			remoteAddr: "127.0.0.1:50000",
+			header:     http.Header{"X-Ssl-Client-Cert": {"-----BEGIN CERTIFICATE-----\ninvalid"}},
+		},
+		{
+			name:       "no header",
+			remoteAddr: "127.0.0.1:50000",
+		},
+		{
+			name:       "no CA, verified by proxy",
+			s:          noCA,
+			remoteAddr: "127.0.0.1:50000",
+			header: http.Header{
+				"X-Ssl-Client-Cert":   {escapedCertPEM(leaf)},
+				"X-Ssl-Client-Verify": {"SUCCESS"},
+			},
+			wantCN: "deploy-bot",
+		},
+		{
+			name:       "no CA, verify header absent",
+			s:          noCA,
+			remoteAddr: "127.0.0.1:50000",
+			header:     http.Header{"X-Ssl-Client-Cert": {escapedCertPEM(forged)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{RemoteAddr: tt.remoteAddr, Header: tt.header}
+			if r.Header == nil {
+				r.Header = http.Header{}
+			}
+			srv := tt.s
+			if srv == nil {
+				srv = s
+			}
+			got := srv.clientCertificate(r)
+			if tt.wantCN == "" {
+				if got != nil {
+					t.Errorf("Server.clientCertificate() = %v, want nil", got.Subject)
+				}
+				return
+			}
+			if got == nil || got.Subject.CommonName != tt.wantCN {
+				t.Errorf("Server.clientCertificate() = %v, want CN %v", got, tt.wantCN)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// resolveClientIP は送信元の IP アドレスを context に格納する
+// 直接の接続元が TrustedProxies に含まれる場合のみ、X-Forwarded-For, X-Real-IP を信用する
+func (s *Server) resolveClientIP(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := s.clientIPFromRequest(r)
+		ctxWithIP := util.WithClientIP(r.Context(), ip)
+		h.ServeHTTP(w, r.WithContext(ctxWithIP))
+	})
+}
+
+// clientIP は resolveClientIP で格納した送信元の IP アドレスを返す
+func clientIP(r *http.Request) string {
+	if ip, ok := util.ClientIP(r.Context()); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+func (s *Server) clientIPFromRequest(r *http.Request) string {
+	remote := remoteIP(r)
+	if !s.TrustedProxies.Contains(remote) {
+		return remote
+	}
+
+	// X-Forwarded-For は右から順に、信用できるプロキシでない最初のアドレスを送信元とする
+	var forwarded []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, ip := range strings.Split(v, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				forwarded = append(forwarded, ip)
+			}
+		}
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		if net.ParseIP(forwarded[i]) == nil {
+			// 不正な値があればそれより左は信用しない
+			return remote
+		}
+		if !s.TrustedProxies.Contains(forwarded[i]) || i == 0 {
+			return forwarded[i]
+		}
+	}
+
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(ip) != nil {
+		return ip
+	}
+	return remote
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
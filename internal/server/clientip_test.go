@@ -0,0 +1,81 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/policy"
+	"net/http"
+	"testing"
+)
+
+func TestServer_clientIPFromRequest(t *testing.T) {
+	trusted, err := policy.ParseCIDRs([]string{"127.0.0.1", "10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{TrustedProxies: trusted}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       string
+	}{
+		{
+			name:       "direct access",
+			remoteAddr: "203.0.113.1:50000",
+			want:       "203.0.113.1",
+		},
+		{
+			name:       "untrusted remote ignores X-Forwarded-For",
+			remoteAddr: "203.0.113.1:50000",
+			header:     http.Header{"X-Forwarded-For": {"192.0.2.1"}},
+			want:       "203.0.113.1",
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "127.0.0.1:50000",
+			header:     http.Header{"X-Forwarded-For": {"192.0.2.1"}},
+			want:       "192.0.2.1",
+		},
+		{
+			name:       "spoofed X-Forwarded-For",
+			remoteAddr: "127.0.0.1:50000",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1, 192.0.2.1, 10.0.0.5"}},
+			want:       "192.0.2.1",
+		},
+		{
+			name:       "multiple headers",
+			remoteAddr: "127.0.0.1:50000",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1", "192.0.2.1"}},
+			want:       "192.0.2.1",
+		},
+		{
+			name:       "all trusted",
+			remoteAddr: "127.0.0.1:50000",
+			header:     http.Header{"X-Forwarded-For": {"10.0.0.6, 10.0.0.5"}},
+			want:       "10.0.0.6",
+		},
+		{
+			name:       "invalid X-Forwarded-For",
+			remoteAddr: "127.0.0.1:50000",
+			header:     http.Header{"X-Forwarded-For": {"192.0.2.1, unknown"}},
+			want:       "127.0.0.1",
+		},
+		{
+			name:       "X-Real-IP",
+			remoteAddr: "127.0.0.1:50000",
+			header:     http.Header{"X-Real-Ip": {"192.0.2.1"}},
+			want:       "192.0.2.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{RemoteAddr: tt.remoteAddr, Header: tt.header}
+			if r.Header == nil {
+				r.Header = http.Header{}
+			}
+			if got := s.clientIPFromRequest(r); got != tt.want {
+				t.Errorf("Server.clientIPFromRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
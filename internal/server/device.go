@@ -0,0 +1,151 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/oidc"
+	"crypto/subtle"
+	"html/template"
+	"net/http"
+	neturl "net/url"
+
+	"go.uber.org/zap"
+)
+
+// /device の form の CSRF 対策 (double submit cookie)
+const CookieDeviceCSRFName = "device_csrf"
+
+var deviceTemplate = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Device login</title></head>
+<body>
+{{if .Message}}<p>{{.Message}}</p>
+{{else if .Device}}<p>{{if .Device.ClientName}}{{.Device.ClientName}}{{else}}{{.Device.ClientID}}{{end}} is requesting access as <b>{{.User}}</b>.</p>
+<p>Code: <b>{{.Device.UserCode}}</b>{{if .Device.Scope}} / Scope: {{.Device.Scope}}{{end}}</p>
+<form method="post" action="device">
+<input type="hidden" name="user_code" value="{{.Device.UserCode}}">
+<input type="hidden" name="csrf" value="{{.CSRF}}">
+<button type="submit" name="action" value="approve">Approve</button>
+<button type="submit" name="action" value="deny">Deny</button>
+</form>
+{{else}}{{if .Invalid}}<p>The code is invalid or expired.</p>
+{{end}}<form method="get" action="device">
+<label>Enter the code displayed on your device: <input type="text" name="user_code" autofocus></label>
+<button type="submit">Continue</button>
+</form>
+{{end}}</body>
+</html>
+`))
+
+type devicePage struct {
+	Device  *oidc.DeviceInfo
+	User    string
+	CSRF    string
+	Invalid bool
+	Message string
+}
+
+func (s Server) oidcDeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, &oidc.Error{Code: "invalid_request"})
+		return
+	}
+	req := oidc.DeviceAuthorizationRequest{
+		ClientID:     r.PostForm.Get("client_id"),
+		ClientSecret: r.PostForm.Get("client_secret"),
+		Scope:        r.PostForm.Get("scope"),
+	}
+	if id, secret, ok := r.BasicAuth(); ok {
+		req.ClientID, _ = neturl.QueryUnescape(id)
+		req.ClientSecret, _ = neturl.QueryUnescape(secret)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	res, oerr := s.OIDC.DeviceAuthorization(req)
+	if oerr != nil {
+		zap.L().Warn("device authorization failed", zap.String("client_id", req.ClientID), zap.Error(oerr))
+		writeJSON(w, oerr.Status(), oerr)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// deviceVerification は user_code を入力・承認するページ
+func (s Server) deviceVerification(w http.ResponseWriter, r *http.Request) {
+	principal, ok, err := s.Authenticator.CheckCookieJWT(r)
+	if err != nil {
+		zap.L().Warn("invalid session", zap.Error(err))
+		ok = false
+	}
+	if !ok {
+		// 既存のログイン方法でログインしてから戻ってくる
+		s.redirectToLogin(w, r, s.OIDCLoginURL)
+		return
+	}
+
+	page := devicePage{User: principal.Name}
+	if r.Method == http.MethodPost {
+		page.Message = s.deviceDecision(r, principal)
+		renderDevicePage(w, page)
+		return
+	}
+
+	userCode := r.URL.Query().Get("user_code")
+	if userCode != "" {
+		if info, ok := s.OIDC.LookupDevice(userCode); ok {
+			csrf, err := randomToken()
+			if err != nil {
+				zap.L().Error("failed to generate csrf token", zap.Error(err))
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     CookieDeviceCSRFName,
+				Value:    csrf,
+				Path:     "/device",
+				Secure:   s.cookieConfig().Secure,
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+				MaxAge:   600,
+			})
+			page.Device = &info
+			page.CSRF = csrf
+		} else {
+			page.Invalid = true
+		}
+	}
+	renderDevicePage(w, page)
+}
+
+// deviceDecision は承認・拒否の form を処理して、表示するメッセージを返す
+func (s Server) deviceDecision(r *http.Request, principal model.Principal) string {
+	c, err := r.Cookie(CookieDeviceCSRFName)
+	if err != nil || subtle.ConstantTimeCompare([]byte(c.Value), []byte(r.PostFormValue("csrf"))) != 1 {
+		zap.L().Warn("device form csrf mismatched")
+		return "The request has expired. Please enter the code again."
+	}
+
+	userCode := r.PostFormValue("user_code")
+	switch r.PostFormValue("action") {
+	case "approve":
+		if err := s.OIDC.ApproveDevice(userCode, principal); err != nil {
+			return "The code is invalid or expired."
+		}
+		return "Device approved. You can close this window and return to your device."
+	case "deny":
+		if err := s.OIDC.DenyDevice(userCode); err != nil {
+			return "The code is invalid or expired."
+		}
+		return "Device denied."
+	}
+	return "Unknown action."
+}
+
+func renderDevicePage(w http.ResponseWriter, page devicePage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// 承認ボタンを別サイトに埋め込まれないようにする
+	w.Header().Set("X-Frame-Options", "DENY")
+	if err := deviceTemplate.Execute(w, page); err != nil {
+		zap.L().Error("failed to render device page", zap.Error(err))
+	}
+}
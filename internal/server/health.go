@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+)
+
+// ReadinessChecker は /readyz で config, 鍵, プロバイダへの到達性などを確認する
+type ReadinessChecker interface {
+	Ready(ctx context.Context) (results map[string]string, ok bool)
+}
+
+// VersionInfo はビルド時に -ldflags で埋め込まれた値
+type VersionInfo struct {
+	Version  string `json:"version"`
+	Revision string `json:"revision"`
+	Build    string `json:"build"`
+}
+
+type readyResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+type versionResponse struct {
+	VersionInfo
+	GoVersion string `json:"go_version"`
+}
+
+// healthz はプロセスが応答できることのみを返す (liveness)
+func (s Server) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte("ok"))
+}
+
+// readyz はリクエストを受け付けられる状態かどうかを返す (readiness)。失敗したチェックがあれば 503
+func (s Server) readyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if s.Readiness == nil {
+		writeJSON(w, http.StatusOK, readyResponse{Status: "ok"})
+		return
+	}
+	results, ok := s.Readiness.Ready(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusServiceUnavailable, readyResponse{Status: "unavailable", Checks: results})
+		return
+	}
+	writeJSON(w, http.StatusOK, readyResponse{Status: "ok", Checks: results})
+}
+
+func (s Server) version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, versionResponse{VersionInfo: s.Version, GoVersion: runtime.Version()})
+}
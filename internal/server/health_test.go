@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestServer_readyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		readiness  ReadinessChecker
+		wantStatus int
+		wantBody   readyResponse
+	}{
+		{
+			name:       "no checks",
+			readiness:  nil,
+			wantStatus: http.StatusOK,
+			wantBody:   readyResponse{Status: "ok"},
+		},
+		{
+			name:       "ready",
+			readiness:  &mockReadiness{results: map[string]string{"config": "ok", "keys": "ok"}, ok: true},
+			wantStatus: http.StatusOK,
+			wantBody:   readyResponse{Status: "ok", Checks: map[string]string{"config": "ok", "keys": "ok"}},
+		},
+		{
+			name:       "github unreachable",
+			readiness:  &mockReadiness{results: map[string]string{"config": "ok", "github": "connection refused"}, ok: false},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   readyResponse{Status: "unavailable", Checks: map[string]string{"config": "ok", "github": "connection refused"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Server{Readiness: tt.readiness}
+			w := httptest.NewRecorder()
+			s.readyz(w, httptest.NewRequest("GET", "/readyz", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var got readyResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.wantBody) {
+				t.Errorf("body = %+v, want %+v", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestServer_version(t *testing.T) {
+	s := Server{Version: VersionInfo{Version: "v1.2.0", Revision: "0123abc", Build: "v1.2.0-3-g0123abc"}}
+	w := httptest.NewRecorder()
+	s.version(w, httptest.NewRequest("GET", "/version", nil))
+
+	var got map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"version": "v1.2.0", "revision": "0123abc", "build": "v1.2.0-3-g0123abc", "go_version": runtime.Version()}
+	if w.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Errorf("status = %d, body = %v, want %v", w.Code, got, want)
+	}
+}
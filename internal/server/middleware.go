@@ -14,12 +14,18 @@ var authReqIdKey = contextKey("authRequestId")
 
 func (s *Server) middlewareLogging(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			// 数秒ごとに来る probe はログに残さない
+			h.ServeHTTP(w, r)
+			return
+		}
 		v := r.Context().Value(authReqIdKey)
 		authReqId, _ := v.(string)
 		zap.L().Info("access",
 			zap.String("url", r.URL.Path),
 			zap.String("User-Agent", r.UserAgent()),
 			zap.String("Remote-Addr", r.RemoteAddr),
+			zap.String("Client-IP", clientIP(r)),
 			zap.String("authRequestId", authReqId),
 		)
 		h.ServeHTTP(w, r)
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/audit"
+	"azuki774/go-authenticator/internal/notify"
+	"azuki774/go-authenticator/internal/session"
+	"context"
+)
+
+type mockSessionAdmin struct {
+	sessions []session.Session
+	revoked  []string
+	err      error
+}
+
+func (m *mockSessionAdmin) ListSessions() ([]session.Session, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.sessions, nil
+}
+
+func (m *mockSessionAdmin) RevokeSession(id string) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	for _, s := range m.sessions {
+		if s.ID == id {
+			m.revoked = append(m.revoked, id)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockSessionAdmin) RevokeUserSessions(provider, subject string) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	n := 0
+	for _, s := range m.sessions {
+		if s.Principal.Provider == provider && s.Principal.Subject == subject {
+			m.revoked = append(m.revoked, s.ID)
+			n++
+		}
+	}
+	return n, nil
+}
+
+type mockAuditLogger struct {
+	events []audit.Event
+}
+
+func (m *mockAuditLogger) Log(e audit.Event) {
+	m.events = append(m.events, e)
+}
+
+type mockNotifier struct {
+	events []notify.Event
+}
+
+func (m *mockNotifier) Notify(e notify.Event) {
+	m.events = append(m.events, e)
+}
+
+type mockReadiness struct {
+	results map[string]string
+	ok      bool
+}
+
+func (m *mockReadiness) Ready(ctx context.Context) (map[string]string, bool) {
+	return m.results, m.ok
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/audit"
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/notify"
+	"azuki774/go-authenticator/internal/util"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Notifier はセキュリティに関わるイベントを webhook で通知する。待たずに返る
+type Notifier interface {
+	Notify(e notify.Event)
+}
+
+// LoginLimiter はパスワードを連続して間違えたユーザ名・送信元をロックする
+type LoginLimiter interface {
+	Locked(key string) (bool, time.Time)
+	Fail(key string) (locked bool)
+	Reset(key string)
+}
+
+// NewIPDetector はユーザが以前と違う IP アドレスからログインしたことを検出する
+type NewIPDetector interface {
+	Seen(user, ip string) (isNew bool)
+}
+
+// loginSucceeded はログインの成功を監査ログに残し、新しい IP アドレスからであれば通知する
+func (s Server) loginSucceeded(r *http.Request, principal model.Principal) {
+	s.audit(r, principalEvent(audit.TypeLoginSuccess, principal))
+	if s.Notifier == nil || s.KnownIPs == nil {
+		return
+	}
+	ip := clientIP(r)
+	if s.KnownIPs.Seen(principal.Provider+":"+principal.Subject, ip) {
+		s.Notifier.Notify(notify.Event{
+			Type:     notify.TypeLoginNewIP,
+			Provider: principal.Provider,
+			Subject:  principal.Subject,
+			Name:     principal.Name,
+			SourceIP: ip,
+			Message:  "login from a new IP address",
+		})
+	}
+}
+
+func lockoutKeys(r *http.Request, user string) []string {
+	return []string{"user:" + user, "ip:" + clientIP(r)}
+}
+
+// basicAuthLocked はユーザ名または送信元がロックされていれば、ロックが解除される時刻を返す
+func (s Server) basicAuthLocked(r *http.Request, user string) (until time.Time, locked bool) {
+	if s.Lockout == nil {
+		return time.Time{}, false
+	}
+	for _, key := range lockoutKeys(r, user) {
+		if locked, until := s.Lockout.Locked(key); locked {
+			zap.L().Warn("login locked out", zap.String("key", key), zap.Time("until", until))
+			return until, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func setRetryAfter(w http.ResponseWriter, until time.Time) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(until.Sub(util.NowFunc()).Seconds())+1))
+}
+
+// basicAuthFailed はパスワードの失敗を記録し、ロックした場合は監査ログに残して通知する
+func (s Server) basicAuthFailed(r *http.Request, user string) {
+	if s.Lockout == nil {
+		return
+	}
+	for _, key := range lockoutKeys(r, user) {
+		if !s.Lockout.Fail(key) {
+			continue
+		}
+		zap.L().Warn("login lockout triggered", zap.String("key", key))
+		s.audit(r, audit.Event{Type: audit.TypeLoginLockout, Subject: user, Name: user, Detail: map[string]string{"key": key}})
+		if s.Notifier != nil {
+			s.Notifier.Notify(notify.Event{
+				Type:     notify.TypeLoginLockout,
+				Subject:  user,
+				Name:     user,
+				SourceIP: clientIP(r),
+				Message:  "too many failed logins, locked out " + key,
+				Detail:   map[string]string{"key": key},
+			})
+		}
+	}
+}
+
+// basicAuthSucceeded はユーザ名の失敗の記録を消す。送信元の記録は他のユーザ名を試す場合に備えて残す
+// そのユーザ名のパスワードを確認した場合 (provider = basic) のみ消す
+// /v2/token では API キーのときのユーザ名は任意なので、自分の API キーで他人のロックを解除できてしまう
+func (s Server) basicAuthSucceeded(principal model.Principal) {
+	if s.Lockout == nil || principal.Provider != "basic" {
+		return
+	}
+	s.Lockout.Reset("user:" + principal.Subject)
+}
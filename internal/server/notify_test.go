@@ -0,0 +1,105 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/audit"
+	"azuki774/go-authenticator/internal/lockout"
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/notify"
+	"azuki774/go-authenticator/internal/util"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServer_loginSucceeded(t *testing.T) {
+	notifier := &mockNotifier{}
+	logger := &mockAuditLogger{}
+	s := Server{Audit: logger, Notifier: notifier, KnownIPs: notify.NewKnownIPs()}
+	principal := model.Principal{Provider: "github", Subject: "100000", Name: "octocat"}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		wantNotified int
+	}{
+		{name: "first login", remoteAddr: "192.0.2.1:1234", wantNotified: 0},
+		{name: "same ip", remoteAddr: "192.0.2.1:5678", wantNotified: 0},
+		{name: "new ip", remoteAddr: "198.51.100.1:1234", wantNotified: 1},
+		{name: "known ip", remoteAddr: "192.0.2.1:1234", wantNotified: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/basic_login", nil)
+			r.RemoteAddr = tt.remoteAddr
+			s.loginSucceeded(r, principal)
+			if len(notifier.events) != tt.wantNotified {
+				t.Errorf("notified = %d, want %d", len(notifier.events), tt.wantNotified)
+			}
+		})
+	}
+	if e := notifier.events[0]; e.Type != notify.TypeLoginNewIP || e.SourceIP != "198.51.100.1" || e.Subject != "100000" {
+		t.Errorf("event = %+v", e)
+	}
+	if len(logger.events) != len(tests) {
+		t.Errorf("audit events = %d, want %d", len(logger.events), len(tests))
+	}
+}
+
+func TestServer_basicAuthFailed(t *testing.T) {
+	notifier := &mockNotifier{}
+	logger := &mockAuditLogger{}
+	s := Server{Audit: logger, Notifier: notifier, Lockout: lockout.New(3, time.Minute, time.Minute)}
+	r := httptest.NewRequest("GET", "/basic_login", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+
+	for i := 0; i < 2; i++ {
+		s.basicAuthFailed(r, "user")
+	}
+	if _, locked := s.basicAuthLocked(r, "user"); locked {
+		t.Fatalf("locked before max failures")
+	}
+	s.basicAuthFailed(r, "user")
+	if _, locked := s.basicAuthLocked(r, "user"); !locked {
+		t.Fatalf("not locked after max failures")
+	}
+	// ユーザ名と送信元の両方がロックされる
+	if len(notifier.events) != 2 || notifier.events[0].Type != notify.TypeLoginLockout || notifier.events[0].Detail["key"] != "user:user" {
+		t.Errorf("notified = %+v", notifier.events)
+	}
+	if len(logger.events) != 2 || logger.events[1].Type != audit.TypeLoginLockout || logger.events[1].Detail["key"] != "ip:192.0.2.1" {
+		t.Errorf("audit events = %+v", logger.events)
+	}
+
+	other := httptest.NewRequest("GET", "/basic_login", nil)
+	other.RemoteAddr = "198.51.100.1:1234"
+
+	// API キーのときのユーザ名は任意なので、ロックを解除しない
+	s.basicAuthSucceeded(model.Principal{Provider: "apikey", Subject: "ci", Name: "ci"})
+	if _, locked := s.basicAuthLocked(other, "user"); !locked {
+		t.Errorf("user unlocked by api key")
+	}
+
+	// 成功してもユーザ名のみ解除し、送信元はロックしたままにする
+	s.basicAuthSucceeded(model.Principal{Provider: "basic", Subject: "user", Name: "user"})
+	if _, locked := s.basicAuthLocked(other, "user"); locked {
+		t.Errorf("user still locked after reset")
+	}
+	if _, locked := s.basicAuthLocked(r, "admin"); !locked {
+		t.Errorf("ip unlocked after reset")
+	}
+
+	// Lockout が nil の場合は何もしない
+	Server{}.basicAuthFailed(r, "user")
+}
+
+func Test_setRetryAfter(t *testing.T) {
+	now := time.Date(2024, 7, 16, 15, 0, 0, 0, time.UTC)
+	util.NowFunc = func() time.Time { return now }
+	defer func() { util.NowFunc = time.Now }()
+
+	w := httptest.NewRecorder()
+	setRetryAfter(w, now.Add(15*time.Minute))
+	if got := w.Header().Get("Retry-After"); got != "901" {
+		t.Errorf("Retry-After = %s, want 901", got)
+	}
+}
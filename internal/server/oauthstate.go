@@ -0,0 +1,69 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// CookieOAuthStatePrefix は OAuth の state (と nonce) を保持する Cookie 名の prefix。後ろに provider 名が付く
+const CookieOAuthStatePrefix = "oauth_state_"
+
+// oauthStateCookiePath は callback にだけ Cookie が送られるようにする
+const oauthStateCookiePath = "/callback/"
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// startOAuth は provider に渡す state を発行し、callback で検証するために短命の Cookie に保存する
+// withNonce の場合は ID Token に入れてもらう nonce も発行する
+func (s Server) startOAuth(w http.ResponseWriter, provider string, withNonce bool) (state, nonce string, err error) {
+	state, err = randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	value := state
+	if withNonce {
+		nonce, err = randomToken()
+		if err != nil {
+			return "", "", err
+		}
+		value += "." + nonce
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieOAuthStatePrefix + provider,
+		Value:    value,
+		Path:     oauthStateCookiePath,
+		Secure:   s.cookieConfig().Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   600,
+	})
+	return state, nonce, nil
+}
+
+// checkOAuthState は callback の state が startOAuth で発行したものと一致するかを確認し、Cookie を消す
+// 一致すれば発行時の nonce (なければ空) を返す
+func checkOAuthState(w http.ResponseWriter, r *http.Request, provider string) (nonce string, ok bool) {
+	c, err := r.Cookie(CookieOAuthStatePrefix + provider)
+	if err != nil {
+		return "", false
+	}
+	// state は使い捨て
+	http.SetCookie(w, &http.Cookie{Name: CookieOAuthStatePrefix + provider, Path: oauthStateCookiePath, MaxAge: -1})
+
+	state, nonce, _ := strings.Cut(c.Value, ".")
+	got := r.URL.Query().Get("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(got), []byte(state)) != 1 {
+		return "", false
+	}
+	return nonce, true
+}
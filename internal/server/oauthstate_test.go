@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_checkOAuthState(t *testing.T) {
+	tests := []struct {
+		name      string
+		cookie    *http.Cookie
+		query     string
+		wantNonce string
+		wantOK    bool
+	}{
+		{
+			name:      "ok",
+			cookie:    &http.Cookie{Name: CookieOAuthStatePrefix + "google", Value: "state123.nonce456"},
+			query:     "?code=abc&state=state123",
+			wantNonce: "nonce456",
+			wantOK:    true,
+		},
+		{
+			name:   "ok without nonce",
+			cookie: &http.Cookie{Name: CookieOAuthStatePrefix + "google", Value: "state123"},
+			query:  "?code=abc&state=state123",
+			wantOK: true,
+		},
+		{
+			name:   "state mismatched",
+			cookie: &http.Cookie{Name: CookieOAuthStatePrefix + "google", Value: "state123.nonce456"},
+			query:  "?code=abc&state=attacker",
+		},
+		{
+			name:   "state missing",
+			cookie: &http.Cookie{Name: CookieOAuthStatePrefix + "google", Value: "state123.nonce456"},
+			query:  "?code=abc",
+		},
+		{
+			name:  "cookie missing",
+			query: "?code=abc&state=state123",
+		},
+		{
+			name:   "cookie for another provider",
+			cookie: &http.Cookie{Name: CookieOAuthStatePrefix + "gitlab", Value: "state123"},
+			query:  "?code=abc&state=state123",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/callback/google"+tt.query, nil)
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+			w := httptest.NewRecorder()
+
+			gotNonce, gotOK := checkOAuthState(w, r, "google")
+			if gotOK != tt.wantOK {
+				t.Errorf("checkOAuthState() ok = %v, want %v", gotOK, tt.wantOK)
+			}
+			if gotNonce != tt.wantNonce {
+				t.Errorf("checkOAuthState() nonce = %v, want %v", gotNonce, tt.wantNonce)
+			}
+		})
+	}
+}
+
+func TestServer_startOAuth(t *testing.T) {
+	w := httptest.NewRecorder()
+	state, nonce, err := Server{}.startOAuth(w, "google", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state == "" || nonce == "" || state == nonce {
+		t.Fatalf("startOAuth() state = %v, nonce = %v", state, nonce)
+	}
+
+	// 発行した Cookie を callback に持ってくれば通る
+	r := httptest.NewRequest("GET", "/callback/google?code=abc&state="+state, nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	gotNonce, ok := checkOAuthState(httptest.NewRecorder(), r, "google")
+	if !ok || gotNonce != nonce {
+		t.Errorf("checkOAuthState() = %v, %v, want %v, true", gotNonce, ok, nonce)
+	}
+}
@@ -0,0 +1,283 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/audit"
+	"azuki774/go-authenticator/internal/authenticator"
+	"azuki774/go-authenticator/internal/keyring"
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/oidc"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// ログイン後に戻る先 (OIDC の authorize endpoint など) を保存する cookie
+const CookieReturnToName = "return_to"
+
+type OIDCProvider interface {
+	Discovery() oidc.Discovery
+	JWKS() keyring.JWKS
+	ValidateAuthorizeRequest(req oidc.AuthorizeRequest) *oidc.Error
+	IssueCode(req oidc.AuthorizeRequest, principal model.Principal) (string, error)
+	Token(req oidc.TokenRequest) (oidc.TokenResponse, *oidc.Error)
+	UserInfo(accessToken string) (map[string]any, *oidc.Error)
+	// device flow (RFC 8628)
+	DeviceAuthorization(req oidc.DeviceAuthorizationRequest) (oidc.DeviceAuthorizationResponse, *oidc.Error)
+	LookupDevice(userCode string) (oidc.DeviceInfo, bool)
+	ApproveDevice(userCode string, principal model.Principal) error
+	DenyDevice(userCode string) error
+	// introspection, revocation (RFC 7662, RFC 7009)
+	AuthenticateClient(clientID, secret string) (oidc.Client, *oidc.Error)
+}
+
+func (s Server) addOIDCHandler(r *chi.Mux) {
+	r.Get("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.OIDC.Discovery())
+	})
+	r.Get("/oauth2/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.OIDC.JWKS())
+	})
+	r.Get("/oauth2/authorize", s.oidcAuthorize)
+	r.Post("/oauth2/token", s.oidcToken)
+	r.Get("/oauth2/userinfo", s.oidcUserInfo)
+	r.Post("/oauth2/userinfo", s.oidcUserInfo)
+	r.Post("/oauth2/device_authorization", s.oidcDeviceAuthorization)
+	r.Post("/oauth2/introspect", s.oidcIntrospect)
+	r.Post("/oauth2/revoke", s.oidcRevoke)
+	r.Get("/device", s.deviceVerification)
+	r.Post("/device", s.deviceVerification)
+}
+
+func (s Server) oidcAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := oidc.AuthorizeRequest{
+		ResponseType:        q.Get("response_type"),
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		Nonce:               q.Get("nonce"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+		Prompt:              q.Get("prompt"),
+	}
+	if oerr := s.OIDC.ValidateAuthorizeRequest(req); oerr != nil {
+		zap.L().Warn("invalid authorize request", zap.String("client_id", req.ClientID), zap.Error(oerr))
+		if !oerr.Redirectable() {
+			writeJSON(w, oerr.Status(), oerr)
+			return
+		}
+		redirectAuthorizeError(w, r, req, oerr.Code)
+		return
+	}
+
+	// 既存のログイン方法 (basic auth, GitHub など) のセッションを使う
+	principal, ok, err := s.Authenticator.CheckCookieJWT(r)
+	if err != nil {
+		zap.L().Warn("invalid session", zap.Error(err))
+		ok = false
+	}
+	if !ok || principal.Subject == "" {
+		if req.Prompt == "none" {
+			redirectAuthorizeError(w, r, req, "login_required")
+			return
+		}
+		zap.L().Info("login required for oidc", zap.String("client_id", req.ClientID), zap.String("login_url", s.OIDCLoginURL))
+		s.redirectToLogin(w, r, s.OIDCLoginURL)
+		return
+	}
+
+	code, err := s.OIDC.IssueCode(req, principal)
+	if err != nil {
+		zap.L().Error("failed to issue code", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	v := neturl.Values{"code": {code}}
+	if req.State != "" {
+		v.Set("state", req.State)
+	}
+	zap.L().Info("issue oidc code", zap.String("client_id", req.ClientID), zap.String("user", principal.Name))
+	http.Redirect(w, r, appendQuery(req.RedirectURI, v), http.StatusFound)
+}
+
+func (s Server) oidcToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, &oidc.Error{Code: "invalid_request"})
+		return
+	}
+	clientID, clientSecret := clientCredentialsFromRequest(r)
+	req := oidc.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		DeviceCode:   r.PostForm.Get("device_code"),
+		Scope:        r.PostForm.Get("scope"),
+		Audience:     r.PostForm["audience"],
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	res, oerr := s.OIDC.Token(req)
+	if oerr != nil {
+		zap.L().Warn("token request failed", zap.String("client_id", req.ClientID), zap.String("grant_type", req.GrantType), zap.Error(oerr))
+		if oerr.Status() == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+		}
+		writeJSON(w, oerr.Status(), oerr)
+		return
+	}
+	s.audit(r, audit.Event{Type: audit.TypeTokenIssued, Detail: map[string]string{"client_id": req.ClientID, "grant_type": req.GrantType}})
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s Server) oidcUserInfo(w http.ResponseWriter, r *http.Request) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	info, oerr := s.OIDC.UserInfo(token)
+	if oerr != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="`+oerr.Code+`"`)
+		w.WriteHeader(oerr.Status())
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (s Server) oidcIntrospect(w http.ResponseWriter, r *http.Request) {
+	token, ok := s.authenticateTokenEndpointClient(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := s.Authenticator.IntrospectToken(token)
+	if err != nil {
+		zap.L().Error("failed to introspect token", zap.Error(err))
+		writeJSON(w, http.StatusServiceUnavailable, &oidc.Error{Code: "temporarily_unavailable"})
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s Server) oidcRevoke(w http.ResponseWriter, r *http.Request) {
+	token, ok := s.authenticateTokenEndpointClient(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.Authenticator.RevokeToken(token); err != nil {
+		if errors.Is(err, authenticator.ErrRevocationNotSupported) {
+			writeJSON(w, http.StatusBadRequest, &oidc.Error{Code: "unsupported_token_type"})
+			return
+		}
+		zap.L().Error("failed to revoke token", zap.Error(err))
+		writeJSON(w, http.StatusServiceUnavailable, &oidc.Error{Code: "temporarily_unavailable"})
+		return
+	}
+	clientID, _ := clientCredentialsFromRequest(r)
+	s.audit(r, audit.Event{Type: audit.TypeTokenRevoked, Detail: map[string]string{"client_id": clientID}})
+	// 無効なトークンの場合も 200 を返す (RFC 7009 2.2)
+	w.WriteHeader(http.StatusOK)
+}
+
+// authenticateTokenEndpointClient は introspection, revocation endpoint のリクエストから client を認証し、token を取り出す
+func (s Server) authenticateTokenEndpointClient(w http.ResponseWriter, r *http.Request) (token string, ok bool) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, &oidc.Error{Code: "invalid_request"})
+		return "", false
+	}
+	clientID, clientSecret := clientCredentialsFromRequest(r)
+	if _, oerr := s.OIDC.AuthenticateClient(clientID, clientSecret); oerr != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+		writeJSON(w, oerr.Status(), oerr)
+		return "", false
+	}
+
+	token = r.PostForm.Get("token")
+	if token == "" {
+		writeJSON(w, http.StatusBadRequest, &oidc.Error{Code: "invalid_request", Description: "token is required"})
+		return "", false
+	}
+	return token, true
+}
+
+// clientCredentialsFromRequest は client_secret_basic, client_secret_post の client_id, client_secret を返す
+func clientCredentialsFromRequest(r *http.Request) (clientID, clientSecret string) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		clientID, _ = neturl.QueryUnescape(id)
+		clientSecret, _ = neturl.QueryUnescape(secret)
+		return clientID, clientSecret
+	}
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+}
+
+func redirectAuthorizeError(w http.ResponseWriter, r *http.Request, req oidc.AuthorizeRequest, code string) {
+	v := neturl.Values{"error": {code}}
+	if req.State != "" {
+		v.Set("state", req.State)
+	}
+	http.Redirect(w, r, appendQuery(req.RedirectURI, v), http.StatusFound)
+}
+
+func appendQuery(uri string, v neturl.Values) string {
+	if strings.Contains(uri, "?") {
+		return uri + "&" + v.Encode()
+	}
+	return uri + "?" + v.Encode()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		zap.L().Error("failed to write response", zap.Error(err))
+	}
+}
+
+// redirectToLogin はログイン画面に遷移し、ログイン後にこのリクエストの URL に戻ってくるようにする
+func (s Server) redirectToLogin(w http.ResponseWriter, r *http.Request, loginURL string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieReturnToName,
+		Value:    r.URL.RequestURI(),
+		Path:     "/",
+		Secure:   s.cookieConfig().Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   600,
+	})
+	http.Redirect(w, r, loginURL, http.StatusFound)
+}
+
+// redirectAfterLogin はログイン後、return_to cookie があればそこに戻す。なければ ok = false
+func (s Server) redirectAfterLogin(w http.ResponseWriter, r *http.Request) (ok bool) {
+	c, err := r.Cookie(CookieReturnToName)
+	if err != nil {
+		return false
+	}
+	http.SetCookie(w, &http.Cookie{Name: CookieReturnToName, Path: "/", Secure: s.cookieConfig().Secure, MaxAge: -1})
+
+	// オープンリダイレクトにならないよう、このサーバ内のパスのみ許可する
+	returnTo := c.Value
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		zap.L().Warn("invalid return_to", zap.String("return_to", returnTo))
+		return false
+	}
+
+	zap.L().Info(fmt.Sprintf("move to %s", returnTo))
+	http.Redirect(w, r, returnTo, http.StatusFound)
+	return true
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/cookie"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_redirectAfterLogin(t *testing.T) {
+	tests := []struct {
+		name         string
+		returnTo     string // 空なら cookie なし
+		wantOk       bool
+		wantLocation string
+	}{
+		{
+			name:         "authorize endpoint",
+			returnTo:     "/oauth2/authorize?client_id=grafana&state=xyz",
+			wantOk:       true,
+			wantLocation: "/oauth2/authorize?client_id=grafana&state=xyz",
+		},
+		{name: "no cookie", wantOk: false},
+		{name: "absolute URL", returnTo: "https://evil.example.com/", wantOk: false},
+		{name: "protocol relative URL", returnTo: "//evil.example.com/", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/callback/github", nil)
+			if tt.returnTo != "" {
+				r.AddCookie(&http.Cookie{Name: CookieReturnToName, Value: tt.returnTo})
+			}
+			w := httptest.NewRecorder()
+
+			if got := (Server{}).redirectAfterLogin(w, r); got != tt.wantOk {
+				t.Errorf("redirectAfterLogin() = %v, want %v", got, tt.wantOk)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("redirectAfterLogin() Location = %v, want %v", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestServer_redirectToLogin(t *testing.T) {
+	tests := []struct {
+		name       string
+		cookie     cookie.Config
+		wantSecure bool
+	}{
+		{name: "secure", cookie: cookie.Config{Name: "jwt", Path: "/", Secure: true}, wantSecure: true},
+		{name: "not secure (dev mode)", cookie: cookie.Config{Name: "jwt", Path: "/"}, wantSecure: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/device?user_code=ABCD-EFGH", nil)
+			w := httptest.NewRecorder()
+			Server{Cookie: tt.cookie}.redirectToLogin(w, r, "/login_page")
+
+			if got := w.Header().Get("Location"); got != "/login_page" {
+				t.Errorf("redirectToLogin() Location = %v, want /login_page", got)
+			}
+			cookies := w.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Name != CookieReturnToName || cookies[0].Value != "/device?user_code=ABCD-EFGH" {
+				t.Fatalf("redirectToLogin() cookies = %v", cookies)
+			}
+			if cookies[0].Secure != tt.wantSecure {
+				t.Errorf("redirectToLogin() cookie secure = %v, want %v", cookies[0].Secure, tt.wantSecure)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/audit"
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/registry"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+type RegistryTokenIssuer interface {
+	Token(principal model.Principal, service string, scopes []string) (registry.TokenResponse, error)
+}
+
+// registryErrors は Docker registry の API と同じ形式のエラー
+type registryErrors struct {
+	Errors []registryError `json:"errors"`
+}
+
+type registryError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeRegistryError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, registryErrors{Errors: []registryError{{Code: code, Message: message}}})
+}
+
+// registryToken は docker login, docker pull/push で registry から案内されてくる token endpoint
+// e.g. GET /v2/token?service=registry.example.com&scope=repository:myteam/app:pull,push
+func (s Server) registryToken(w http.ResponseWriter, r *http.Request) {
+	if user, _, hasAuth := r.BasicAuth(); hasAuth {
+		if until, locked := s.basicAuthLocked(r, user); locked {
+			s.audit(r, audit.Event{Type: audit.TypeLoginFailure, Subject: user, Name: user, Reason: "locked out", Detail: map[string]string{"service": r.URL.Query().Get("service")}})
+			setRetryAfter(w, until)
+			writeRegistryError(w, http.StatusTooManyRequests, "TOOMANYREQUESTS", "too many failed logins")
+			return
+		}
+	}
+	principal, ok, err := s.Authenticator.CheckBasicCredentials(r)
+	if err != nil {
+		zap.L().Error("failed to check registry credentials", zap.Error(err))
+		writeRegistryError(w, http.StatusInternalServerError, "UNKNOWN", "internal error")
+		return
+	}
+	if !ok {
+		if user, _, hasAuth := r.BasicAuth(); hasAuth {
+			s.audit(r, audit.Event{Type: audit.TypeLoginFailure, Subject: user, Name: user, Reason: "invalid credentials", Detail: map[string]string{"service": r.URL.Query().Get("service")}})
+			s.basicAuthFailed(r, user)
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+		writeRegistryError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+
+	s.basicAuthSucceeded(principal)
+
+	q := r.URL.Query()
+	// scope は複数指定されるか、空白区切りで渡される
+	var scopes []string
+	for _, v := range q["scope"] {
+		scopes = append(scopes, strings.Fields(v)...)
+	}
+
+	res, err := s.Registry.Token(principal, q.Get("service"), scopes)
+	if err != nil {
+		zap.L().Warn("invalid registry token request", zap.String("service", q.Get("service")), zap.Strings("scope", scopes), zap.Error(err))
+		if errors.Is(err, registry.ErrUnknownService) || errors.Is(err, registry.ErrInvalidScope) {
+			writeRegistryError(w, http.StatusBadRequest, "DENIED", err.Error())
+			return
+		}
+		writeRegistryError(w, http.StatusInternalServerError, "UNKNOWN", "internal error")
+		return
+	}
+	e := principalEvent(audit.TypeTokenIssued, principal)
+	e.Detail = map[string]string{"service": q.Get("service"), "scope": strings.Join(scopes, " ")}
+	s.audit(r, e)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, res)
+}
@@ -1,58 +1,216 @@
 package server
 
 import (
+	"azuki774/go-authenticator/internal/audit"
+	"azuki774/go-authenticator/internal/client"
+	"azuki774/go-authenticator/internal/cookie"
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/policy"
+	"azuki774/go-authenticator/internal/util"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
+	"golang.org/x/oauth2"
 )
 
 const XCallBackHeader = "X-Callback-URL"
-const githubOAuthauthorizeURL = "https://github.com/login/oauth/authorize"
+
+var errInvalidCertPEM = errors.New("invalid certificate PEM")
+
+// /auth_jwt_request で upstream に渡すためのユーザ情報のヘッダ (nginx の auth_request_set で受け取る)
+const (
+	XAuthUserHeader   = "X-Auth-User"
+	XAuthGroupsHeader = "X-Auth-Groups"
+	XAuthScopesHeader = "X-Auth-Scopes"
+)
 
 type Server struct {
 	Port          int
 	Authenticator Authenticator
-	CookieLife    int    // token_life, cookie: max-age
-	BasePath      string // BasePath for redirect_url
+	CookieLife    int           // token_life, cookie: max-age
+	Cookie        cookie.Config // JWT を保存する Cookie の属性 (Authenticator と同じもの)。Name が空の場合は cookie.Default()
+	BasePath      string        // BasePath for redirect_url
+
+	GitHubAuthorizeURL string // e.g. https://github.com/login/oauth/authorize
+	GitHubScope        string // e.g. user:read
+
+	Policy *policy.Policy // /auth_jwt_request での認可。nil の場合はすべて許可
+
+	TrustedProxies policy.CIDRList       // X-Forwarded-For, X-Real-IP を信用するプロキシ (nginx) のアドレス
+	Network        *policy.NetworkPolicy // /auth_jwt_request での送信元 IP アドレスによるアクセス制御
+
+	// このサーバで TLS を終端する場合の証明書と秘密鍵
+	TLSCertFile string
+	TLSKeyFile  string
+	// クライアント証明書を検証する CA。TLS を終端する場合は証明書を要求 (任意) し、ヘッダで受け取る場合も検証に使う
+	ClientCAs *x509.CertPool
+	// nginx で TLS を終端する場合に、クライアント証明書を受け取るヘッダ (e.g. X-SSL-Client-Cert)
+	ClientCertHeader string
+
+	// GitHub 以外の OAuth2 プロバイダの設定。key は /login_page/{provider} の provider
+	OAuthConfigs map[string]*oauth2.Config
+
+	OIDC         OIDCProvider // nil の場合は OpenID Connect Provider として動かない
+	OIDCLoginURL string       // OIDC の authorize endpoint で未ログインのときに遷移する先 (e.g. /login_page)
+
+	Registry RegistryTokenIssuer // nil の場合は Docker registry の token endpoint (/v2/token) を提供しない
+
+	TokenReviewer    TokenReviewer   // nil の場合は Kubernetes の TokenReview webhook (/tokenreview) を提供しない
+	TokenReviewAllow policy.CIDRList // TokenReview を受け付ける送信元 (kube-apiserver) のアドレス。空の場合はすべて
+
+	SSO         SSOHandoff // nil の場合は Cookie に Domain を付けず、ドメインをまたいだ SSO をしない
+	SSOURL      string     // ログイン画面のあるこのサーバの URL (e.g. https://auth.example.com)
+	SSOLoginURL string     // /sso/start で未ログインのときに遷移する先 (e.g. /login_page)
+
+	Admin      SessionAdmin // nil の場合は管理 API を提供しない
+	AdminAddr  string       // 管理 API の待ち受けアドレス (e.g. 127.0.0.1:9888)。/auth_jwt_request などとは別のポートにする
+	AdminToken string       // 管理 API の Authorization: Bearer
+
+	Audit AuditLogger // nil の場合は監査ログを書かない
+
+	Notifier Notifier      // nil の場合は webhook で通知しない
+	KnownIPs NewIPDetector // nil の場合は新しい IP アドレスからのログインを通知しない
+	Lockout  LoginLimiter  // nil の場合は basic auth のパスワードを間違えてもロックしない
+
+	Readiness ReadinessChecker // nil の場合は /readyz は常に ok を返す
+	Version   VersionInfo      // /version で返す
 }
 
 type Authenticator interface {
 	CheckBasicAuth(r *http.Request) bool
-	CheckCookieJWT(r *http.Request) (ok bool, err error)
-	GenerateCookie(life int) (*http.Cookie, error)
+	CheckCookieJWT(r *http.Request) (principal model.Principal, ok bool, err error)
+	// Authorization: Bearer の JWT または API キーを検証する
+	CheckBearerToken(r *http.Request) (principal model.Principal, ok bool, err error)
+	// Authorization: Basic の basic auth のパスワードまたは API キーを検証する
+	CheckBasicCredentials(r *http.Request) (principal model.Principal, ok bool, err error)
+	// JWT を保存する Cookie を返す。長い場合は複数に分割される
+	GenerateCookie(life int, principal model.Principal) ([]*http.Cookie, error)
 	// GitHub OAuth2 で access_token 引き換え code 入力から、JWT発行してよいかどうかを判断するところまで
-	HandlingGitHubOAuth(ctx context.Context, code string) (ok bool, err error)
+	HandlingGitHubOAuth(ctx context.Context, code string) (principal model.Principal, ok bool, err error)
+	// Google OIDC で code 入力から、JWT発行してよいかどうかを判断するところまで
+	HandlingGoogleOAuth(ctx context.Context, code, nonce string) (principal model.Principal, ok bool, err error)
+	HandlingGitLabOAuth(ctx context.Context, code string) (principal model.Principal, ok bool, err error)
+	HandlingGiteaOAuth(ctx context.Context, code string) (principal model.Principal, ok bool, err error)
+	// 検証済みのクライアント証明書から、JWT発行してよいかどうかを判断する
+	HandlingClientCert(cert *x509.Certificate) (principal model.Principal, ok bool)
+	// RFC 7662 の introspection response。CheckCookieJWT と同じ検証をする
+	IntrospectToken(token string) (map[string]any, error)
+	// RFC 7009 のトークン失効。無効なトークンは無視する
+	RevokeToken(token string) error
+	// Cookie のセッションを削除する (JWT の場合は失効リストがあれば失効させる)
+	Logout(r *http.Request) error
 }
 
 func (s Server) addHandler(r *chi.Mux) {
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("OK"))
 	})
+	r.Get("/healthz", s.healthz)
+	r.Get("/readyz", s.readyz)
+	r.Get("/version", s.version)
 
 	r.Get("/auth_jwt_request", func(w http.ResponseWriter, r *http.Request) {
-		ok, err := s.Authenticator.CheckCookieJWT(r)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+		sourceIP := clientIP(r)
+		if !s.Network.Allowed(sourceIP) {
+			zap.L().Warn("access denied by network", zap.String("client_ip", sourceIP))
+			host, path := requestTarget(r)
+			s.audit(r, audit.Event{Type: audit.TypeAccessDenied, Reason: "network", Detail: map[string]string{"host": host, "path": path}})
+			w.WriteHeader(http.StatusForbidden)
 			return
 		}
+		s.setSSOHeaders(w, r)
+
+		// ログイン不要なネットワークからのアクセスは、設定された principal として扱う
+		principal, ok := s.Network.BypassPrincipal(sourceIP)
 		if !ok {
-			w.WriteHeader(http.StatusUnauthorized)
+			// クライアント証明書があれば、それで認証する
+			if cert := s.clientCertificate(r); cert != nil {
+				principal, ok = s.Authenticator.HandlingClientCert(cert)
+			}
+		}
+		if !ok {
+			// スクリプトや CI からは Cookie の代わりに Authorization: Bearer で認証する
+			var err error
+			principal, ok, err = s.Authenticator.CheckBearerToken(r)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+		if !ok {
+			var err error
+			principal, ok, err = s.Authenticator.CheckCookieJWT(r)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+
+		// auth ok, 次にアクセス先に対する認可
+		host, path := requestTarget(r)
+		decision := s.Policy.Evaluate(policy.Request{
+			Principal: principal,
+			Host:      host,
+			Path:      path,
+			Headers:   r.Header,
+			SourceIP:  sourceIP,
+		})
+		if !decision.Allowed {
+			zap.L().Warn("access denied by policy",
+				zap.String("provider", principal.Provider),
+				zap.String("user", principal.Name),
+				zap.String("host", host),
+				zap.String("path", path),
+				zap.String("decision", decision.String()),
+			)
+			e := principalEvent(audit.TypeAccessDenied, principal)
+			e.Reason = decision.String()
+			e.Detail = map[string]string{"host": host, "path": path}
+			s.audit(r, e)
+			w.WriteHeader(http.StatusForbidden)
 			return
 		}
 
-		// auth ok
+		w.Header().Set(XAuthUserHeader, principal.Name)
+		w.Header().Set(XAuthGroupsHeader, strings.Join(principal.Roles, ","))
+		if len(principal.Scopes) > 0 {
+			w.Header().Set(XAuthScopesHeader, strings.Join(principal.Scopes, ","))
+		}
 	})
 
 	r.Get("/basic_login", func(w http.ResponseWriter, r *http.Request) {
+		if user, _, hasAuth := r.BasicAuth(); hasAuth {
+			if until, locked := s.basicAuthLocked(r, user); locked {
+				s.audit(r, audit.Event{Type: audit.TypeLoginFailure, Provider: "basic", Subject: user, Name: user, Reason: "locked out"})
+				setRetryAfter(w, until)
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+		}
 		ok := s.Authenticator.CheckBasicAuth(r)
 		if !ok {
+			if user, _, hasAuth := r.BasicAuth(); hasAuth {
+				s.audit(r, audit.Event{Type: audit.TypeLoginFailure, Provider: "basic", Subject: user, Name: user, Reason: "invalid credentials"})
+				s.basicAuthFailed(r, user)
+			}
 			w.Header().Add("WWW-Authenticate", `Basic realm="SECRET AREA"`)
 			w.WriteHeader(http.StatusUnauthorized) // 401
 			return
@@ -60,24 +218,73 @@ func (s Server) addHandler(r *chi.Mux) {
 
 		// new cookie
 		// Generate Cookie
-		cookie, err := s.Authenticator.GenerateCookie(s.CookieLife)
+		user, _, _ := r.BasicAuth()
+		principal := model.Principal{Provider: "basic", Subject: user, Name: user}
+		s.basicAuthSucceeded(principal)
+		cookies, err := s.Authenticator.GenerateCookie(s.CookieLife, principal)
+		if err != nil {
+			return
+		}
+		s.loginSucceeded(r, principal)
+
+		s.setSessionCookie(w, r, cookies)
+		zap.L().Info("set Cookie")
+		s.redirectAfterLogin(w, r)
+	})
+
+	r.Get("/mtls_login", func(w http.ResponseWriter, r *http.Request) {
+		cert := s.clientCertificate(r)
+		if cert == nil {
+			zap.L().Warn("client certificate is not presented")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		principal, ok := s.Authenticator.HandlingClientCert(cert)
+		if !ok {
+			s.audit(r, audit.Event{Type: audit.TypeLoginFailure, Provider: "mtls", Subject: cert.Subject.CommonName, Reason: "certificate not allowed"})
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		cookies, err := s.Authenticator.GenerateCookie(s.CookieLife, principal)
 		if err != nil {
 			return
 		}
+		s.loginSucceeded(r, principal)
 
-		http.SetCookie(w, cookie)
+		s.setSessionCookie(w, r, cookies)
 		zap.L().Info("set Cookie")
+		s.redirectAfterLogin(w, r)
+	})
+
+	r.Get("/logout", func(w http.ResponseWriter, r *http.Request) {
+		if principal, ok, _ := s.Authenticator.CheckCookieJWT(r); ok {
+			s.audit(r, principalEvent(audit.TypeLogout, principal))
+		}
+		if err := s.Authenticator.Logout(r); err != nil {
+			// Cookie は消すので、ブラウザからはログアウトした状態になる
+			zap.L().Warn("failed to delete session", zap.Error(err))
+		}
+		s.setSessionCookie(w, r, s.cookieConfig().Cookies("", -1))
+		zap.L().Info("logout")
+		http.Redirect(w, r, s.BasePath, http.StatusFound)
 	})
 
 	r.Get("/login_page", func(w http.ResponseWriter, r *http.Request) {
 		clientId := os.Getenv("GITHUB_CLIENT_ID")    // TODO
 		redirectURL := r.Header.Get(XCallBackHeader) // 指定するコールバック先のURL
+		state, _, err := s.startOAuth(w, "github", false)
+		if err != nil {
+			zap.L().Error("failed to generate oauth state", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 		var url string
 		if redirectURL != "" {
 			// コールバック先明示
-			url = fmt.Sprintf("%s?client_id=%s&redirect_uri=%s&scope=user:read", githubOAuthauthorizeURL, clientId, redirectURL)
+			url = fmt.Sprintf("%s?client_id=%s&redirect_uri=%s&scope=%s&state=%s", s.GitHubAuthorizeURL, clientId, redirectURL, neturl.QueryEscape(s.GitHubScope), state)
 		} else {
-			url = fmt.Sprintf("%s?client_id=%s&scope=user:read", githubOAuthauthorizeURL, clientId)
+			url = fmt.Sprintf("%s?client_id=%s&scope=%s&state=%s", s.GitHubAuthorizeURL, clientId, neturl.QueryEscape(s.GitHubScope), state)
 		}
 
 		zap.L().Info(fmt.Sprintf("move to %s", url))
@@ -95,34 +302,167 @@ func (s Server) addHandler(r *chi.Mux) {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
+		if _, ok := checkOAuthState(w, r, "github"); !ok {
+			zap.L().Warn("oauth state is mismatched")
+			s.audit(r, audit.Event{Type: audit.TypeLoginFailure, Provider: "github", Reason: "invalid state"})
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 
-		ok, err := s.Authenticator.HandlingGitHubOAuth(r.Context(), code)
+		principal, ok, err := s.Authenticator.HandlingGitHubOAuth(r.Context(), code)
 		if err != nil {
+			s.audit(r, audit.Event{Type: audit.TypeLoginFailure, Provider: "github", Reason: "provider error"})
+			// GitHub API の rate limit に達している場合は、解除されるまで待ってもらう
+			var rateLimitErr *client.RateLimitError
+			if errors.As(err, &rateLimitErr) {
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(rateLimitErr.Until)))
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
 		if !ok {
 			zap.L().Warn("this user is not authorized")
+			e := principalEvent(audit.TypeLoginFailure, principal)
+			e.Provider = "github"
+			e.Reason = "not authorized"
+			s.audit(r, e)
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
 		// ここまで問題なければ JWT トークンを発行
-		cookie, err := s.Authenticator.GenerateCookie(s.CookieLife)
+		cookies, err := s.Authenticator.GenerateCookie(s.CookieLife, principal)
 		if err != nil {
 			return
 		}
+		s.loginSucceeded(r, principal)
 
-		http.SetCookie(w, cookie)
+		s.setSessionCookie(w, r, cookies)
 		zap.L().Info("set Cookie")
 
-		// エラーでなければ親ページに返してあげる
-		zap.L().Info(fmt.Sprintf("move to %s", s.BasePath))
-		http.Redirect(w, r, s.BasePath, http.StatusFound)
+		// エラーでなければ親ページ (OIDC の authorize 途中なら return_to) に返してあげる
+		if !s.redirectAfterLogin(w, r) {
+			zap.L().Info(fmt.Sprintf("move to %s", s.BasePath))
+			http.Redirect(w, r, s.BasePath, http.StatusFound)
+		}
 
 		zap.L().Info("callback process done")
 	})
+
+	r.Get("/login_page/{provider}", func(w http.ResponseWriter, r *http.Request) {
+		provider := chi.URLParam(r, "provider")
+		conf, ok := s.OAuthConfigs[provider]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		// Google は ID Token を使うので、nonce も付けてリプレイを防ぐ
+		withNonce := provider == "google"
+		state, nonce, err := s.startOAuth(w, provider, withNonce)
+		if err != nil {
+			zap.L().Error("failed to generate oauth state", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var opts []oauth2.AuthCodeOption
+		if withNonce {
+			opts = append(opts, oauth2.SetAuthURLParam("nonce", nonce))
+		}
+		url := conf.AuthCodeURL(state, opts...)
+		zap.L().Info(fmt.Sprintf("move to %s", url))
+		http.Redirect(w, r, url, http.StatusFound)
+	})
+
+	r.Get("/callback/google", s.oauthCallback("google", s.Authenticator.HandlingGoogleOAuth))
+	r.Get("/callback/gitlab", s.oauthCallback("gitlab", ignoreNonce(s.Authenticator.HandlingGitLabOAuth)))
+	r.Get("/callback/gitea", s.oauthCallback("gitea", ignoreNonce(s.Authenticator.HandlingGiteaOAuth)))
+
+	if s.OIDC != nil {
+		s.addOIDCHandler(r)
+	}
+	if s.Registry != nil {
+		r.Get("/v2/token", s.registryToken)
+	}
+	if s.TokenReviewer != nil {
+		r.Post("/tokenreview", s.tokenReview)
+	}
+	if s.SSO != nil {
+		r.Get("/sso/begin", s.ssoBegin)
+		r.Get("/sso/start", s.ssoStart)
+		r.Get("/sso/callback", s.ssoCallback)
+	}
+}
+
+// oauthHandling は code (と login_page で発行した nonce) から principal を得る
+type oauthHandling func(ctx context.Context, code, nonce string) (model.Principal, bool, error)
+
+// ignoreNonce は ID Token を使わない provider の処理を oauthHandling にする
+func ignoreNonce(h func(ctx context.Context, code string) (model.Principal, bool, error)) oauthHandling {
+	return func(ctx context.Context, code, _ string) (model.Principal, bool, error) {
+		return h(ctx, code)
+	}
+}
+
+// oauthCallback は GitHub 以外の OAuth2 プロバイダの callback を処理する handler を返す
+func (s Server) oauthCallback(provider string, handling oauthHandling) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		zap.L().Info("callback received", zap.String("provider", provider))
+		if _, ok := s.OAuthConfigs[provider]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			zap.L().Warn("code is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		nonce, ok := checkOAuthState(w, r, provider)
+		if !ok {
+			zap.L().Warn("oauth state is mismatched", zap.String("provider", provider))
+			s.audit(r, audit.Event{Type: audit.TypeLoginFailure, Provider: provider, Reason: "invalid state"})
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		principal, ok, err := handling(r.Context(), code, nonce)
+		if err != nil {
+			s.audit(r, audit.Event{Type: audit.TypeLoginFailure, Provider: provider, Reason: "provider error"})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if !ok {
+			zap.L().Warn("this user is not authorized")
+			e := principalEvent(audit.TypeLoginFailure, principal)
+			e.Provider = provider
+			e.Reason = "not authorized"
+			s.audit(r, e)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		cookies, err := s.Authenticator.GenerateCookie(s.CookieLife, principal)
+		if err != nil {
+			return
+		}
+		s.loginSucceeded(r, principal)
+
+		s.setSessionCookie(w, r, cookies)
+		zap.L().Info("set Cookie")
+
+		if !s.redirectAfterLogin(w, r) {
+			zap.L().Info(fmt.Sprintf("move to %s", s.BasePath))
+			http.Redirect(w, r, s.BasePath, http.StatusFound)
+		}
+
+		zap.L().Info("callback process done")
+	}
 }
 
 func (s Server) Serve() error {
@@ -132,6 +472,7 @@ func (s Server) Serve() error {
 
 	r := chi.NewRouter()
 	r.Use(s.publishAuthReqID)
+	r.Use(s.resolveClientIP)
 	r.Use(s.middlewareLogging)
 	s.addHandler(r)
 
@@ -140,8 +481,28 @@ func (s Server) Serve() error {
 		Handler: r,
 	}
 
-	zap.L().Info("start server", zap.Int("port", s.Port))
-	go srv.ListenAndServe()
+	if s.TLSCertFile != "" {
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if s.ClientCAs != nil {
+			srv.TLSConfig.ClientCAs = s.ClientCAs
+			srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+		zap.L().Info("start server (TLS)", zap.Int("port", s.Port))
+		go srv.ListenAndServeTLS(s.TLSCertFile, s.TLSKeyFile)
+	} else {
+		zap.L().Info("start server", zap.Int("port", s.Port))
+		go srv.ListenAndServe()
+	}
+
+	var adminSrv *http.Server
+	if s.Admin != nil {
+		adminSrv = &http.Server{
+			Addr:    s.AdminAddr,
+			Handler: s.adminHandler(),
+		}
+		zap.L().Info("start admin server", zap.String("addr", s.AdminAddr))
+		go adminSrv.ListenAndServe()
+	}
 
 	<-ctx.Done()
 	zap.L().Info("shutdown signal detected")
@@ -149,6 +510,11 @@ func (s Server) Serve() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(ctx); err != nil {
+			zap.L().Error("admin server shutdown error", zap.Error(err))
+		}
+	}
 	err := srv.Shutdown(ctx)
 	if err != nil {
 		zap.L().Error("server shutdown error", zap.Error(err))
@@ -158,3 +524,29 @@ func (s Server) Serve() error {
 	zap.L().Info("shutdown server gracefully")
 	return nil
 }
+
+// retryAfterSeconds は until までの秒数 (切り上げ) を返す。until を過ぎている場合も 1 秒は待ってもらう
+func retryAfterSeconds(until time.Time) int {
+	sec := int(math.Ceil(until.Sub(util.NowFunc()).Seconds()))
+	return max(sec, 1)
+}
+
+func (s Server) cookieConfig() cookie.Config {
+	if s.Cookie.Name == "" {
+		return cookie.Default()
+	}
+	return s.Cookie
+}
+
+// setSessionCookie は JWT の Cookie をセットし、以前の長いトークンの断片が残っていれば削除する
+// ドメインをまたいだ SSO の場合は、ログインしたリクエストの host が属するドメインに Domain を変える
+func (s Server) setSessionCookie(w http.ResponseWriter, r *http.Request, cookies []*http.Cookie) {
+	for _, c := range append(cookies, s.cookieConfig().Stale(r, len(cookies))...) {
+		if s.SSO != nil {
+			if domain, ok := s.SSO.Domain(r.Host); ok {
+				c.Domain = domain
+			}
+		}
+		http.SetCookie(w, c)
+	}
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"testing"
+	"time"
+)
+
+func Test_retryAfterSeconds(t *testing.T) {
+	now := time.Unix(1721142000, 0)
+	util.NowFunc = func() time.Time { return now }
+	defer func() { util.NowFunc = time.Now }()
+
+	tests := []struct {
+		name  string
+		until time.Time
+		want  int
+	}{
+		{name: "future", until: now.Add(30 * time.Second), want: 30},
+		{name: "round up", until: now.Add(1500 * time.Millisecond), want: 2},
+		{name: "now", until: now, want: 1},
+		{name: "past", until: now.Add(-time.Minute), want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfterSeconds(tt.until); got != tt.want {
+				t.Errorf("retryAfterSeconds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
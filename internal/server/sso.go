@@ -0,0 +1,158 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/sso"
+	"net/http"
+	neturl "net/url"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// /auth_jwt_request で返す、アクセス先が属する Cookie のドメインと、そのドメインでログインするための URL
+// nginx では auth_request_set で受け取り、401 のときに X-Auth-Login-URL にリダイレクトする
+const (
+	XAuthCookieDomainHeader = "X-Auth-Cookie-Domain"
+	XAuthLoginURLHeader     = "X-Auth-Login-URL"
+)
+
+// CookieSSONonceName は /sso/begin で受け取る側のドメインにセットし、/sso/callback で code と照合する Cookie
+const CookieSSONonceName = "sso_nonce"
+
+// ssoNonceCookiePath は /sso/callback にだけ Cookie が送られるようにする
+const ssoNonceCookiePath = "/sso/callback"
+
+type SSOHandoff interface {
+	Domain(host string) (string, bool)
+	IssueCode(token string, returnTo string, nonce string) (callbackURL string, err error)
+	Exchange(code string, host string, nonce string) (sso.Grant, bool)
+}
+
+// setSSOHeaders は /auth_jwt_request のアクセス先から、Cookie のドメインとログイン用の URL をヘッダにセットする
+// ログイン用の URL はアクセス先の host の /sso/begin (相対 URL)
+func (s Server) setSSOHeaders(w http.ResponseWriter, r *http.Request) {
+	if s.SSO == nil {
+		return
+	}
+	host, _ := requestTarget(r)
+	domain, ok := s.SSO.Domain(host)
+	if !ok {
+		return
+	}
+	w.Header().Set(XAuthCookieDomainHeader, domain)
+
+	returnTo := originalURL(r)
+	w.Header().Set(XAuthLoginURLHeader, "/sso/begin?"+neturl.Values{"return_to": {returnTo}}.Encode())
+}
+
+// originalURL は nginx の auth_request から渡された、本来のアクセス先の URL を返す
+func originalURL(r *http.Request) string {
+	if v := r.Header.Get(XOriginalURLHeader); v != "" {
+		return v
+	}
+	host, path := requestTarget(r)
+	scheme := r.Header.Get("X-Forwarded-Proto")
+	if scheme == "" {
+		scheme = "https"
+	}
+	if uri := r.Header.Get(XForwardedURIHeader); uri != "" {
+		path = uri
+	}
+	return scheme + "://" + host + path
+}
+
+// ssoBegin は受け取る側のドメイン (nginx でこのサーバにプロキシする) で、このブラウザだけが code を引き換えられるように nonce の Cookie をセットし、/sso/start に遷移する
+// e.g. GET https://grafana.example.org/sso/begin?return_to=https://grafana.example.org/
+func (s Server) ssoBegin(w http.ResponseWriter, r *http.Request) {
+	returnTo := r.URL.Query().Get("return_to")
+
+	// nonce の Cookie は /sso/callback のある return_to の host でしか読めない
+	u, err := neturl.Parse(returnTo)
+	if err != nil || !strings.EqualFold(u.Host, r.Host) {
+		zap.L().Warn("sso return_to is not on this host", zap.String("host", r.Host), zap.String("return_to", returnTo))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		zap.L().Error("failed to generate sso nonce", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieSSONonceName,
+		Value:    nonce,
+		Path:     ssoNonceCookiePath,
+		Secure:   s.cookieConfig().Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode, // ログイン画面のドメインからのリダイレクトで送られるようにする
+		MaxAge:   600,
+	})
+	http.Redirect(w, r, s.SSOURL+"/sso/start?"+neturl.Values{"return_to": {returnTo}, "nonce": {nonce}}.Encode(), http.StatusFound)
+}
+
+// ssoStart はログイン画面のあるドメインで、return_to のドメインに Cookie を受け渡す code を発行する
+// e.g. GET /sso/start?return_to=https://grafana.example.org/&nonce=...
+func (s Server) ssoStart(w http.ResponseWriter, r *http.Request) {
+	returnTo := r.URL.Query().Get("return_to")
+	nonce := r.URL.Query().Get("nonce")
+	if nonce == "" {
+		// /sso/begin を経由していない
+		zap.L().Warn("sso nonce is missing", zap.String("return_to", returnTo))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	principal, ok, err := s.Authenticator.CheckCookieJWT(r)
+	if err != nil {
+		zap.L().Warn("invalid session", zap.Error(err))
+		ok = false
+	}
+	if !ok {
+		zap.L().Info("login required for sso", zap.String("return_to", returnTo), zap.String("login_url", s.SSOLoginURL))
+		s.redirectToLogin(w, r, s.SSOLoginURL)
+		return
+	}
+	token, ok := s.cookieConfig().Value(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	callbackURL, err := s.SSO.IssueCode(token, returnTo, nonce)
+	if err != nil {
+		zap.L().Warn("failed to issue sso handoff code", zap.String("return_to", returnTo), zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	zap.L().Info("sso handoff", zap.String("user", principal.Name), zap.String("return_to", returnTo))
+	http.Redirect(w, r, callbackURL, http.StatusFound)
+}
+
+// ssoCallback は各ドメインの /sso/callback (nginx でこのサーバにプロキシする) で code を JWT と引き換え、そのドメインに Cookie をセットする
+// code は /sso/begin で nonce の Cookie をセットしたブラウザでのみ引き換えられる
+func (s Server) ssoCallback(w http.ResponseWriter, r *http.Request) {
+	var nonce string
+	if c, err := r.Cookie(CookieSSONonceName); err == nil {
+		nonce = c.Value
+	}
+	// nonce は使い捨て
+	http.SetCookie(w, &http.Cookie{Name: CookieSSONonceName, Path: ssoNonceCookiePath, Secure: s.cookieConfig().Secure, MaxAge: -1})
+
+	grant, ok := s.SSO.Exchange(r.URL.Query().Get("code"), r.Host, nonce)
+	if !ok {
+		zap.L().Warn("invalid sso handoff code", zap.String("host", r.Host))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c := s.cookieConfig()
+	c.Domain = grant.Domain
+	cookies := c.Cookies(grant.Token, s.CookieLife)
+	for _, ck := range append(cookies, c.Stale(r, len(cookies))...) {
+		http.SetCookie(w, ck)
+	}
+	zap.L().Info("set Cookie by sso handoff", zap.String("domain", grant.Domain))
+	http.Redirect(w, r, grant.ReturnTo, http.StatusFound)
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/sso"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"testing"
+)
+
+func TestServer_setSSOHeaders(t *testing.T) {
+	tests := []struct {
+		name             string
+		headers          map[string]string
+		wantCookieDomain string
+		wantLoginURL     string
+	}{
+		{
+			name:             "X-Original-URL",
+			headers:          map[string]string{XOriginalURLHeader: "https://grafana.example.org/d/abc?orgId=1"},
+			wantCookieDomain: "example.org",
+			wantLoginURL:     "/sso/begin?return_to=https%3A%2F%2Fgrafana.example.org%2Fd%2Fabc%3ForgId%3D1",
+		},
+		{
+			name:             "X-Forwarded-Host",
+			headers:          map[string]string{XForwardedHostHeader: "wiki.example.com", XForwardedURIHeader: "/page?id=1", "X-Forwarded-Proto": "http"},
+			wantCookieDomain: "example.com",
+			wantLoginURL:     "/sso/begin?return_to=http%3A%2F%2Fwiki.example.com%2Fpage%3Fid%3D1",
+		},
+		{
+			name:    "not in the cookie domains",
+			headers: map[string]string{XOriginalURLHeader: "https://grafana.example.net/"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Server{SSO: sso.NewHandoff([]string{"example.com", "example.org"}), SSOURL: "https://auth.example.com"}
+			r := httptest.NewRequest("GET", "/auth_jwt_request", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			s.setSSOHeaders(w, r)
+			if got := w.Header().Get(XAuthCookieDomainHeader); got != tt.wantCookieDomain {
+				t.Errorf("X-Auth-Cookie-Domain = %v, want %v", got, tt.wantCookieDomain)
+			}
+			if got := w.Header().Get(XAuthLoginURLHeader); got != tt.wantLoginURL {
+				t.Errorf("X-Auth-Login-URL = %v, want %v", got, tt.wantLoginURL)
+			}
+		})
+	}
+}
+
+func TestServer_ssoBegin(t *testing.T) {
+	tests := []struct {
+		name       string
+		returnTo   string
+		wantStatus int
+	}{
+		{name: "ok", returnTo: "https://grafana.example.org/d/abc", wantStatus: http.StatusFound},
+		{name: "another host", returnTo: "https://wiki.example.org/", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Server{SSO: sso.NewHandoff([]string{"example.com", "example.org"}), SSOURL: "https://auth.example.com"}
+			r := httptest.NewRequest("GET", "https://grafana.example.org/sso/begin?"+neturl.Values{"return_to": {tt.returnTo}}.Encode(), nil)
+			w := httptest.NewRecorder()
+
+			s.ssoBegin(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("ssoBegin() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusFound {
+				return
+			}
+			cookies := w.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Name != CookieSSONonceName || cookies[0].Path != "/sso/callback" || cookies[0].Value == "" {
+				t.Fatalf("ssoBegin() cookies = %v", cookies)
+			}
+			loc, err := neturl.Parse(w.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loc.Host != "auth.example.com" || loc.Path != "/sso/start" || loc.Query().Get("return_to") != tt.returnTo || loc.Query().Get("nonce") != cookies[0].Value {
+				t.Errorf("ssoBegin() Location = %v", loc)
+			}
+		})
+	}
+}
+
+func TestServer_ssoCallback(t *testing.T) {
+	tests := []struct {
+		name       string
+		cookie     *http.Cookie
+		wantStatus int
+	}{
+		{name: "ok", cookie: &http.Cookie{Name: CookieSSONonceName, Value: "nonce123"}, wantStatus: http.StatusFound},
+		// 攻撃者が発行させた code を別のブラウザで踏ませても引き換えられない
+		{name: "another browser", cookie: &http.Cookie{Name: CookieSSONonceName, Value: "victim"}, wantStatus: http.StatusBadRequest},
+		{name: "no nonce cookie", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handoff := sso.NewHandoff([]string{"example.com", "example.org"})
+			callback, err := handoff.IssueCode("jwt-token", "https://grafana.example.org/d/abc", "nonce123")
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := Server{SSO: handoff}
+			r := httptest.NewRequest("GET", callback, nil)
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+			w := httptest.NewRecorder()
+
+			s.ssoCallback(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("ssoCallback() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusFound && w.Header().Get("Location") != "https://grafana.example.org/d/abc" {
+				t.Errorf("ssoCallback() Location = %v", w.Header().Get("Location"))
+			}
+		})
+	}
+}
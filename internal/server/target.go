@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+)
+
+const (
+	XOriginalURLHeader   = "X-Original-URL"
+	XForwardedHostHeader = "X-Forwarded-Host"
+	XForwardedURIHeader  = "X-Forwarded-Uri"
+)
+
+// requestTarget は nginx の auth_request から渡されたヘッダから、本来のアクセス先の host と path を返す
+// X-Original-URL があればそれを使い、なければ X-Forwarded-Host (+ X-Forwarded-Uri) を使う
+// path は percent-encoding されたまま返す。policy.Evaluate で正規化してから照合する
+func requestTarget(r *http.Request) (host string, path string) {
+	if v := r.Header.Get(XOriginalURLHeader); v != "" {
+		if u, err := url.Parse(v); err == nil {
+			host = u.Host
+			path = u.EscapedPath()
+		}
+	}
+	if host == "" {
+		host = r.Header.Get(XForwardedHostHeader)
+	}
+	if path == "" {
+		if v := r.Header.Get(XForwardedURIHeader); v != "" {
+			if u, err := url.ParseRequestURI(v); err == nil {
+				path = u.EscapedPath()
+			}
+		}
+	}
+
+	if host == "" {
+		host = r.Host
+	}
+	if path == "" {
+		path = "/"
+	}
+	return host, path
+}
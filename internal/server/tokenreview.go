@@ -0,0 +1,44 @@
+package server
+
+import (
+	"azuki774/go-authenticator/internal/tokenreview"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+type TokenReviewer interface {
+	Review(req tokenreview.TokenReview) (tokenreview.TokenReview, error)
+}
+
+// tokenReview は kube-apiserver の --authentication-token-webhook-config-file で指定する webhook
+func (s Server) tokenReview(w http.ResponseWriter, r *http.Request) {
+	sourceIP := clientIP(r)
+	if len(s.TokenReviewAllow) > 0 && !s.TokenReviewAllow.Contains(sourceIP) {
+		zap.L().Warn("TokenReview denied by network", zap.String("client_ip", sourceIP))
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	var req tokenreview.TokenReview
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		zap.L().Warn("invalid TokenReview body", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	res, err := s.TokenReviewer.Review(req)
+	if err != nil {
+		if errors.Is(err, tokenreview.ErrInvalidRequest) {
+			zap.L().Warn("invalid TokenReview", zap.String("apiVersion", req.APIVersion), zap.String("kind", req.Kind))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		zap.L().Error("failed to review token", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,98 @@
+package session
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltBucket = []byte("sessions")
+
+// BoltStore はセッションを BoltDB のファイルに保存する。再起動しても残るが、複数台では共有されない
+type BoltStore struct {
+	db *bolt.DB
+}
+
+type boltEntry struct {
+	Session  Session   `json:"session"`
+	Deadline time.Time `json:"deadline"`
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
+
+func (b *BoltStore) Save(s Session, ttl time.Duration) error {
+	v, err := json.Marshal(boltEntry{Session: s, Deadline: util.NowFunc().Add(ttl)})
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(s.ID), v)
+	})
+}
+
+func (b *BoltStore) Get(id string) (Session, bool, error) {
+	var e boltEntry
+	var found bool
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltBucket).Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &e)
+	})
+	if err != nil || !found || util.NowFunc().After(e.Deadline) {
+		return Session{}, false, err
+	}
+	return e.Session, true, nil
+}
+
+func (b *BoltStore) Delete(id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete([]byte(id))
+	})
+}
+
+// List は有効なセッションを返し、期限切れのものを削除する
+func (b *BoltStore) List() ([]Session, error) {
+	var sessions []Session
+	now := util.NowFunc()
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var e boltEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if now.After(e.Deadline) {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				continue
+			}
+			sessions = append(sessions, e.Session)
+		}
+		return nil
+	})
+	return sessions, err
+}
@@ -0,0 +1,66 @@
+package session
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"sync"
+	"time"
+)
+
+// MemoryStore はセッションをメモリ上に保存する。再起動すると全員ログアウトになり、複数台では共有されない
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	session  Session
+	deadline time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]memoryEntry)}
+}
+
+func (m *MemoryStore) Save(s Session, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := util.NowFunc()
+	for k, v := range m.sessions {
+		if now.After(v.deadline) {
+			delete(m.sessions, k)
+		}
+	}
+	m.sessions[s.ID] = memoryEntry{session: s, deadline: now.Add(ttl)}
+	return nil
+}
+
+func (m *MemoryStore) Get(id string) (Session, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.sessions[id]
+	if !ok || util.NowFunc().After(e.deadline) {
+		return Session{}, false, nil
+	}
+	return e.session, true, nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *MemoryStore) List() ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := util.NowFunc()
+	var sessions []Session
+	for _, e := range m.sessions {
+		if !now.After(e.deadline) {
+			sessions = append(sessions, e.session)
+		}
+	}
+	return sessions, nil
+}
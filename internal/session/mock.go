@@ -0,0 +1,153 @@
+package session
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeRedis は RedisStore が使うコマンドだけを実装した Redis サーバ。有効期限は util.NowFunc で判断する
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mu       sync.Mutex
+	values   map[string]fakeRedisValue
+	sets     map[string]map[string]bool
+	commands []string // 受け取ったコマンド名
+}
+
+type fakeRedisValue struct {
+	value    string
+	deadline time.Time // zero の場合は期限なし
+}
+
+func newFakeRedis(password string) (*fakeRedis, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	f := &fakeRedis{listener: l, password: password, values: make(map[string]fakeRedisValue), sets: make(map[string]map[string]bool)}
+	go f.serve()
+	return f, nil
+}
+
+func (f *fakeRedis) Addr() string { return f.listener.Addr().String() }
+
+func (f *fakeRedis) Close() error { return f.listener.Close() }
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	authed := f.password == ""
+	for {
+		v, err := readRESP(rd)
+		if err != nil {
+			return
+		}
+		list, _ := v.([]any)
+		var args []string
+		for _, e := range list {
+			b, _ := e.([]byte)
+			args = append(args, string(b))
+		}
+		if len(args) == 0 {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		if cmd == "AUTH" {
+			if len(args) == 2 && args[1] == f.password {
+				authed = true
+				conn.Write([]byte("+OK\r\n"))
+			} else {
+				conn.Write([]byte("-WRONGPASS invalid password\r\n"))
+			}
+			continue
+		}
+		if !authed {
+			conn.Write([]byte("-NOAUTH Authentication required.\r\n"))
+			continue
+		}
+		conn.Write(f.exec(cmd, args[1:]))
+	}
+}
+
+func (f *fakeRedis) exec(cmd string, args []string) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, cmd)
+
+	now := util.NowFunc()
+	for k, v := range f.values {
+		if !v.deadline.IsZero() && now.After(v.deadline) {
+			delete(f.values, k)
+		}
+	}
+
+	switch {
+	case cmd == "PING":
+		return []byte("+PONG\r\n")
+	case cmd == "SELECT" && len(args) == 1:
+		return []byte("+OK\r\n")
+	case cmd == "SET" && (len(args) == 2 || len(args) == 4 && strings.ToUpper(args[2]) == "PX"):
+		v := fakeRedisValue{value: args[1]}
+		if len(args) == 4 {
+			ms, err := strconv.ParseInt(args[3], 10, 64)
+			if err != nil || ms <= 0 {
+				return []byte("-ERR invalid expire time in 'set' command\r\n")
+			}
+			v.deadline = now.Add(time.Duration(ms) * time.Millisecond)
+		}
+		f.values[args[0]] = v
+		return []byte("+OK\r\n")
+	case cmd == "GET" && len(args) == 1:
+		v, ok := f.values[args[0]]
+		if !ok {
+			return []byte("$-1\r\n")
+		}
+		return []byte("$" + strconv.Itoa(len(v.value)) + "\r\n" + v.value + "\r\n")
+	case cmd == "DEL" && len(args) >= 1:
+		n := 0
+		for _, k := range args {
+			if _, ok := f.values[k]; ok {
+				delete(f.values, k)
+				n++
+			}
+		}
+		return []byte(":" + strconv.Itoa(n) + "\r\n")
+	case cmd == "SADD" && len(args) >= 2:
+		if f.sets[args[0]] == nil {
+			f.sets[args[0]] = make(map[string]bool)
+		}
+		for _, m := range args[1:] {
+			f.sets[args[0]][m] = true
+		}
+		return []byte(":" + strconv.Itoa(len(args)-1) + "\r\n")
+	case cmd == "SREM" && len(args) >= 2:
+		for _, m := range args[1:] {
+			delete(f.sets[args[0]], m)
+		}
+		return []byte(":" + strconv.Itoa(len(args)-1) + "\r\n")
+	case cmd == "SMEMBERS" && len(args) == 1:
+		var members []string
+		for m := range f.sets[args[0]] {
+			members = append(members, m)
+		}
+		return encodeRESP(members)
+	}
+	return []byte("-ERR unknown command '" + cmd + "'\r\n")
+}
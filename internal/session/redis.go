@@ -0,0 +1,222 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const redisKeyPrefix = "go-authenticator:session:"
+
+// redis の一覧用の set。SCAN を使わずに List できるようにする。期限切れの ID は List のときに取り除く
+const redisIndexKey = "go-authenticator:sessions"
+
+// RedisStore はセッションを Redis (または Valkey などの互換サーバ) に保存する。複数台で共有できる
+// 使うコマンドは SET, GET, DEL, SADD, SREM, SMEMBERS のみ
+type RedisStore struct {
+	Addr     string
+	Password string // 空の場合は AUTH しない
+	DB       int
+	Timeout  time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+var errRedisNil = errors.New("redis: nil")
+
+func NewRedisStore(addr, password string, db int) *RedisStore {
+	return &RedisStore{Addr: addr, Password: password, DB: db, Timeout: 5 * time.Second}
+}
+
+func (r *RedisStore) Save(s Session, ttl time.Duration) error {
+	v, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	ms := max(ttl.Milliseconds(), 1)
+	if _, err := r.do("SET", redisKeyPrefix+s.ID, string(v), "PX", strconv.FormatInt(ms, 10)); err != nil {
+		return err
+	}
+	_, err = r.do("SADD", redisIndexKey, s.ID)
+	return err
+}
+
+func (r *RedisStore) Get(id string) (Session, bool, error) {
+	v, err := r.do("GET", redisKeyPrefix+id)
+	if errors.Is(err, errRedisNil) {
+		return Session{}, false, nil
+	} else if err != nil {
+		return Session{}, false, err
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return Session{}, false, fmt.Errorf("redis: unexpected reply to GET: %v", v)
+	}
+	var s Session
+	if err := json.Unmarshal(b, &s); err != nil {
+		return Session{}, false, err
+	}
+	return s, true, nil
+}
+
+func (r *RedisStore) Delete(id string) error {
+	if _, err := r.do("DEL", redisKeyPrefix+id); err != nil {
+		return err
+	}
+	_, err := r.do("SREM", redisIndexKey, id)
+	return err
+}
+
+func (r *RedisStore) List() ([]Session, error) {
+	v, err := r.do("SMEMBERS", redisIndexKey)
+	if err != nil {
+		return nil, err
+	}
+	ids, _ := v.([]any)
+	var sessions []Session
+	for _, e := range ids {
+		id, _ := e.([]byte)
+		s, ok, err := r.Get(string(id))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			// 期限切れで消えたキー
+			if _, err := r.do("SREM", redisIndexKey, string(id)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// do はコマンドを送って応答を返す。通信エラーの場合は接続を閉じ、次の呼び出しで接続し直す
+func (r *RedisStore) do(args ...string) (any, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		if err := r.connect(); err != nil {
+			return nil, err
+		}
+	}
+	v, err := r.roundTrip(args...)
+	var rerr redisError
+	if err != nil && !errors.Is(err, errRedisNil) && !errors.As(err, &rerr) {
+		zap.L().Warn("redis connection error", zap.String("addr", r.Addr), zap.Error(err))
+		r.conn.Close()
+		r.conn = nil
+	}
+	return v, err
+}
+
+func (r *RedisStore) connect() error {
+	conn, err := net.DialTimeout("tcp", r.Addr, r.Timeout)
+	if err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+	r.conn = conn
+	r.rd = bufio.NewReader(conn)
+
+	if r.Password != "" {
+		if _, err := r.roundTrip("AUTH", r.Password); err != nil {
+			r.conn.Close()
+			r.conn = nil
+			return fmt.Errorf("redis: AUTH: %w", err)
+		}
+	}
+	if r.DB != 0 {
+		if _, err := r.roundTrip("SELECT", strconv.Itoa(r.DB)); err != nil {
+			r.conn.Close()
+			r.conn = nil
+			return fmt.Errorf("redis: SELECT: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *RedisStore) roundTrip(args ...string) (any, error) {
+	if r.Timeout > 0 {
+		r.conn.SetDeadline(time.Now().Add(r.Timeout))
+	}
+	if _, err := r.conn.Write(encodeRESP(args)); err != nil {
+		return nil, err
+	}
+	return readRESP(r.rd)
+}
+
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// encodeRESP はコマンドを RESP の bulk string の配列にする
+func encodeRESP(args []string) []byte {
+	b := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		b = append(b, "$"+strconv.Itoa(len(a))+"\r\n"+a+"\r\n"...)
+	}
+	return b
+}
+
+// readRESP は応答を 1 つ読む。simple string は string, bulk string は []byte, integer は int64, 配列は []any になる
+func readRESP(rd *bufio.Reader) (any, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply: %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		list := make([]any, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := readRESP(rd)
+			if err != nil && !errors.Is(err, errRedisNil) {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type: %q", line)
+}
@@ -0,0 +1,168 @@
+package session
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/util"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultIdleTimeout     = 30 * time.Minute
+	DefaultAbsoluteTimeout = 12 * time.Hour
+)
+
+// LastSeenAt の更新の間隔。リクエストごとにストアに書き込まないようにする
+const touchInterval = time.Minute
+
+// Session はサーバ側に保存するログイン状態。Cookie には ID の元になるランダムな token のみを入れる
+type Session struct {
+	ID         string          `json:"id"` // token の sha256。ストアが漏れても Cookie を復元できないようにする
+	Principal  model.Principal `json:"principal"`
+	CreatedAt  time.Time       `json:"created_at"`
+	LastSeenAt time.Time       `json:"last_seen_at"`
+	ExpiresAt  time.Time       `json:"expires_at"`   // 絶対タイムアウト
+	IP         string          `json:"ip,omitempty"` // 最後にアクセスした送信元
+}
+
+// Store はセッションを保存する。ttl を過ぎたセッションは Get, List で返さない
+type Store interface {
+	Save(s Session, ttl time.Duration) error
+	Get(id string) (s Session, ok bool, err error)
+	Delete(id string) error
+	List() ([]Session, error)
+}
+
+// Manager はアイドルタイムアウトと絶対タイムアウトを適用しながら、セッションを作成・検索する
+type Manager struct {
+	Store           Store
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+}
+
+func NewManager(store Store) *Manager {
+	return &Manager{Store: store, IdleTimeout: DefaultIdleTimeout, AbsoluteTimeout: DefaultAbsoluteTimeout}
+}
+
+// Create はセッションを作成し、Cookie に入れる token を返す
+func (m *Manager) Create(principal model.Principal) (token string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+
+	now := util.NowFunc()
+	s := Session{
+		ID:         ID(token),
+		Principal:  principal,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(m.AbsoluteTimeout),
+	}
+	if err := m.Store.Save(s, m.ttl(s, now)); err != nil {
+		return "", err
+	}
+	zap.L().Info("session created", zap.String("id", s.ID[:8]), zap.String("provider", principal.Provider), zap.String("user", principal.Name))
+	return token, nil
+}
+
+// Lookup は token のセッションを返す。タイムアウトしたセッションは削除して ok = false を返す
+func (m *Manager) Lookup(token string, ip string) (s Session, ok bool, err error) {
+	s, ok, err = m.Store.Get(ID(token))
+	if err != nil || !ok {
+		return Session{}, false, err
+	}
+
+	now := util.NowFunc()
+	if now.After(s.ExpiresAt) || now.After(s.LastSeenAt.Add(m.IdleTimeout)) {
+		zap.L().Info("session timed out", zap.String("id", s.ID[:8]), zap.Time("last_seen_at", s.LastSeenAt), zap.Time("expires_at", s.ExpiresAt))
+		if err := m.Store.Delete(s.ID); err != nil {
+			zap.L().Warn("failed to delete session", zap.Error(err))
+		}
+		return Session{}, false, nil
+	}
+
+	if now.Sub(s.LastSeenAt) >= touchInterval || (ip != "" && ip != s.IP) {
+		s.LastSeenAt = now
+		if ip != "" {
+			s.IP = ip
+		}
+		if err := m.Store.Save(s, m.ttl(s, now)); err != nil {
+			// 更新に失敗しても認証は通す
+			zap.L().Warn("failed to update session", zap.String("id", s.ID[:8]), zap.Error(err))
+		}
+	}
+	return s, true, nil
+}
+
+// Delete は token のセッションを削除する (ログアウト)
+func (m *Manager) Delete(token string) error {
+	return m.Store.Delete(ID(token))
+}
+
+// List は有効なセッションを返す
+func (m *Manager) List() ([]Session, error) {
+	sessions, err := m.Store.List()
+	if err != nil {
+		return nil, err
+	}
+	now := util.NowFunc()
+	var active []Session
+	for _, s := range sessions {
+		if now.After(s.ExpiresAt) || now.After(s.LastSeenAt.Add(m.IdleTimeout)) {
+			continue
+		}
+		active = append(active, s)
+	}
+	return active, nil
+}
+
+// Revoke は ID (token の sha256) でセッションを削除する。管理 API から使う
+func (m *Manager) Revoke(id string) (found bool, err error) {
+	_, found, err = m.Store.Get(id)
+	if err != nil || !found {
+		return false, err
+	}
+	if err := m.Store.Delete(id); err != nil {
+		return false, err
+	}
+	zap.L().Info("session revoked", zap.String("id", id[:min(len(id), 8)]))
+	return true, nil
+}
+
+// RevokeUser はユーザのセッションをすべて削除し、削除した数を返す
+func (m *Manager) RevokeUser(provider, subject string) (int, error) {
+	sessions, err := m.Store.List()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, s := range sessions {
+		if s.Principal.Provider != provider || s.Principal.Subject != subject {
+			continue
+		}
+		if err := m.Store.Delete(s.ID); err != nil {
+			return n, err
+		}
+		n++
+	}
+	zap.L().Info("user sessions revoked", zap.String("provider", provider), zap.String("subject", subject), zap.Int("sessions", n))
+	return n, nil
+}
+
+// ttl はアイドルタイムアウトまでの時間。絶対タイムアウトを超えない
+func (m *Manager) ttl(s Session, now time.Time) time.Duration {
+	return min(m.IdleTimeout, s.ExpiresAt.Sub(now))
+}
+
+// ID は Cookie の token からセッションの ID を求める
+func ID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
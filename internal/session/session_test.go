@@ -0,0 +1,122 @@
+package session
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/util"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestManager_Lookup(t *testing.T) {
+	start := time.Unix(1721142000, 0)
+	principal := model.Principal{Provider: "github", Subject: "100000", Name: "octocat", Roles: []string{"admin"}}
+	tests := []struct {
+		name   string
+		steps  []time.Duration // Lookup する時刻 (start からの経過時間)
+		wantOK bool
+	}{
+		{name: "ok", steps: []time.Duration{time.Minute}, wantOK: true},
+		{name: "idle timeout", steps: []time.Duration{31 * time.Minute}, wantOK: false},
+		{name: "kept alive by access", steps: []time.Duration{20 * time.Minute, 40 * time.Minute, 60 * time.Minute}, wantOK: true},
+		{name: "absolute timeout", steps: []time.Duration{20 * time.Minute, 40 * time.Minute, 60 * time.Minute, 80 * time.Minute, 100 * time.Minute, 121 * time.Minute}, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start
+			util.NowFunc = func() time.Time { return now }
+			defer func() { util.NowFunc = time.Now }()
+
+			m := NewManager(NewMemoryStore())
+			m.IdleTimeout = 30 * time.Minute
+			m.AbsoluteTimeout = 2 * time.Hour
+			token, err := m.Create(principal)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got Session
+			var ok bool
+			for _, d := range tt.steps {
+				now = start.Add(d)
+				got, ok, err = m.Lookup(token, "192.0.2.1")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("Manager.Lookup() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				// タイムアウトしたセッションは削除される
+				if _, found, _ := m.Store.Get(ID(token)); found {
+					t.Errorf("timed out session is not deleted")
+				}
+				return
+			}
+			if !reflect.DeepEqual(got.Principal, principal) || got.IP != "192.0.2.1" || !got.LastSeenAt.Equal(now) || !got.ExpiresAt.Equal(start.Add(2*time.Hour)) {
+				t.Errorf("Manager.Lookup() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestManager_Delete(t *testing.T) {
+	m := NewManager(NewMemoryStore())
+	token, err := m.Create(model.Principal{Provider: "basic", Subject: "user", Name: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := m.Create(model.Principal{Provider: "basic", Subject: "user", Name: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == other {
+		t.Fatalf("Manager.Create() returned the same token twice")
+	}
+
+	if err := m.Delete(token); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := m.Lookup(token, ""); ok {
+		t.Errorf("Manager.Lookup() after Delete ok = true")
+	}
+	if _, ok, _ := m.Lookup(other, ""); !ok {
+		t.Errorf("Manager.Lookup(other) after Delete ok = false")
+	}
+	// 推測した ID をそのまま Cookie に入れても使えない
+	if _, ok, _ := m.Lookup(ID(other), ""); ok {
+		t.Errorf("Manager.Lookup(ID) ok = true")
+	}
+}
+
+func TestManager_RevokeUser(t *testing.T) {
+	m := NewManager(NewMemoryStore())
+	octocat := model.Principal{Provider: "github", Subject: "100000", Name: "octocat"}
+	var tokens []string
+	for _, p := range []model.Principal{octocat, octocat, {Provider: "basic", Subject: "100000", Name: "100000"}} {
+		token, err := m.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	n, err := m.RevokeUser("github", "100000")
+	if err != nil || n != 2 {
+		t.Errorf("Manager.RevokeUser() = %v, %v, want 2", n, err)
+	}
+	for i, want := range []bool{false, false, true} {
+		if _, ok, _ := m.Lookup(tokens[i], ""); ok != want {
+			t.Errorf("Manager.Lookup(tokens[%d]) ok = %v, want %v", i, ok, want)
+		}
+	}
+
+	found, err := m.Revoke(ID(tokens[2]))
+	if err != nil || !found {
+		t.Errorf("Manager.Revoke() = %v, %v, want true", found, err)
+	}
+	if found, _ := m.Revoke(ID(tokens[2])); found {
+		t.Errorf("Manager.Revoke() twice = true, want false")
+	}
+}
@@ -0,0 +1,109 @@
+package session
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/util"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	tests := []struct {
+		name  string
+		store func(t *testing.T) Store
+	}{
+		{name: "memory", store: func(t *testing.T) Store { return NewMemoryStore() }},
+		{name: "bolt", store: func(t *testing.T) Store {
+			s, err := NewBoltStore(filepath.Join(t.TempDir(), "sessions.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		}},
+		{name: "redis", store: func(t *testing.T) Store {
+			f, err := newFakeRedis("secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { f.Close() })
+			return NewRedisStore(f.Addr(), "secret", 1)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(1721142000, 0).UTC()
+			util.NowFunc = func() time.Time { return now }
+			defer func() { util.NowFunc = time.Now }()
+
+			store := tt.store(t)
+			a := Session{ID: "a", Principal: model.Principal{Provider: "github", Subject: "100000", Name: "octocat", Groups: []string{"myorg/infra"}}, CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(time.Hour), IP: "192.0.2.1"}
+			b := Session{ID: "b", Principal: model.Principal{Provider: "basic", Subject: "user", Name: "user"}, CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)}
+			if err := store.Save(a, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Save(b, 10*time.Minute); err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok, err := store.Get("a")
+			if err != nil || !ok || !reflect.DeepEqual(got, a) {
+				t.Errorf("Store.Get(a) = %+v, %v, %v, want %+v", got, ok, err, a)
+			}
+			if _, ok, err := store.Get("unknown"); ok || err != nil {
+				t.Errorf("Store.Get(unknown) = %v, %v", ok, err)
+			}
+			if list, err := store.List(); err != nil || len(list) != 2 {
+				t.Errorf("Store.List() = %v, %v, want 2 sessions", list, err)
+			}
+
+			// ttl を過ぎたものは返さない
+			now = now.Add(2 * time.Minute)
+			if _, ok, _ := store.Get("a"); ok {
+				t.Errorf("Store.Get(a) after ttl ok = true")
+			}
+			list, err := store.List()
+			if err != nil || len(list) != 1 || list[0].ID != "b" {
+				t.Errorf("Store.List() after ttl = %v, %v, want [b]", list, err)
+			}
+
+			if err := store.Delete("b"); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok, _ := store.Get("b"); ok {
+				t.Errorf("Store.Get(b) after Delete ok = true")
+			}
+			if list, err := store.List(); err != nil || len(list) != 0 {
+				t.Errorf("Store.List() after Delete = %v, %v, want empty", list, err)
+			}
+		})
+	}
+}
+
+func TestRedisStore_auth(t *testing.T) {
+	f, err := newFakeRedis("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, _, err := NewRedisStore(f.Addr(), "wrong", 0).Get("a"); err == nil {
+		t.Errorf("RedisStore.Get() with wrong password error = nil")
+	}
+	if _, _, err := NewRedisStore(f.Addr(), "", 0).Get("a"); err == nil {
+		t.Errorf("RedisStore.Get() without password error = nil")
+	}
+
+	// サーバが再起動して接続が切れても、次の呼び出しで接続し直す
+	s := NewRedisStore(f.Addr(), "secret", 0)
+	if err := s.Save(Session{ID: "a"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	s.conn.Close()
+	s.Get("a")
+	if _, ok, err := s.Get("a"); !ok || err != nil {
+		t.Errorf("RedisStore.Get() after reconnect = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,59 @@
+package session
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"azuki774/go-authenticator/internal/util"
+	"time"
+)
+
+// Tracker は Cookie に入れて発行した JWT を jti で記録する。管理 API でログイン中のユーザを一覧するために使う
+// 失効は Tracker ではなく失効リストで行う (記録が消えても JWT 自体は有効なまま)
+type Tracker struct {
+	Store Store
+}
+
+func NewTracker(store Store) *Tracker {
+	return &Tracker{Store: store}
+}
+
+// Track は発行した JWT を有効期限まで記録する
+func (t *Tracker) Track(jti string, principal model.Principal, exp time.Time) error {
+	now := util.NowFunc()
+	s := Session{
+		ID:         jti,
+		Principal:  principal,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  exp,
+	}
+	return t.Store.Save(s, exp.Sub(now))
+}
+
+// Seen は JWT が使われた時刻と送信元を記録する。記録のない jti (再起動前に発行したものなど) は無視する
+func (t *Tracker) Seen(jti string, ip string) error {
+	s, ok, err := t.Store.Get(jti)
+	if err != nil || !ok {
+		return err
+	}
+	now := util.NowFunc()
+	if now.Sub(s.LastSeenAt) < touchInterval && (ip == "" || ip == s.IP) {
+		return nil
+	}
+	s.LastSeenAt = now
+	if ip != "" {
+		s.IP = ip
+	}
+	return t.Store.Save(s, s.ExpiresAt.Sub(now))
+}
+
+func (t *Tracker) Get(jti string) (Session, bool, error) {
+	return t.Store.Get(jti)
+}
+
+func (t *Tracker) Delete(jti string) error {
+	return t.Store.Delete(jti)
+}
+
+func (t *Tracker) List() ([]Session, error) {
+	return t.Store.List()
+}
@@ -0,0 +1,127 @@
+package sso
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const DefaultCodeLife = 1 * time.Minute
+
+var ErrDomainNotAllowed = errors.New("return_to is not in the cookie domains")
+
+// Handoff は、ログインしたドメインの Cookie (JWT) を、別のドメインに一度きりの code で受け渡す
+// code は URL に載るので、トークンそのものは載せずにサーバ側で保持する
+type Handoff struct {
+	Domains  []string // e.g. example.com, example.org。サブドメインにも Cookie が有効になる
+	CodeLife time.Duration
+
+	mu    sync.Mutex
+	codes map[string]handoffCode
+}
+
+type handoffCode struct {
+	grant   Grant
+	nonce   string // /sso/begin で受け取る側のドメインの Cookie にセットした値。code を発行したブラウザでのみ引き換えられるようにする
+	expires time.Time
+}
+
+// Grant は code と引き換えに、受け取った側のドメインで Cookie にセットするもの
+type Grant struct {
+	Token    string // JWT
+	Domain   string // Cookie の Domain
+	ReturnTo string // Cookie をセットしたあとに戻る先
+}
+
+func NewHandoff(domains []string) *Handoff {
+	var ds []string
+	for _, d := range domains {
+		ds = append(ds, strings.ToLower(strings.TrimPrefix(d, ".")))
+	}
+	return &Handoff{Domains: ds, CodeLife: DefaultCodeLife, codes: make(map[string]handoffCode)}
+}
+
+// Domain は host が属する Cookie のドメインを返す。複数に一致する場合は最も長いもの
+func (h *Handoff) Domain(host string) (string, bool) {
+	if hh, _, err := net.SplitHostPort(host); err == nil {
+		host = hh
+	}
+	host = strings.ToLower(host)
+
+	var domain string
+	for _, d := range h.Domains {
+		if (host == d || strings.HasSuffix(host, "."+d)) && len(d) > len(domain) {
+			domain = d
+		}
+	}
+	return domain, domain != ""
+}
+
+// IssueCode は returnTo (絶対 URL) のドメインで token を受け取るための code を発行し、その host の /sso/callback の URL を返す
+// returnTo がどの Cookie のドメインにも属さない場合はオープンリダイレクトになるので拒否する
+// code は nonce と同じ値の Cookie を持つブラウザでのみ引き換えられる
+func (h *Handoff) IssueCode(token string, returnTo string, nonce string) (callbackURL string, err error) {
+	u, err := url.Parse(returnTo)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "", ErrDomainNotAllowed
+	}
+	domain, ok := h.Domain(u.Host)
+	if !ok {
+		return "", ErrDomainNotAllowed
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := base64.RawURLEncoding.EncodeToString(b)
+
+	now := util.NowFunc()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for k, v := range h.codes {
+		if now.After(v.expires) {
+			delete(h.codes, k)
+		}
+	}
+	h.codes[code] = handoffCode{
+		grant:   Grant{Token: token, Domain: domain, ReturnTo: returnTo},
+		nonce:   nonce,
+		expires: now.Add(h.CodeLife),
+	}
+
+	callback := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/sso/callback", RawQuery: url.Values{"code": {code}}.Encode()}
+	zap.L().Info("issue sso handoff code", zap.String("domain", domain), zap.String("host", u.Host))
+	return callback.String(), nil
+}
+
+// Exchange は code を Grant と引き換える。code は一度しか使えず、発行したドメインの host で、発行時と同じ nonce を持つ場合にのみ使える
+// 攻撃者が自分の code を踏ませて、被害者を攻撃者のアカウントでログインさせること (login CSRF) を防ぐ
+func (h *Handoff) Exchange(code string, host string, nonce string) (Grant, bool) {
+	h.mu.Lock()
+	c, ok := h.codes[code]
+	delete(h.codes, code)
+	h.mu.Unlock()
+
+	if !ok || util.NowFunc().After(c.expires) {
+		return Grant{}, false
+	}
+	if domain, ok := h.Domain(host); !ok || domain != c.grant.Domain {
+		zap.L().Warn("sso handoff code is used on another domain", zap.String("host", host), zap.String("domain", c.grant.Domain))
+		return Grant{}, false
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(nonce), []byte(c.nonce)) != 1 {
+		zap.L().Warn("sso handoff code is used by another browser", zap.String("host", host))
+		return Grant{}, false
+	}
+	return c.grant, true
+}
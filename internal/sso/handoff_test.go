@@ -0,0 +1,152 @@
+package sso
+
+import (
+	"azuki774/go-authenticator/internal/util"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testBaseTime = 1721142000
+
+func TestHandoff_Domain(t *testing.T) {
+	h := NewHandoff([]string{"example.com", ".example.org", "corp.example.com"})
+	tests := []struct {
+		host   string
+		want   string
+		wantOk bool
+	}{
+		{host: "auth.example.com", want: "example.com", wantOk: true},
+		{host: "example.com", want: "example.com", wantOk: true},
+		{host: "Grafana.Example.ORG:443", want: "example.org", wantOk: true},
+		{host: "wiki.corp.example.com", want: "corp.example.com", wantOk: true},
+		{host: "evilexample.com", wantOk: false},
+		{host: "example.net", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			got, ok := h.Domain(tt.host)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("Handoff.Domain() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestHandoff_IssueCode(t *testing.T) {
+	tests := []struct {
+		name         string
+		returnTo     string
+		host         string // Exchange する host
+		nonce        string // Exchange するブラウザの Cookie の nonce
+		wantCallback string // code を除いた URL
+		wantGrant    Grant
+		wantOk       bool
+		wantErr      error
+	}{
+		{
+			name:         "ok",
+			returnTo:     "https://grafana.example.org/d/abc?orgId=1",
+			host:         "grafana.example.org",
+			nonce:        "nonce123",
+			wantCallback: "https://grafana.example.org/sso/callback",
+			wantGrant:    Grant{Token: "jwt-token", Domain: "example.org", ReturnTo: "https://grafana.example.org/d/abc?orgId=1"},
+			wantOk:       true,
+		},
+		{
+			name:         "another browser",
+			returnTo:     "https://grafana.example.org/",
+			host:         "grafana.example.org",
+			nonce:        "victim",
+			wantCallback: "https://grafana.example.org/sso/callback",
+			wantOk:       false,
+		},
+		{
+			name:         "no nonce cookie",
+			returnTo:     "https://grafana.example.org/",
+			host:         "grafana.example.org",
+			wantCallback: "https://grafana.example.org/sso/callback",
+			wantOk:       false,
+		},
+		{
+			name:         "another host in the same domain",
+			returnTo:     "https://grafana.example.org/",
+			host:         "wiki.example.org",
+			nonce:        "nonce123",
+			wantCallback: "https://grafana.example.org/sso/callback",
+			wantGrant:    Grant{Token: "jwt-token", Domain: "example.org", ReturnTo: "https://grafana.example.org/"},
+			wantOk:       true,
+		},
+		{
+			name:         "another domain",
+			returnTo:     "https://grafana.example.org/",
+			host:         "auth.example.com",
+			nonce:        "nonce123",
+			wantCallback: "https://grafana.example.org/sso/callback",
+			wantOk:       false,
+		},
+		{
+			name:     "not in the cookie domains",
+			returnTo: "https://evil.example.net/",
+			wantErr:  ErrDomainNotAllowed,
+		},
+		{
+			name:     "relative url",
+			returnTo: "/d/abc",
+			wantErr:  ErrDomainNotAllowed,
+		},
+		{
+			name:     "javascript scheme",
+			returnTo: "javascript://grafana.example.org/%0aalert(1)",
+			wantErr:  ErrDomainNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			util.NowFunc = func() time.Time { return time.Unix(testBaseTime, 0) }
+			h := NewHandoff([]string{"example.com", "example.org"})
+			callback, err := h.IssueCode("jwt-token", tt.returnTo, "nonce123")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Handoff.IssueCode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			u, err := url.Parse(callback)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := u.Query().Get("code")
+			u.RawQuery = ""
+			if u.String() != tt.wantCallback || code == "" {
+				t.Errorf("Handoff.IssueCode() = %v, want %v?code=...", callback, tt.wantCallback)
+			}
+
+			got, ok := h.Exchange(code, tt.host, tt.nonce)
+			if ok != tt.wantOk || !reflect.DeepEqual(got, tt.wantGrant) {
+				t.Errorf("Handoff.Exchange() = %v, %v, want %v, %v", got, ok, tt.wantGrant, tt.wantOk)
+			}
+			// code は一度しか使えない
+			if _, ok := h.Exchange(code, tt.host, tt.nonce); ok {
+				t.Errorf("Handoff.Exchange() code is reusable")
+			}
+		})
+	}
+}
+
+func TestHandoff_Exchange_expired(t *testing.T) {
+	util.NowFunc = func() time.Time { return time.Unix(testBaseTime, 0) }
+	h := NewHandoff([]string{"example.org"})
+	callback, err := h.IssueCode("jwt-token", "https://grafana.example.org/", "nonce123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(callback)
+
+	util.NowFunc = func() time.Time { return time.Unix(testBaseTime, 0).Add(DefaultCodeLife + time.Second) }
+	if _, ok := h.Exchange(u.Query().Get("code"), "grafana.example.org", "nonce123"); ok {
+		t.Errorf("Handoff.Exchange() expired code is accepted")
+	}
+}
@@ -0,0 +1,16 @@
+package tokenreview
+
+import "azuki774/go-authenticator/internal/model"
+
+type mockTokenVerifier struct {
+	principals map[string]model.Principal // key: token
+	err        error
+}
+
+func (m *mockTokenVerifier) VerifyToken(token string) (principal model.Principal, ok bool, err error) {
+	if m.err != nil {
+		return model.Principal{}, false, m.err
+	}
+	principal, ok = m.principals[token]
+	return principal, ok, nil
+}
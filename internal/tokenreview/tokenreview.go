@@ -0,0 +1,137 @@
+package tokenreview
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"errors"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	APIVersion = "authentication.k8s.io/v1"
+	Kind       = "TokenReview"
+)
+
+var ErrInvalidRequest = errors.New("invalid TokenReview request")
+
+// TokenReview は kube-apiserver の webhook token authenticator がやりとりする authentication.k8s.io/v1 TokenReview
+// client-go には依存せず、使うフィールドのみ定義する
+type TokenReview struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Spec       TokenReviewSpec   `json:"spec"`
+	Status     TokenReviewStatus `json:"status"`
+}
+
+type TokenReviewSpec struct {
+	Token     string   `json:"token"`
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+type TokenReviewStatus struct {
+	Authenticated bool     `json:"authenticated"`
+	User          UserInfo `json:"user,omitempty"`
+	Audiences     []string `json:"audiences,omitempty"`
+	Error         string   `json:"error,omitempty"`
+}
+
+type UserInfo struct {
+	Username string              `json:"username,omitempty"`
+	UID      string              `json:"uid,omitempty"`
+	Groups   []string            `json:"groups,omitempty"`
+	Extra    map[string][]string `json:"extra,omitempty"`
+}
+
+// TokenVerifier は CheckCookieJWT と同じ検証でトークンから principal を取り出す
+type TokenVerifier interface {
+	VerifyToken(token string) (principal model.Principal, ok bool, err error)
+}
+
+type Reviewer struct {
+	Verifier TokenVerifier
+}
+
+// Review は TokenReview の spec.token を検証し、status を埋めて返す
+// 検証できないトークンは authenticated = false で返し、error を返すのは内部エラーの場合のみ
+func (rv *Reviewer) Review(req TokenReview) (TokenReview, error) {
+	if req.APIVersion != APIVersion || req.Kind != Kind {
+		return TokenReview{}, ErrInvalidRequest
+	}
+	res := TokenReview{APIVersion: APIVersion, Kind: Kind}
+
+	principal, ok, err := rv.Verifier.VerifyToken(req.Spec.Token)
+	if err != nil {
+		zap.L().Warn("invalid token in TokenReview", zap.Error(err))
+		ok = false
+	}
+	if !ok || principal.Subject == "" {
+		res.Status.Error = "invalid token"
+		return res, nil
+	}
+
+	audiences, ok := reviewAudiences(req.Spec.Audiences, principal.Audience)
+	if !ok {
+		zap.L().Warn("token audience mismatched", zap.Strings("want", req.Spec.Audiences), zap.Strings("aud", principal.Audience))
+		res.Status.Error = "token audience mismatched"
+		return res, nil
+	}
+
+	res.Status = TokenReviewStatus{
+		Authenticated: true,
+		User:          userInfo(principal),
+		Audiences:     audiences,
+	}
+	zap.L().Info("TokenReview authenticated", zap.String("username", res.Status.User.Username), zap.Strings("groups", res.Status.User.Groups))
+	return res, nil
+}
+
+// reviewAudiences は spec.audiences のうちトークンが有効な宛先を返す
+// spec.audiences が指定された場合は aud を持たないトークンを拒否する
+// ブラウザのセッションの Cookie は aud を持たず、nginx がすべての upstream に転送するので、受け取った upstream が kube-apiserver に使えてしまう
+func reviewAudiences(want []string, aud []string) ([]string, bool) {
+	if len(want) == 0 {
+		return want, true
+	}
+	var got []string
+	for _, a := range want {
+		if slices.Contains(aud, a) {
+			got = append(got, a)
+		}
+	}
+	return got, len(got) > 0
+}
+
+// userInfo は RBAC の subjects に書く名前を返す
+// username は policy の users と同じ <provider>:<name>、groups はロールと <provider>:<プロバイダ上のグループ>
+// プロバイダ上のグループはユーザが作れるので、ロールや Kubernetes の予約された名前 (system:) と衝突しないように prefix を付ける
+func userInfo(principal model.Principal) UserInfo {
+	u := UserInfo{
+		Username: principal.Provider + ":" + principal.Name,
+		UID:      principal.Provider + ":" + principal.Subject,
+	}
+	groups := slices.Clone(principal.Roles)
+	for _, g := range principal.Groups {
+		groups = append(groups, principal.Provider+":"+g)
+	}
+	for _, g := range groups {
+		if strings.HasPrefix(g, "system:") {
+			zap.L().Warn("group under system: is not passed to kubernetes", zap.String("group", g))
+			continue
+		}
+		if !slices.Contains(u.Groups, g) {
+			u.Groups = append(u.Groups, g)
+		}
+	}
+	if principal.Email != "" {
+		u.Extra = map[string][]string{"email": {principal.Email}}
+	}
+	if len(principal.Scopes) > 0 {
+		if u.Extra == nil {
+			u.Extra = make(map[string][]string)
+		}
+		u.Extra["scopes"] = principal.Scopes
+	}
+	return u
+}
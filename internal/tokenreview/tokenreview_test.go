@@ -0,0 +1,100 @@
+package tokenreview
+
+import (
+	"azuki774/go-authenticator/internal/model"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) TokenReview {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tr TokenReview
+	if err := json.Unmarshal(b, &tr); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return tr
+}
+
+func TestReviewer_Review(t *testing.T) {
+	verifier := &mockTokenVerifier{
+		principals: map[string]model.Principal{
+			"github-octocat": {
+				Provider: "github",
+				Subject:  "100000",
+				Name:     "octocat",
+				Email:    "octocat@example.com",
+				Groups:   []string{"myorg/infra"},
+				Roles:    []string{"admin"},
+			},
+			// プロバイダ上で作った組織の名前でロールや system: のグループにならない
+			"gitea-mallory": {
+				Provider: "gitea",
+				Subject:  "300000",
+				Name:     "mallory",
+				Groups:   []string{"system:masters", "admin"},
+				Roles:    []string{"dev", "system:nodes"},
+			},
+			"client-inventory": {
+				Provider: "client",
+				Subject:  "inventory",
+				Name:     "inventory",
+				Scopes:   []string{"invoices:read"},
+				Audience: []string{"billing"},
+			},
+		},
+	}
+	tests := []struct {
+		name     string
+		verifier TokenVerifier
+		fixture  string // testdata/<fixture>.request.json, testdata/<fixture>.response.json
+		wantErr  error
+	}{
+		{name: "authenticated", verifier: verifier, fixture: "authenticated"},
+		{name: "audience", verifier: verifier, fixture: "audience"},
+		{name: "audience mismatched", verifier: verifier, fixture: "audience_mismatched"},
+		{name: "audience, token without aud", verifier: verifier, fixture: "audience_without_aud"},
+		{name: "provider groups", verifier: verifier, fixture: "system_groups"},
+		{name: "invalid token", verifier: verifier, fixture: "invalid_token"},
+		{name: "verifier error", verifier: &mockTokenVerifier{err: errors.New("error")}, fixture: "invalid_token"},
+		{name: "unsupported apiVersion", verifier: verifier, fixture: "v1beta1", wantErr: ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rv := &Reviewer{Verifier: tt.verifier}
+			got, err := rv.Review(readFixture(t, tt.fixture+".request.json"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reviewer.Review() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			// JSON として比較する (kube-apiserver が受け取る形)
+			gotJSON, err := json.Marshal(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gotMap, wantMap map[string]any
+			if err := json.Unmarshal(gotJSON, &gotMap); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(filepath.Join("testdata", tt.fixture+".response.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(b, &wantMap); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotMap, wantMap) {
+				t.Errorf("Reviewer.Review() = %s, want %s", gotJSON, b)
+			}
+		})
+	}
+}
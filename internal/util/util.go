@@ -1,6 +1,7 @@
 package util
 
 import (
+	"context"
 	"fmt"
 	"math/rand/v2"
 	"time"
@@ -11,3 +12,18 @@ var NowFunc = time.Now
 func PublishID() string {
 	return fmt.Sprintf("%x", rand.Uint64())
 }
+
+type contextKey string
+
+var clientIPKey = contextKey("clientIP")
+
+// WithClientIP は信用できるプロキシを考慮して求めた送信元の IP アドレスを context に格納する
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey, ip)
+}
+
+// ClientIP は WithClientIP で格納した送信元の IP アドレスを返す
+func ClientIP(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPKey).(string)
+	return ip, ok
+}
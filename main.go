@@ -2,6 +2,14 @@ package main
 
 import cmd "azuki774/go-authenticator/cmd/go-authenticator"
 
+// ビルド時に -ldflags "-X main.version=..." で埋め込まれる
+var (
+	version  string
+	revision string
+	build    string
+)
+
 func main() {
+	cmd.SetVersion(version, revision, build)
 	cmd.Execute()
 }
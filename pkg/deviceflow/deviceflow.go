@@ -0,0 +1,183 @@
+// Package deviceflow は go-authenticator の OAuth 2.0 Device Authorization Grant (RFC 8628) のクライアント。
+// SSH 越しなどブラウザを開けない CLI から、ユーザに別の端末で承認してもらって JWT を受け取る。
+//
+//	c := deviceflow.New("https://auth.example.com", "my-cli")
+//	auth, err := c.Start(ctx)
+//	fmt.Printf("Open %s and enter %s\n", auth.VerificationURI, auth.UserCode)
+//	token, err := c.Poll(ctx, auth)
+//	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+package deviceflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const grantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// サーバが interval を返さなかったときの polling 間隔 (RFC 8628 3.2)
+const defaultInterval = 5 * time.Second
+
+var (
+	ErrAccessDenied = errors.New("deviceflow: access denied by user")
+	ErrExpiredToken = errors.New("deviceflow: device code expired")
+)
+
+type Client struct {
+	DeviceAuthorizationURL string
+	TokenURL               string
+	ClientID               string
+	ClientSecret           string // public client の場合は空
+	Scopes                 []string
+	HTTPClient             *http.Client
+}
+
+// New は go-authenticator の issuer URL からクライアントを作る
+func New(issuer, clientID string) *Client {
+	issuer = strings.TrimSuffix(issuer, "/")
+	return &Client{
+		DeviceAuthorizationURL: issuer + "/oauth2/device_authorization",
+		TokenURL:               issuer + "/oauth2/token",
+		ClientID:               clientID,
+		HTTPClient:             &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// DeviceAuthorization は device_authorization endpoint のレスポンス
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// Error はサーバが返した OAuth2 のエラー
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return "deviceflow: " + e.Code
+	}
+	return fmt.Sprintf("deviceflow: %s: %s", e.Code, e.Description)
+}
+
+// Start は device_code と user_code を発行してもらう
+func (c *Client) Start(ctx context.Context) (*DeviceAuthorization, error) {
+	v := url.Values{}
+	if len(c.Scopes) > 0 {
+		v.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	var auth DeviceAuthorization
+	if err := c.post(ctx, c.DeviceAuthorizationURL, v, &auth); err != nil {
+		return nil, err
+	}
+	return &auth, nil
+}
+
+// Poll はユーザが承認するまで token endpoint を polling する
+// 拒否された場合は ErrAccessDenied, 期限が切れた場合は ErrExpiredToken を返す
+func (c *Client) Poll(ctx context.Context, auth *DeviceAuthorization) (*Token, error) {
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	v := url.Values{
+		"grant_type":  {grantTypeDeviceCode},
+		"device_code": {auth.DeviceCode},
+	}
+	for {
+		if err := sleep(ctx, interval); err != nil {
+			return nil, err
+		}
+
+		var token Token
+		err := c.post(ctx, c.TokenURL, v, &token)
+		if err == nil {
+			return &token, nil
+		}
+
+		var oerr *Error
+		if !errors.As(err, &oerr) {
+			return nil, err
+		}
+		switch oerr.Code {
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		case "access_denied":
+			return nil, ErrAccessDenied
+		case "expired_token":
+			return nil, ErrExpiredToken
+		default:
+			return nil, err
+		}
+	}
+}
+
+// sleep はテストで差し替えられるようにしている
+var sleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (c *Client) post(ctx context.Context, endpoint string, v url.Values, out any) error {
+	v.Set("client_id", c.ClientID)
+	if c.ClientSecret != "" {
+		v.Set("client_secret", c.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var oerr Error
+		if json.Unmarshal(body, &oerr) == nil && oerr.Code != "" {
+			return &oerr
+		}
+		return fmt.Errorf("deviceflow: unexpected status %d from %s", resp.StatusCode, endpoint)
+	}
+	return json.Unmarshal(body, out)
+}
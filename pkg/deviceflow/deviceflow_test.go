@@ -0,0 +1,118 @@
+package deviceflow
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer は polling のたびに responses を順に返す
+func fakeServer(t *testing.T, responses []string) *httptest.Server {
+	t.Helper()
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/device_authorization", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("client_id") != "my-cli" || r.PostFormValue("scope") != "openid" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_request"}`))
+			return
+		}
+		w.Write([]byte(`{"device_code":"dc","user_code":"BCDF-GHJK","verification_uri":"https://auth.example.com/device","expires_in":600,"interval":5}`))
+	})
+	mux.HandleFunc("/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("grant_type") != grantTypeDeviceCode || r.PostFormValue("device_code") != "dc" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		res := responses[polls]
+		polls++
+		if strings.HasPrefix(res, `{"error"`) {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		w.Write([]byte(res))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestClient_Poll(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []string
+		want      *Token
+		wantWaits []time.Duration
+		wantErr   error
+	}{
+		{
+			name: "approved",
+			responses: []string{
+				`{"error":"authorization_pending"}`,
+				`{"error":"slow_down"}`,
+				`{"access_token":"jwt","token_type":"Bearer","expires_in":3600}`,
+			},
+			want:      &Token{AccessToken: "jwt", TokenType: "Bearer", ExpiresIn: 3600},
+			wantWaits: []time.Duration{5 * time.Second, 5 * time.Second, 10 * time.Second},
+		},
+		{
+			name:      "denied",
+			responses: []string{`{"error":"authorization_pending"}`, `{"error":"access_denied"}`},
+			wantWaits: []time.Duration{5 * time.Second, 5 * time.Second},
+			wantErr:   ErrAccessDenied,
+		},
+		{
+			name:      "expired",
+			responses: []string{`{"error":"expired_token"}`},
+			wantWaits: []time.Duration{5 * time.Second},
+			wantErr:   ErrExpiredToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var waits []time.Duration
+			sleep = func(ctx context.Context, d time.Duration) error {
+				waits = append(waits, d)
+				return nil
+			}
+			srv := fakeServer(t, tt.responses)
+			defer srv.Close()
+
+			c := New(srv.URL+"/", "my-cli")
+			c.Scopes = []string{"openid"}
+			auth, err := c.Start(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if auth.UserCode != "BCDF-GHJK" {
+				t.Errorf("Client.Start() = %+v", auth)
+			}
+
+			got, err := c.Poll(context.Background(), auth)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Client.Poll() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client.Poll() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(waits, tt.wantWaits) {
+				t.Errorf("Client.Poll() waits = %v, want %v", waits, tt.wantWaits)
+			}
+		})
+	}
+}
+
+func TestClient_Start_error(t *testing.T) {
+	srv := fakeServer(t, nil)
+	defer srv.Close()
+
+	c := New(srv.URL, "unknown")
+	_, err := c.Start(context.Background())
+	var oerr *Error
+	if !errors.As(err, &oerr) || oerr.Code != "invalid_request" {
+		t.Errorf("Client.Start() error = %v, want invalid_request", err)
+	}
+}